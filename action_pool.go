@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+
+	pluginapi "metric-reader/pkg/plugin"
+)
+
+// actionJob is a plugin execution queued on the action pool. done is called with the
+// result once the plugin returned.
+type actionJob struct {
+	plugin pluginapi.ActionPlugin
+	event  *pluginapi.ThresholdEvent
+	done   func(err error)
+}
+
+// actionPool runs plugin executions on a bounded number of workers so slow plugins
+// don't stall the polling loops of the monitors
+type actionPool struct {
+	workers int
+	jobs    chan actionJob
+}
+
+// newActionPool returns a pool with the given number of workers and queued jobs
+func newActionPool(workers int, queueSize int) *actionPool {
+	return &actionPool{workers: workers, jobs: make(chan actionJob, queueSize)}
+}
+
+// start runs the workers until ctx is cancelled. Plugins are executed with ctx.
+func (p *actionPool) start(ctx context.Context) {
+	for i := 0; i < p.workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-p.jobs:
+					actionsQueued.Dec()
+					actionsInFlight.Inc()
+					err := executePlugin(ctx, job.plugin, job.event)
+					actionsInFlight.Dec()
+					job.done(err)
+				}
+			}
+		}()
+	}
+}
+
+// submit queues a job without blocking. It returns false when the queue is full.
+func (p *actionPool) submit(job actionJob) bool {
+	select {
+	case p.jobs <- job:
+		actionsQueued.Inc()
+		return true
+	default:
+		return false
+	}
+}
+
+// Submit implements threshold.Dispatcher. Actions that don't fit in the queue are dropped.
+func (p *actionPool) Submit(plugin pluginapi.ActionPlugin, event *pluginapi.ThresholdEvent, done func(err error)) bool {
+	if !p.submit(actionJob{plugin: plugin, event: event, done: done}) {
+		actionsDroppedTotal.WithLabelValues(event.Monitor, event.Level, plugin.Name()).Inc()
+		return false
+	}
+	return true
+}
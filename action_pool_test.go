@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	pluginapi "metric-reader/pkg/plugin"
+	"metric-reader/pkg/threshold"
+)
+
+// blockingPlugin blocks every execution until release is closed, ignoring its context
+type blockingPlugin struct {
+	name    string
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (p *blockingPlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
+	p.calls.Add(1)
+	<-p.release
+	return nil
+}
+
+func (p *blockingPlugin) Name() string {
+	return p.name
+}
+
+func (p *blockingPlugin) ValidateConfig() error {
+	return nil
+}
+
+// newTestEngine returns an engine for test_metric whose plugins run through executePlugin
+func newTestEngine(t *testing.T, monitorName string, soft *threshold.Level, hard *threshold.Level) *threshold.Engine {
+	t.Helper()
+	var levels []*threshold.Level
+	for _, level := range []*threshold.Level{soft, hard} {
+		if level != nil {
+			levels = append(levels, level)
+		}
+	}
+	e, err := threshold.NewEngine(threshold.Config{
+		Monitor:    monitorName,
+		MetricName: "test_metric",
+		Query:      "test_query",
+		Operator:   threshold.GreaterThan,
+		Levels:     levels,
+		Execute:    executePlugin,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return e
+}
+
+func TestActionPool_AsyncTracksInFlight(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := newActionPool(2, 10)
+	pool.start(ctx)
+
+	plugin := &blockingPlugin{name: "blocking", release: make(chan struct{})}
+	var mu sync.Mutex
+	e := newTestEngine(t, "test", &threshold.Level{Name: "soft", Value: 80, Duration: 5 * time.Second, BackoffDelay: time.Minute, Plugin: plugin}, nil)
+	state := threshold.NewSeries(nil)
+	e.UseDispatcher(pool, &mu, func(model.Metric) *threshold.Series { return state })
+	state.Level("soft").StartTime = time.Now().Add(-10 * time.Second)
+
+	mu.Lock()
+	e.Evaluate(ctx, state, 90)
+	if !state.Level("soft").ActionInFlight {
+		t.Error("expected the action to be in flight")
+	}
+	// A second dispatch while the first one runs is skipped
+	state.Level("soft").BackoffUntil = time.Now().Add(-time.Second)
+	e.Evaluate(ctx, state, 90)
+	mu.Unlock()
+
+	close(plugin.release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		inFlight := state.Level("soft").ActionInFlight
+		backoffUntil := state.Level("soft").BackoffUntil
+		mu.Unlock()
+		if !inFlight {
+			if !backoffUntil.After(time.Now()) {
+				t.Error("expected the backoff to start when the action completed")
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("action did not complete")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := plugin.calls.Load(); got != 1 {
+		t.Errorf("expected the plugin to be executed once, got %d", got)
+	}
+}
+
+// TestActionPool_ResultAppliedToRestoredSeries tests that the result of an action completing
+// after the monitor's state was restored is applied to the restored series
+func TestActionPool_ResultAppliedToRestoredSeries(t *testing.T) {
+	leaderActive.Store(true)
+	defer leaderActive.Store(false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m, err := newMonitor(MonitorConfig{
+		Name:                 "restore_in_flight_test",
+		MetricName:           "test_metric",
+		PollingInterval:      time.Second,
+		MissingValueBehavior: "zero",
+		ThresholdOperator:    "greater_than",
+		Soft:                 &ThresholdSection{Threshold: 80, Duration: 5 * time.Second, BackoffDelay: time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	plugin := &blockingPlugin{name: "blocking_restore", release: make(chan struct{})}
+	m.engine.Level("soft").Plugin = plugin
+	pool := newActionPool(1, 1)
+	pool.start(ctx)
+	m.useActionPool(pool)
+
+	metric := model.Metric{"instance": "node-1"}
+	m.mu.Lock()
+	s := m.trackSeries(metric.Fingerprint(), metric, time.Now())
+	s.state.Level("soft").StartTime = time.Now().Add(-10 * time.Second)
+	m.evaluate(ctx, s, 90.0)
+	m.mu.Unlock()
+
+	// Restoring replaces the tracked series while the action is in flight
+	activeSince := time.Now().Add(-time.Minute)
+	m.restoreState([]persistedSeries{{
+		Labels: map[string]string{"instance": "node-1"},
+		State:  threshold.SoftThresholdActive,
+		Levels: map[string]persistedLevel{"soft": {ActiveSince: &activeSince}},
+	}}, time.Now())
+	close(plugin.release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		m.mu.Lock()
+		backoffUntil := m.series[metric.Fingerprint()].state.Level("soft").BackoffUntil
+		m.mu.Unlock()
+		if !backoffUntil.IsZero() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the action result to start the backoff of the restored series")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !s.state.Level("soft").BackoffUntil.IsZero() {
+		t.Error("expected the replaced series not to be updated")
+	}
+}
+
+func TestActionPool_QueueFull(t *testing.T) {
+	// Without started workers and without queue capacity every submission fails
+	pool := newActionPool(1, 0)
+	plugin := &blockingPlugin{name: "queue_full", release: make(chan struct{})}
+	e := newTestEngine(t, "queue_full_test",
+		&threshold.Level{Name: "soft", Value: 80},
+		&threshold.Level{Name: "hard", Value: 90, Duration: 5 * time.Second, BackoffDelay: time.Minute, Plugin: plugin})
+	state := threshold.NewSeries(nil)
+	e.UseDispatcher(pool, &sync.Mutex{}, func(model.Metric) *threshold.Series { return state })
+	state.State = threshold.SoftThresholdActive
+	state.Level("hard").StartTime = time.Now().Add(-10 * time.Second)
+
+	e.Evaluate(context.Background(), state, 95)
+
+	if state.State != threshold.HardThresholdActive {
+		t.Fatalf("expected HardThresholdActive, got %s", state.State)
+	}
+	if state.Level("hard").ActionInFlight {
+		t.Error("expected the action not to be in flight")
+	}
+	if !strings.Contains(state.Level("hard").ActionError, "action queue full") {
+		t.Errorf("expected queue full failure, got %q", state.Level("hard").ActionError)
+	}
+	if !state.Level("hard").BackoffUntil.IsZero() {
+		t.Error("expected no backoff after a failed action")
+	}
+	if got := testutil.ToFloat64(actionsDroppedTotal.WithLabelValues("queue_full_test", "hard", "queue_full")); got != 1 {
+		t.Errorf("expected 1 dropped action counted, got %v", got)
+	}
+	if got := testutil.ToFloat64(actionFailuresTotal.WithLabelValues("queue_full_test", "hard", "queue_full")); got != 0 {
+		t.Errorf("expected the dropped action not to count as a plugin failure, got %v", got)
+	}
+}
+
+func TestTimeoutPlugin(t *testing.T) {
+	plugin := &blockingPlugin{name: "hung", release: make(chan struct{})}
+	defer close(plugin.release)
+	p := &timeoutPlugin{plugin: plugin, timeout: 50 * time.Millisecond}
+
+	start := time.Now()
+	err := executePlugin(context.Background(), p, &pluginapi.ThresholdEvent{})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the hung plugin to be abandoned, took %v", elapsed)
+	}
+}
+
+func TestApplyPluginTimeouts(t *testing.T) {
+	registry := pluginapi.NewRegistry()
+	registry.Register(&flakyPlugin{name: "efs_emergency"})
+	registry.Register(&flakyPlugin{name: "log_action"})
+	registry.Register(&flakyPlugin{name: "exec_action"})
+
+	applyPluginTimeouts(registry, time.Minute, map[string]time.Duration{"efs_emergency": 10 * time.Second, "exec_action": 0})
+
+	for name, want := range map[string]time.Duration{"efs_emergency": 10 * time.Second, "log_action": time.Minute} {
+		registered, _ := registry.Get(name)
+		p, ok := registered.(*timeoutPlugin)
+		if !ok {
+			t.Fatalf("expected %s to be wrapped with a timeout, got %T", name, registered)
+		}
+		if p.timeout != want {
+			t.Errorf("expected %s timeout %v, got %v", name, want, p.timeout)
+		}
+	}
+	registered, _ := registry.Get("exec_action")
+	if _, ok := registered.(*timeoutPlugin); ok {
+		t.Error("expected an execution_timeout of 0 to disable the timeout")
+	}
+}
+
+func TestDryRunSkipsExecution(t *testing.T) {
+	leaderActive.Store(true)
+	defer leaderActive.Store(false)
+
+	dryRun := true
+	m, err := newMonitor(MonitorConfig{
+		Name:                 "dry_run_test",
+		MetricName:           "test_metric",
+		PollingInterval:      time.Second,
+		MissingValueBehavior: "zero",
+		ThresholdOperator:    "greater_than",
+		DryRun:               &dryRun,
+		Soft:                 &ThresholdSection{Threshold: 80, Duration: 5 * time.Second, BackoffDelay: time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	plugin := &chainTestPlugin{name: "dry_run_action"}
+	recovery := &chainTestPlugin{name: "dry_run_recovery"}
+	m.engine.Level("soft").Plugin = plugin
+	m.engine.Level("soft").RecoveryPlugin = recovery
+	s := &series{state: threshold.NewSeries(nil)}
+	state := s.state
+	state.Level("soft").StartTime = time.Now().Add(-10 * time.Second)
+
+	m.evaluate(context.Background(), s, 90.0)
+
+	if state.State != threshold.SoftThresholdActive {
+		t.Fatalf("expected SoftThresholdActive, got %s", state.State)
+	}
+	if state.Level("soft").BackoffUntil.IsZero() {
+		t.Error("expected the backoff to start as if the action had run")
+	}
+
+	m.evaluate(context.Background(), s, 10.0)
+
+	if state.State != threshold.NotBreached {
+		t.Fatalf("expected NotBreached after recovery, got %s", state.State)
+	}
+	if plugin.calls.Load() != 0 || recovery.calls.Load() != 0 {
+		t.Errorf("expected no plugin executions in dry-run mode, got %d and %d", plugin.calls.Load(), recovery.calls.Load())
+	}
+	if got := testutil.ToFloat64(dryRunActionsTotal.WithLabelValues("dry_run_test", "soft", "dry_run_action")); got != 1 {
+		t.Errorf("expected 1 dry-run action counted, got %v", got)
+	}
+	if got := testutil.ToFloat64(dryRunActionsTotal.WithLabelValues("dry_run_test", "soft", "dry_run_recovery")); got != 1 {
+		t.Errorf("expected 1 dry-run recovery counted, got %v", got)
+	}
+}
+
+func TestNewLevel_DryRunOverride(t *testing.T) {
+	enabled, disabled := true, false
+	for _, tt := range []struct {
+		name    string
+		monitor bool
+		section *bool
+		want    bool
+	}{
+		{"inherits monitor setting", true, nil, true},
+		{"section disables", true, &disabled, false},
+		{"section enables", false, &enabled, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			level, _, err := newLevel(&ThresholdSection{Threshold: 1, DryRun: tt.section}, "soft", threshold.GreaterThan, tt.monitor)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if level.DryRun != tt.want {
+				t.Errorf("expected dry run %v, got %v", tt.want, level.DryRun)
+			}
+		})
+	}
+}
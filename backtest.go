@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/rs/zerolog/log"
+	pluginapi "metric-reader/pkg/plugin"
+	"metric-reader/pkg/threshold"
+)
+
+// maxRangeQueryPoints is the number of points per series Prometheus returns at most for a range query
+const maxRangeQueryPoints = 11000
+
+// rangeQuerier is the part of the Prometheus v1 API a backtest needs
+type rangeQuerier interface {
+	QueryRange(ctx context.Context, query string, r v1.Range, opts ...v1.Option) (model.Value, v1.Warnings, error)
+}
+
+// queryRangeChunks runs a range query in chunks of at most maxRangeQueryPoints steps and
+// concatenates the samples of each series, so long windows at a fine step aren't rejected
+func queryRangeChunks(ctx context.Context, querier rangeQuerier, query string, r v1.Range) (model.Matrix, v1.Warnings, error) {
+	span := r.Step * (maxRangeQueryPoints - 1)
+	streams := make(map[model.Fingerprint]*model.SampleStream)
+	var matrix model.Matrix
+	var warnings v1.Warnings
+	for start := r.Start; !start.After(r.End); start = start.Add(span + r.Step) {
+		end := start.Add(span)
+		if end.After(r.End) {
+			end = r.End
+		}
+		result, chunkWarnings, err := querier.QueryRange(ctx, query, v1.Range{Start: start, End: end, Step: r.Step})
+		if err != nil {
+			return nil, nil, err
+		}
+		warnings = append(warnings, chunkWarnings...)
+		chunk, ok := result.(model.Matrix)
+		if !ok {
+			return nil, nil, fmt.Errorf("unexpected result type %s", result.Type())
+		}
+		for _, stream := range chunk {
+			fingerprint := stream.Metric.Fingerprint()
+			if existing, ok := streams[fingerprint]; ok {
+				existing.Values = append(existing.Values, stream.Values...)
+				continue
+			}
+			streams[fingerprint] = stream
+			matrix = append(matrix, stream)
+		}
+	}
+	return matrix, warnings, nil
+}
+
+// backtestOptions holds the arguments of the backtest subcommand
+type backtestOptions struct {
+	from time.Time
+	to   time.Time
+	// step between replayed samples; 0 uses the polling interval of each monitor
+	step time.Duration
+	// monitor restricts the backtest to a single monitor when set
+	monitor string
+}
+
+// parseBacktestArgs parses the backtest flags. --from and --to take an RFC3339 time or a
+// duration before now, e.g. "24h".
+func parseBacktestArgs(args []string, now time.Time) (backtestOptions, error) {
+	fs := flag.NewFlagSet("backtest", flag.ContinueOnError)
+	from := fs.String("from", "", "start of the replayed range: RFC3339 time or duration before now (required)")
+	to := fs.String("to", "", "end of the replayed range: RFC3339 time or duration before now (default now)")
+	step := fs.Duration("step", 0, "resolution of the replayed samples (default the polling interval)")
+	monitorName := fs.String("monitor", "", "only backtest the monitor with this name")
+	if err := fs.Parse(args); err != nil {
+		return backtestOptions{}, err
+	}
+
+	opts := backtestOptions{to: now, step: *step, monitor: *monitorName}
+	if *from == "" {
+		return backtestOptions{}, fmt.Errorf("--from is required")
+	}
+	var err error
+	if opts.from, err = parseBacktestTime(*from, now); err != nil {
+		return backtestOptions{}, fmt.Errorf("invalid --from value: %v", err)
+	}
+	if *to != "" {
+		if opts.to, err = parseBacktestTime(*to, now); err != nil {
+			return backtestOptions{}, fmt.Errorf("invalid --to value: %v", err)
+		}
+	}
+	if !opts.from.Before(opts.to) {
+		return backtestOptions{}, fmt.Errorf("--from must be before --to")
+	}
+	if opts.step < 0 {
+		return backtestOptions{}, fmt.Errorf("--step must not be negative")
+	}
+	// Prometheus evaluates range queries at start + k*step; whole seconds keep the sample
+	// timestamps aligned with the replayed steps
+	opts.from = opts.from.Truncate(time.Second)
+	opts.to = opts.to.Truncate(time.Second)
+	return opts, nil
+}
+
+// parseBacktestTime parses an RFC3339 time or a duration before now
+func parseBacktestTime(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC3339 time nor a duration", value)
+	}
+	return now.Add(-d), nil
+}
+
+// backtestEntry is a line of the backtest timeline
+type backtestEntry struct {
+	time    time.Time
+	monitor string
+	series  string
+	event   string
+}
+
+// backtestTimeline collects the transitions and the plugin executions of a backtest
+type backtestTimeline struct {
+	// clock is the virtual clock of the replay, set to the time of each step
+	clock       *threshold.VirtualClock
+	entries     []backtestEntry
+	transitions int
+	executions  int
+}
+
+func (t *backtestTimeline) recordTransition(m *monitor, s *threshold.Series, oldState threshold.State, newState threshold.State) {
+	t.transitions++
+	t.entries = append(t.entries, backtestEntry{
+		time:    t.clock.Now(),
+		monitor: m.name,
+		series:  s.Labels.String(),
+		event:   fmt.Sprintf("%s -> %s", oldState, newState),
+	})
+}
+
+func (t *backtestTimeline) recordExecution(plugin string, event *pluginapi.ThresholdEvent) {
+	t.executions++
+	t.entries = append(t.entries, backtestEntry{
+		time:    event.Timestamp,
+		monitor: event.Monitor,
+		series:  toMetric(event.Labels).String(),
+		event: fmt.Sprintf("would execute %s (%s, %s, attempt %d, value %g)",
+			plugin, event.Level, event.Reason, event.Attempt, event.Value),
+	})
+}
+
+// toMetric converts event labels back into a Prometheus label set
+func toMetric(labels map[string]string) model.Metric {
+	metric := make(model.Metric, len(labels))
+	for name, value := range labels {
+		metric[model.LabelName(name)] = model.LabelValue(value)
+	}
+	return metric
+}
+
+// print writes the timeline in chronological order followed by a summary
+func (t *backtestTimeline) print(w io.Writer, opts backtestOptions) error {
+	sort.SliceStable(t.entries, func(i, j int) bool { return t.entries[i].time.Before(t.entries[j].time) })
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tMONITOR\tSERIES\tEVENT")
+	for _, e := range t.entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.time.UTC().Format(time.RFC3339), e.monitor, e.series, e.event)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d transitions and %d plugin executions between %s and %s\n",
+		t.transitions, t.executions, opts.from.UTC().Format(time.RFC3339), opts.to.UTC().Format(time.RFC3339))
+	return err
+}
+
+// backtestPlugin stands in for a configured plugin during a backtest and only records its executions
+type backtestPlugin struct {
+	name     string
+	timeline *backtestTimeline
+}
+
+func (p *backtestPlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
+	p.timeline.recordExecution(p.name, event)
+	return nil
+}
+
+func (p *backtestPlugin) Name() string {
+	return p.name
+}
+
+func (p *backtestPlugin) ValidateConfig() error {
+	return nil
+}
+
+// backtest runs the backtest subcommand against the configured Prometheus endpoint
+func backtest(ctx context.Context, config *Config, monitors []*monitor, monitorConfigs []MonitorConfig, pluginNames map[string]bool, args []string) error {
+	opts, err := parseBacktestArgs(args, time.Now())
+	if err != nil {
+		return err
+	}
+
+	client, err := api.NewClient(api.Config{Address: config.PrometheusEndpoint})
+	if err != nil {
+		return fmt.Errorf("error creating prometheus client: %v", err)
+	}
+	return runBacktest(ctx, v1.NewAPI(client), monitors, monitorConfigs, pluginNames, opts, os.Stdout)
+}
+
+// runBacktest replays the history of the monitors through their state machines and writes the
+// timeline of transitions and plugin executions to w. Plugins are replaced by recorders, so
+// nothing is executed.
+func runBacktest(ctx context.Context, querier rangeQuerier, monitors []*monitor, monitorConfigs []MonitorConfig, pluginNames map[string]bool, opts backtestOptions, w io.Writer) error {
+	timeline := &backtestTimeline{clock: threshold.NewVirtualClock(opts.from)}
+	registry := pluginapi.NewRegistry()
+	for name := range pluginNames {
+		registry.Register(&backtestPlugin{name: name, timeline: timeline})
+	}
+
+	// Actions only run on the leader
+	leaderActive.Store(true)
+	defer leaderActive.Store(false)
+
+	found := false
+	for i, m := range monitors {
+		if opts.monitor != "" && m.name != opts.monitor {
+			continue
+		}
+		found = true
+
+		m.assignPlugins(registry, monitorConfigs[i])
+		if m.engine != nil {
+			// The recorders already keep plugins from running, so dry-run thresholds are recorded like the others
+			for _, level := range m.engine.Levels() {
+				level.DryRun = false
+			}
+		}
+		m.onTransition = timeline.recordTransition
+		m.useClock(timeline.clock)
+
+		if err := backtestMonitor(ctx, querier, m, opts, timeline.clock); err != nil {
+			return fmt.Errorf("monitor '%s': %v", m.name, err)
+		}
+	}
+	if !found {
+		return fmt.Errorf("monitor '%s' not found", opts.monitor)
+	}
+
+	return timeline.print(w, opts)
+}
+
+// backtestMonitor fetches the history of a monitor's query and feeds it step by step into
+// the monitor, with the virtual clock set to the time of each step
+func backtestMonitor(ctx context.Context, querier rangeQuerier, m *monitor, opts backtestOptions, clock *threshold.VirtualClock) error {
+	step := opts.step
+	if step == 0 {
+		step = m.pollingInterval
+	}
+
+	matrix, warnings, err := queryRangeChunks(ctx, querier, m.query, v1.Range{Start: opts.from, End: opts.to, Step: step})
+	if err != nil {
+		return fmt.Errorf("error querying prometheus: %v", err)
+	}
+	if len(warnings) > 0 {
+		log.Warn().
+			Strs("warnings", warnings).
+			Str("monitor", m.name).
+			Str("query", m.query).
+			Msgf("prometheus query warnings: %v", warnings)
+	}
+
+	vectors := make(map[model.Time]model.Vector)
+	for _, stream := range matrix {
+		for _, point := range stream.Values {
+			vectors[point.Timestamp] = append(vectors[point.Timestamp], &model.Sample{
+				Metric:    stream.Metric,
+				Value:     point.Value,
+				Timestamp: point.Timestamp,
+			})
+		}
+	}
+
+	// Baselines are computed from the history preceding each step, like refreshBaselines does live
+	var history model.Matrix
+	if m.engine != nil && m.baseline.enabled() {
+		start, _ := m.baseline.span(opts.from)
+		_, end := m.baseline.span(opts.to)
+		history, _, err = queryRangeChunks(ctx, querier, m.query, v1.Range{Start: start, End: end, Step: baselineStep(end.Sub(start), m.pollingInterval)})
+		if err != nil {
+			return fmt.Errorf("error querying prometheus for the baseline: %v", err)
+		}
+	}
+
+	log.Info().
+		Str("monitor", m.name).
+		Str("query", m.query).
+		Int("series", len(matrix)).
+		Dur("step", step).
+		Msg("replaying history")
+
+	for ts := opts.from; !ts.After(opts.to); ts = ts.Add(step) {
+		clock.Set(ts)
+		if history != nil && m.baselinesDue(ts) {
+			start, end := m.baseline.span(ts)
+			m.setBaselines(m.computeBaselines(history, start, end), ts)
+		}
+		m.processVector(ctx, vectors[model.TimeFromUnixNano(ts.UnixNano())], ts)
+	}
+	return nil
+}
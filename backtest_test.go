@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// fakeRangeQuerier returns a fixed matrix, or err when set, and records the requested range
+type fakeRangeQuerier struct {
+	matrix model.Matrix
+	err    error
+	r      v1.Range
+	calls  int
+}
+
+func (q *fakeRangeQuerier) QueryRange(ctx context.Context, query string, r v1.Range, opts ...v1.Option) (model.Value, v1.Warnings, error) {
+	q.r = r
+	q.calls++
+	if q.err != nil {
+		return nil, nil, q.err
+	}
+	return q.matrix, nil, nil
+}
+
+func TestParseBacktestArgs(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	opts, err := parseBacktestArgs([]string{"--from", "2h", "--step", "30s"}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !opts.from.Equal(now.Add(-2*time.Hour)) || !opts.to.Equal(now) || opts.step != 30*time.Second {
+		t.Errorf("unexpected options %+v", opts)
+	}
+
+	opts, err = parseBacktestArgs([]string{"--from", "2024-05-01T08:00:00Z", "--to", "2024-05-01T09:00:00Z"}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.from.Hour() != 8 || opts.to.Hour() != 9 || opts.step != 0 {
+		t.Errorf("unexpected options %+v", opts)
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"--from", "yesterday"},
+		{"--from", "1h", "--to", "2h"},
+		{"--from", "1h", "--step", "-1s"},
+	} {
+		if _, err := parseBacktestArgs(args, now); err == nil {
+			t.Errorf("expected error for %v", args)
+		}
+	}
+}
+
+func TestRunBacktest(t *testing.T) {
+	cfg := MonitorConfig{
+		Name:                 "disk",
+		MetricName:           "disk_usage",
+		ThresholdOperator:    "greater_than",
+		PollingInterval:      time.Minute,
+		MissingValueBehavior: "zero",
+		SeriesStaleness:      time.Hour,
+		Soft:                 &ThresholdSection{Threshold: 80, Plugin: "log_action", Duration: 2 * time.Minute, BackoffDelay: 5 * time.Minute, RecoveryPlugin: "webhook"},
+	}
+	m, err := newMonitor(cfg)
+	if err != nil {
+		t.Fatalf("failed to create monitor: %v", err)
+	}
+	pluginNames := make(map[string]bool)
+	requiredPlugins(cfg, pluginNames)
+
+	// One sample per minute: breached from minute 2 to minute 12
+	from := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	stream := &model.SampleStream{Metric: model.Metric{"instance": "a"}}
+	for i := 0; i <= 15; i++ {
+		value := 50.0
+		if i >= 2 && i <= 12 {
+			value = 90
+		}
+		stream.Values = append(stream.Values, model.SamplePair{
+			Timestamp: model.TimeFromUnixNano(from.Add(time.Duration(i) * time.Minute).UnixNano()),
+			Value:     model.SampleValue(value),
+		})
+	}
+	querier := &fakeRangeQuerier{matrix: model.Matrix{stream}}
+
+	var out bytes.Buffer
+	opts := backtestOptions{from: from, to: from.Add(15 * time.Minute)}
+	if err := runBacktest(context.Background(), querier, []*monitor{m}, []MonitorConfig{cfg}, pluginNames, opts, &out); err != nil {
+		t.Fatalf("backtest failed: %v", err)
+	}
+
+	if querier.r.Step != time.Minute {
+		t.Errorf("expected the polling interval as default step, got %v", querier.r.Step)
+	}
+	timeline := out.String()
+	for _, want := range []string{
+		"2024-05-01T08:04:00Z  disk     {instance=\"a\"}  NotBreached -> SoftThresholdActive",
+		"2024-05-01T08:04:00Z  disk     {instance=\"a\"}  would execute log_action (soft, threshold_crossed, attempt 1, value 90)",
+		"2024-05-01T08:10:00Z  disk     {instance=\"a\"}  would execute log_action (soft, backoff_expired, attempt 2, value 90)",
+		"2024-05-01T08:13:00Z  disk     {instance=\"a\"}  SoftThresholdActive -> NotBreached",
+		"2024-05-01T08:13:00Z  disk     {instance=\"a\"}  would execute webhook (soft, recovered, attempt 1, value 50)",
+		"2 transitions and 3 plugin executions",
+	} {
+		if !strings.Contains(timeline, want) {
+			t.Errorf("expected timeline to contain %q, got:\n%s", want, timeline)
+		}
+	}
+}
+
+func TestRunBacktest_UnknownMonitor(t *testing.T) {
+	m, err := newMonitor(MonitorConfig{Name: "disk", MetricName: "disk_usage", PollingInterval: time.Minute, MissingValueBehavior: "zero"})
+	if err != nil {
+		t.Fatalf("failed to create monitor: %v", err)
+	}
+	opts := backtestOptions{from: time.Now().Add(-time.Hour), to: time.Now(), monitor: "cpu"}
+	err = runBacktest(context.Background(), &fakeRangeQuerier{}, []*monitor{m}, []MonitorConfig{{}}, nil, opts, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "monitor 'cpu' not found") {
+		t.Errorf("expected unknown monitor error, got %v", err)
+	}
+}
+
+// steppingQuerier returns a sample at every step of the requested range and records the ranges
+type steppingQuerier struct {
+	ranges []v1.Range
+}
+
+func (q *steppingQuerier) QueryRange(ctx context.Context, query string, r v1.Range, opts ...v1.Option) (model.Value, v1.Warnings, error) {
+	q.ranges = append(q.ranges, r)
+	stream := &model.SampleStream{Metric: model.Metric{"instance": "a"}}
+	for ts := r.Start; !ts.After(r.End); ts = ts.Add(r.Step) {
+		stream.Values = append(stream.Values, model.SamplePair{Timestamp: model.TimeFromUnixNano(ts.UnixNano()), Value: 1})
+	}
+	return model.Matrix{stream}, nil, nil
+}
+
+func TestQueryRangeChunks(t *testing.T) {
+	querier := &steppingQuerier{}
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	// 25,000 points at a 15s step need three queries
+	r := v1.Range{Start: start, End: start.Add(24999 * 15 * time.Second), Step: 15 * time.Second}
+
+	matrix, _, err := queryRangeChunks(context.Background(), querier, "up", r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(querier.ranges) != 3 {
+		t.Fatalf("expected 3 queries, got %d", len(querier.ranges))
+	}
+	for _, chunk := range querier.ranges {
+		if points := int(chunk.End.Sub(chunk.Start)/chunk.Step) + 1; points > maxRangeQueryPoints {
+			t.Errorf("expected at most %d points per query, got %d", maxRangeQueryPoints, points)
+		}
+	}
+	if len(matrix) != 1 {
+		t.Fatalf("expected the chunks of the series to be concatenated, got %d series", len(matrix))
+	}
+	values := matrix[0].Values
+	if len(values) != 25000 {
+		t.Fatalf("expected 25000 samples, got %d", len(values))
+	}
+	for i := 1; i < len(values); i++ {
+		if values[i].Timestamp-values[i-1].Timestamp != model.Time(15000) {
+			t.Fatalf("expected consecutive samples 15s apart, got %v and %v", values[i-1].Timestamp, values[i].Timestamp)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"metric-reader/pkg/threshold"
+)
+
+const (
+	// defaultBaselineRefresh is how often baselines are recomputed when baseline_refresh isn't set
+	defaultBaselineRefresh = 5 * time.Minute
+	// maxBaselinePoints bounds the samples fetched per series, below the 11000 points
+	// Prometheus returns at most per series
+	maxBaselinePoints = 10000
+	// minBaselineSamples is the number of samples a series needs in the window to get a baseline
+	minBaselineSamples = 2
+	// baselineMinStdDevFraction is the smallest standard deviation of a baseline, relative to the
+	// magnitude of its mean, when baseline_min_stddev isn't set
+	baselineMinStdDevFraction = 0.01
+	// baselineRetryInterval is how long a failed baseline query waits before it is retried,
+	// unless baseline_refresh is shorter
+	baselineRetryInterval = time.Minute
+)
+
+// baselineSettings configure the baseline thresholds of a monitor
+type baselineSettings struct {
+	// window is the history the baselines are computed from; 0 disables baseline thresholds
+	window time.Duration
+	// offset moves the window into the past, e.g. one week to compare with the same hour last week
+	offset time.Duration
+	// refresh is how often the baselines are recomputed
+	refresh time.Duration
+	// minStdDev is the smallest standard deviation a baseline is applied with; 0 uses
+	// baselineMinStdDevFraction of the baseline's mean
+	minStdDev float64
+}
+
+func newBaselineSettings(cfg MonitorConfig) (baselineSettings, error) {
+	settings := baselineSettings{window: cfg.BaselineWindow, offset: cfg.BaselineOffset, refresh: cfg.BaselineRefresh, minStdDev: cfg.BaselineMinStdDev}
+	if settings.window < 0 || settings.offset < 0 || settings.refresh < 0 || settings.minStdDev < 0 {
+		return baselineSettings{}, fmt.Errorf("baseline window, offset, refresh and minimum stddev must not be negative")
+	}
+	if settings.window == 0 {
+		if settings.offset != 0 || settings.refresh != 0 || settings.minStdDev != 0 {
+			return baselineSettings{}, fmt.Errorf("BASELINE_OFFSET, BASELINE_REFRESH and BASELINE_MIN_STDDEV require BASELINE_WINDOW")
+		}
+		return settings, nil
+	}
+	if settings.refresh == 0 {
+		settings.refresh = defaultBaselineRefresh
+	}
+	return settings, nil
+}
+
+// enabled reports whether the thresholds are relative to a baseline
+func (b baselineSettings) enabled() bool {
+	return b.window > 0
+}
+
+// span returns the range the baselines computed at now are computed from
+func (b baselineSettings) span(now time.Time) (start time.Time, end time.Time) {
+	end = now.Add(-b.offset)
+	return end.Add(-b.window), end
+}
+
+// baselineStep returns the resolution of a range query fetching span of baseline history:
+// the polling interval, coarsened so that span doesn't exceed maxBaselinePoints
+func baselineStep(span time.Duration, pollingInterval time.Duration) time.Duration {
+	step := pollingInterval
+	if minStep := (span / maxBaselinePoints).Truncate(time.Second) + time.Second; step < minStep {
+		step = minStep
+	}
+	return step
+}
+
+// computeBaselines returns the baseline of every series of matrix with enough samples in (start, end].
+// The standard deviation is raised to the minimum, so a series that didn't vary doesn't get all
+// its thresholds on its mean; a series whose minimum is 0 as well gets no baseline.
+func (m *monitor) computeBaselines(matrix model.Matrix, start time.Time, end time.Time) map[model.Fingerprint]*threshold.Baseline {
+	from, to := model.TimeFromUnixNano(start.UnixNano()), model.TimeFromUnixNano(end.UnixNano())
+	baselines := make(map[model.Fingerprint]*threshold.Baseline, len(matrix))
+	for _, stream := range matrix {
+		var values []float64
+		for _, point := range stream.Values {
+			if point.Timestamp > from && point.Timestamp <= to {
+				values = append(values, float64(point.Value))
+			}
+		}
+		if len(values) < minBaselineSamples {
+			continue
+		}
+		baseline := threshold.NewBaseline(values)
+		minStdDev := m.baseline.minStdDev
+		if minStdDev == 0 {
+			minStdDev = baselineMinStdDevFraction * math.Abs(baseline.Mean)
+		}
+		if baseline.StdDev < minStdDev {
+			baseline.StdDev = minStdDev
+		}
+		if baseline.StdDev == 0 {
+			m.logger.Warn().
+				Str("series", stream.Metric.String()).
+				Float64("mean", baseline.Mean).
+				Msg("baseline history has no variation and a mean of 0, not evaluating the series; set baseline_min_stddev to evaluate it")
+			continue
+		}
+		baselines[stream.Metric.Fingerprint()] = &baseline
+	}
+	return baselines
+}
+
+// baselinesDue reports whether the baselines of the monitor must be recomputed at now
+func (m *monitor) baselinesDue(now time.Time) bool {
+	if m.engine == nil || !m.baseline.enabled() {
+		return false
+	}
+	if !m.baselinesFailedAt.IsZero() && now.Sub(m.baselinesFailedAt) < min(m.baseline.refresh, baselineRetryInterval) {
+		return false
+	}
+	return m.baselinesUpdatedAt.IsZero() || now.Sub(m.baselinesUpdatedAt) >= m.baseline.refresh
+}
+
+// refreshBaselines recomputes the baselines of the monitor's series from the history of its
+// query when they are due. On failure the previous baselines are kept and the query is retried
+// after baselineRetryInterval, or after baseline_refresh when it is shorter.
+func (m *monitor) refreshBaselines(ctx context.Context, querier rangeQuerier, now time.Time) {
+	if !m.baselinesDue(now) {
+		return
+	}
+
+	start, end := m.baseline.span(now)
+	queryCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	result, warnings, err := querier.QueryRange(queryCtx, m.query, v1.Range{Start: start, End: end, Step: baselineStep(m.baseline.window, m.pollingInterval)})
+	cancel()
+	if err != nil {
+		prometheusQueryErrorsTotal.WithLabelValues(m.name).Inc()
+		m.logger.Error().
+			Err(err).
+			Str("query", m.query).
+			Msgf("error querying prometheus for the baseline: %v", err)
+		m.baselinesFailed(now)
+		return
+	}
+	if len(warnings) > 0 {
+		m.logger.Warn().
+			Strs("warnings", warnings).
+			Str("query", m.query).
+			Msgf("prometheus baseline query warnings: %v", warnings)
+	}
+	matrix, ok := result.(model.Matrix)
+	if !ok {
+		m.logger.Error().
+			Str("query", m.query).
+			Str("result_type", result.Type().String()).
+			Msg("unexpected baseline result type")
+		m.baselinesFailed(now)
+		return
+	}
+
+	m.setBaselines(m.computeBaselines(matrix, start, end), now)
+}
+
+// setBaselines replaces the baselines of the monitor's series; series are given their
+// baseline when they are next evaluated
+func (m *monitor) setBaselines(baselines map[model.Fingerprint]*threshold.Baseline, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.baselines = baselines
+	m.baselinesUpdatedAt = now
+	m.baselinesFailedAt = time.Time{}
+
+	m.logger.Debug().
+		Int("series", len(baselines)).
+		Dur("baseline_window", m.baseline.window).
+		Dur("baseline_offset", m.baseline.offset).
+		Msg("updated baselines")
+}
+
+// baselinesFailed records a failed baseline refresh so that it is not retried on every poll
+func (m *monitor) baselinesFailed(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.baselinesFailedAt = now
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/rs/zerolog"
+	"metric-reader/pkg/threshold"
+)
+
+func TestNewBaselineSettings(t *testing.T) {
+	settings, err := newBaselineSettings(MonitorConfig{BaselineWindow: time.Hour})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !settings.enabled() || settings.refresh != defaultBaselineRefresh {
+		t.Errorf("Expected enabled settings with the default refresh, got %+v", settings)
+	}
+
+	settings, err = newBaselineSettings(MonitorConfig{})
+	if err != nil || settings.enabled() {
+		t.Errorf("Expected disabled settings, got %+v and %v", settings, err)
+	}
+
+	for _, cfg := range []MonitorConfig{
+		{BaselineWindow: -time.Hour},
+		{BaselineOffset: 168 * time.Hour},
+		{BaselineRefresh: time.Minute},
+		{BaselineMinStdDev: 1},
+		{BaselineWindow: time.Hour, BaselineMinStdDev: -1},
+	} {
+		if _, err := newBaselineSettings(cfg); err == nil {
+			t.Errorf("Expected an error for %+v", cfg)
+		}
+	}
+}
+
+func TestBaselineStep(t *testing.T) {
+	if step := baselineStep(time.Hour, time.Minute); step != time.Minute {
+		t.Errorf("Expected the polling interval, got %v", step)
+	}
+	if step := baselineStep(30*24*time.Hour, 15*time.Second); step*maxBaselinePoints < 30*24*time.Hour {
+		t.Errorf("Expected a step keeping 30 days below %d points, got %v", maxBaselinePoints, step)
+	}
+}
+
+func TestComputeBaselines(t *testing.T) {
+	end := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	start := end.Add(-time.Hour)
+	at := func(d time.Duration) model.Time { return model.TimeFromUnixNano(start.Add(d).UnixNano()) }
+
+	matrix := model.Matrix{
+		{
+			Metric: model.Metric{"instance": "a"},
+			Values: []model.SamplePair{
+				{Timestamp: at(0), Value: 1000}, // Outside of the window
+				{Timestamp: at(10 * time.Minute), Value: 90},
+				{Timestamp: at(20 * time.Minute), Value: 110},
+				{Timestamp: at(2 * time.Hour), Value: 1000}, // Outside of the window
+			},
+		},
+		{
+			Metric: model.Metric{"instance": "b"},
+			Values: []model.SamplePair{{Timestamp: at(30 * time.Minute), Value: 5}},
+		},
+	}
+
+	m := &monitor{logger: zerolog.Nop()}
+	baselines := m.computeBaselines(matrix, start, end)
+	a := baselines[model.Metric{"instance": "a"}.Fingerprint()]
+	if a == nil || a.Mean != 100 || a.StdDev != 10 || a.Samples != 2 {
+		t.Errorf("Expected mean 100 and stddev 10 from 2 samples, got %+v", a)
+	}
+	if _, ok := baselines[model.Metric{"instance": "b"}.Fingerprint()]; ok {
+		t.Error("Expected no baseline for a series with a single sample")
+	}
+}
+
+// TestComputeBaselines_MinStdDev tests that a series without variation gets a minimum standard
+// deviation instead of thresholds all equal to its mean
+func TestComputeBaselines_MinStdDev(t *testing.T) {
+	end := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	start := end.Add(-time.Hour)
+	at := func(d time.Duration) model.Time { return model.TimeFromUnixNano(start.Add(d).UnixNano()) }
+	constant := func(instance string, value model.SampleValue) *model.SampleStream {
+		return &model.SampleStream{
+			Metric: model.Metric{"instance": model.LabelValue(instance)},
+			Values: []model.SamplePair{{Timestamp: at(10 * time.Minute), Value: value}, {Timestamp: at(20 * time.Minute), Value: value}},
+		}
+	}
+	matrix := model.Matrix{constant("flat", 200), constant("negative", -50), constant("zero", 0)}
+
+	m := &monitor{logger: zerolog.Nop()}
+	baselines := m.computeBaselines(matrix, start, end)
+	for instance, want := range map[string]float64{"flat": 2, "negative": 0.5} {
+		b := baselines[model.Metric{"instance": model.LabelValue(instance)}.Fingerprint()]
+		if b == nil || b.StdDev != want {
+			t.Errorf("Expected %s to get a stddev of 1%% of its mean (%v), got %+v", instance, want, b)
+		}
+	}
+	if _, ok := baselines[model.Metric{"instance": "zero"}.Fingerprint()]; ok {
+		t.Error("Expected no baseline for a series without variation and a mean of 0")
+	}
+
+	// A configured minimum replaces the default and also applies to series around 0
+	m.baseline.minStdDev = 5
+	baselines = m.computeBaselines(matrix, start, end)
+	for _, instance := range []string{"flat", "negative", "zero"} {
+		b := baselines[model.Metric{"instance": model.LabelValue(instance)}.Fingerprint()]
+		if b == nil || b.StdDev != 5 {
+			t.Errorf("Expected %s to get the configured stddev of 5, got %+v", instance, b)
+		}
+	}
+
+	// The thresholds no longer collapse onto the mean: 2 standard deviations above 200
+	applied := baselines[model.Metric{"instance": "flat"}.Fingerprint()].Apply(&threshold.Level{Name: "soft", Value: 2})
+	if applied.Value != 210 {
+		t.Errorf("Expected a threshold of 210, got %v", applied.Value)
+	}
+}
+
+func TestRefreshBaselines(t *testing.T) {
+	m, err := newMonitor(MonitorConfig{
+		Name:                 "requests",
+		MetricName:           "http_requests_rate",
+		ThresholdOperator:    "greater_than",
+		Soft:                 &ThresholdSection{Threshold: 2},
+		BaselineWindow:       time.Hour,
+		BaselineOffset:       168 * time.Hour,
+		PollingInterval:      time.Minute,
+		MissingValueBehavior: "zero",
+	})
+	if err != nil {
+		t.Fatalf("Expected valid monitor, got error: %v", err)
+	}
+
+	now := time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC)
+	lastWeek := model.TimeFromUnixNano(now.Add(-168*time.Hour - 30*time.Minute).UnixNano())
+	querier := &fakeRangeQuerier{matrix: model.Matrix{{
+		Metric: model.Metric{"instance": "a"},
+		Values: []model.SamplePair{{Timestamp: lastWeek, Value: 90}, {Timestamp: lastWeek + 60000, Value: 110}},
+	}}}
+
+	m.refreshBaselines(context.Background(), querier, now)
+	if !querier.r.End.Equal(now.Add(-168*time.Hour)) || !querier.r.Start.Equal(now.Add(-169*time.Hour)) {
+		t.Errorf("Expected the hour ending a week ago, got %v to %v", querier.r.Start, querier.r.End)
+	}
+
+	// 125 is past mean + 2 standard deviations; the series without history isn't evaluated
+	vector := model.Vector{
+		{Metric: model.Metric{"instance": "a"}, Value: 125},
+		{Metric: model.Metric{"instance": "b"}, Value: 125},
+	}
+	m.processVector(context.Background(), vector, now)
+	m.processVector(context.Background(), vector, now)
+
+	a := m.series[model.Metric{"instance": "a"}.Fingerprint()]
+	if a.state.State != threshold.SoftThresholdActive || a.state.Baseline == nil || a.state.Baseline.Mean != 100 {
+		t.Errorf("Expected SoftThresholdActive against the baseline, got %s with %+v", a.state.State, a.state.Baseline)
+	}
+	if b := m.series[model.Metric{"instance": "b"}.Fingerprint()]; b.state.State != threshold.NotBreached {
+		t.Errorf("Expected the series without baseline to stay NotBreached, got %s", b.state.State)
+	}
+
+	// Baselines are only recomputed after the refresh interval
+	querier.r.End = time.Time{}
+	m.refreshBaselines(context.Background(), querier, now.Add(time.Minute))
+	if !querier.r.End.IsZero() {
+		t.Error("Expected no baseline query before the refresh interval")
+	}
+	m.refreshBaselines(context.Background(), querier, now.Add(defaultBaselineRefresh))
+	if querier.r.End.IsZero() {
+		t.Error("Expected a baseline query after the refresh interval")
+	}
+}
+
+func TestRefreshBaselines_RetryAfterError(t *testing.T) {
+	m, err := newMonitor(MonitorConfig{
+		Name:                 "requests",
+		MetricName:           "http_requests_rate",
+		ThresholdOperator:    "greater_than",
+		Soft:                 &ThresholdSection{Threshold: 2},
+		BaselineWindow:       time.Hour,
+		PollingInterval:      10 * time.Second,
+		MissingValueBehavior: "zero",
+	})
+	if err != nil {
+		t.Fatalf("Expected valid monitor, got error: %v", err)
+	}
+
+	now := time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC)
+	querier := &fakeRangeQuerier{err: errors.New("prometheus unavailable")}
+	for poll := time.Duration(0); poll < baselineRetryInterval; poll += 10 * time.Second {
+		m.refreshBaselines(context.Background(), querier, now.Add(poll))
+	}
+	if querier.calls != 1 {
+		t.Errorf("Expected a single baseline query before the retry interval, got %d", querier.calls)
+	}
+
+	// The query is retried after the retry interval and succeeds
+	querier.err = nil
+	m.refreshBaselines(context.Background(), querier, now.Add(baselineRetryInterval))
+	if querier.calls != 2 {
+		t.Errorf("Expected the baseline query to be retried after %v, got %d queries", baselineRetryInterval, querier.calls)
+	}
+	m.refreshBaselines(context.Background(), querier, now.Add(baselineRetryInterval+10*time.Second))
+	if querier.calls != 2 {
+		t.Errorf("Expected no baseline query after a successful refresh, got %d queries", querier.calls)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// conditionType decides which value of the query is compared against the thresholds
+type conditionType string
+
+const (
+	// conditionValue compares the value returned by the query
+	conditionValue conditionType = "value"
+	// conditionDeriv compares the slope of the query over the condition window, per condition unit
+	conditionDeriv conditionType = "deriv"
+	// conditionPredictLinear compares the value the query is predicted to reach after the
+	// condition horizon, extrapolated from the condition window
+	conditionPredictLinear conditionType = "predict_linear"
+)
+
+func parseConditionType(conditionStr string) (conditionType, error) {
+	switch conditionStr {
+	case "", string(conditionValue):
+		return conditionValue, nil
+	case string(conditionDeriv):
+		return conditionDeriv, nil
+	case string(conditionPredictLinear):
+		return conditionPredictLinear, nil
+	default:
+		return "", fmt.Errorf("condition must be 'value', 'deriv' or 'predict_linear'")
+	}
+}
+
+// conditionQuery wraps query so that it returns the value compared by the monitor's condition.
+// Trend conditions evaluate the query as a subquery over the condition window, so Prometheus
+// computes them from its own history and no samples are kept between polls.
+func conditionQuery(query string, cfg MonitorConfig) (string, error) {
+	condition, err := parseConditionType(cfg.Condition)
+	if err != nil {
+		return "", fmt.Errorf("invalid CONDITION value %q: %v", cfg.Condition, err)
+	}
+	if cfg.ConditionWindow < 0 || cfg.ConditionHorizon < 0 || cfg.ConditionUnit < 0 {
+		return "", fmt.Errorf("condition window, horizon and unit must not be negative")
+	}
+
+	switch condition {
+	case conditionDeriv:
+		if cfg.ConditionWindow == 0 {
+			return "", fmt.Errorf("the deriv condition requires CONDITION_WINDOW")
+		}
+		if cfg.ConditionHorizon != 0 {
+			return "", fmt.Errorf("CONDITION_HORIZON is only supported by the predict_linear condition")
+		}
+		query = fmt.Sprintf("deriv((%s)[%s:])", query, model.Duration(cfg.ConditionWindow))
+		if cfg.ConditionUnit != 0 && cfg.ConditionUnit != time.Second {
+			query = fmt.Sprintf("%s * %s", query, formatSeconds(cfg.ConditionUnit))
+		}
+		return query, nil
+	case conditionPredictLinear:
+		if cfg.ConditionWindow == 0 || cfg.ConditionHorizon == 0 {
+			return "", fmt.Errorf("the predict_linear condition requires CONDITION_WINDOW and CONDITION_HORIZON")
+		}
+		if cfg.ConditionUnit != 0 {
+			return "", fmt.Errorf("CONDITION_UNIT is only supported by the deriv condition")
+		}
+		return fmt.Sprintf("predict_linear((%s)[%s:], %s)", query, model.Duration(cfg.ConditionWindow), formatSeconds(cfg.ConditionHorizon)), nil
+	default:
+		if cfg.ConditionWindow != 0 || cfg.ConditionHorizon != 0 || cfg.ConditionUnit != 0 {
+			return "", fmt.Errorf("CONDITION_WINDOW, CONDITION_HORIZON and CONDITION_UNIT require the deriv or predict_linear condition")
+		}
+		return query, nil
+	}
+}
+
+// formatSeconds formats d as a number of seconds for PromQL
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
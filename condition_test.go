@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConditionQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      MonitorConfig
+		expected string
+	}{
+		{
+			name:     "value",
+			cfg:      MonitorConfig{},
+			expected: "aws_efs_burst_credit_balance",
+		},
+		{
+			name:     "deriv per second",
+			cfg:      MonitorConfig{Condition: "deriv", ConditionWindow: 15 * time.Minute},
+			expected: "deriv((aws_efs_burst_credit_balance)[15m:])",
+		},
+		{
+			name:     "deriv per minute",
+			cfg:      MonitorConfig{Condition: "deriv", ConditionWindow: 15 * time.Minute, ConditionUnit: time.Minute},
+			expected: "deriv((aws_efs_burst_credit_balance)[15m:]) * 60",
+		},
+		{
+			name:     "predict_linear",
+			cfg:      MonitorConfig{Condition: "predict_linear", ConditionWindow: time.Hour, ConditionHorizon: 2 * time.Hour},
+			expected: "predict_linear((aws_efs_burst_credit_balance)[1h:], 7200)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := conditionQuery("aws_efs_burst_credit_balance", tt.cfg)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if query != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, query)
+			}
+			if err := validateQuery(query); err != nil {
+				t.Errorf("Expected a valid query, got %v", err)
+			}
+		})
+	}
+}
+
+func TestConditionQuery_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  MonitorConfig
+	}{
+		{name: "unknown condition", cfg: MonitorConfig{Condition: "slope"}},
+		{name: "deriv without window", cfg: MonitorConfig{Condition: "deriv"}},
+		{name: "deriv with horizon", cfg: MonitorConfig{Condition: "deriv", ConditionWindow: time.Minute, ConditionHorizon: time.Hour}},
+		{name: "predict_linear without horizon", cfg: MonitorConfig{Condition: "predict_linear", ConditionWindow: time.Hour}},
+		{name: "predict_linear with unit", cfg: MonitorConfig{Condition: "predict_linear", ConditionWindow: time.Hour, ConditionHorizon: time.Hour, ConditionUnit: time.Minute}},
+		{name: "window without condition", cfg: MonitorConfig{ConditionWindow: time.Hour}},
+		{name: "negative window", cfg: MonitorConfig{Condition: "deriv", ConditionWindow: -time.Minute}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := conditionQuery("up", tt.cfg); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
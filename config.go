@@ -1,8 +1,10 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -23,14 +25,193 @@ type PluginConfig struct {
 		FileSystemPrometheusLabel string `mapstructure:"file_system_prometheus_label"`
 		AWSRegion                 string `mapstructure:"aws_region"`
 	} `mapstructure:"efs_emergency"`
+
+	// Webhook Plugin configuration
+	Webhook struct {
+		URL          string            `mapstructure:"url"`
+		Method       string            `mapstructure:"method"`
+		Headers      map[string]string `mapstructure:"headers"`
+		BodyTemplate string            `mapstructure:"body_template"`
+		Timeout      time.Duration     `mapstructure:"timeout"`
+		Retries      int               `mapstructure:"retries"`
+		RetryBackoff time.Duration     `mapstructure:"retry_backoff"`
+		HMACSecret   string            `mapstructure:"hmac_secret"`
+		HMACHeader   string            `mapstructure:"hmac_header"`
+	} `mapstructure:"webhook"`
+
+	// Alertmanager Plugin configuration
+	Alertmanager struct {
+		URL          string            `mapstructure:"url"`
+		AlertName    string            `mapstructure:"alert_name"`
+		Labels       map[string]string `mapstructure:"labels"`
+		Annotations  map[string]string `mapstructure:"annotations"`
+		GeneratorURL string            `mapstructure:"generator_url"`
+		Timeout      time.Duration     `mapstructure:"timeout"`
+		// ResendInterval is how often firing alerts are re-sent until they are resolved
+		ResendInterval time.Duration `mapstructure:"resend_interval"`
+	} `mapstructure:"alertmanager"`
+
+	// Exec Action Plugin configuration
+	ExecAction struct {
+		Command    string        `mapstructure:"command"`
+		Args       []string      `mapstructure:"args"`
+		WorkingDir string        `mapstructure:"working_dir"`
+		Timeout    time.Duration `mapstructure:"timeout"`
+		AllowedEnv []string      `mapstructure:"allowed_env"`
+	} `mapstructure:"exec_action"`
+
+	// Kubernetes Scale Plugin configuration
+	K8sScale struct {
+		Kind        string `mapstructure:"kind"`
+		Name        string `mapstructure:"name"`
+		Namespace   string `mapstructure:"namespace"`
+		Replicas    int32  `mapstructure:"replicas"`
+		Step        int32  `mapstructure:"step"`
+		MinReplicas int32  `mapstructure:"min_replicas"`
+		MaxReplicas int32  `mapstructure:"max_replicas"`
+	} `mapstructure:"k8s_scale"`
+}
+
+// pluginEnvBindings maps plugin configuration keys to the environment variables the plugins read.
+// Plugins only see their environment, so configured values are exported before plugins are loaded.
+var pluginEnvBindings = []struct {
+	key string
+	env string
+}{
+	{"plugins.file_action.dir", "FILE_ACTION_DIR"},
+	{"plugins.file_action.size", "FILE_ACTION_SIZE"},
+	{"plugins.efs_emergency.file_system_id", "EFS_FILE_SYSTEM_ID"},
+	{"plugins.efs_emergency.file_system_prometheus_label", "EFS_FILE_SYSTEM_PROMETHEUS_LABEL"},
+	{"plugins.efs_emergency.aws_region", "AWS_REGION"},
+	{"plugins.webhook.url", "WEBHOOK_URL"},
+	{"plugins.webhook.method", "WEBHOOK_METHOD"},
+	{"plugins.webhook.headers", "WEBHOOK_HEADERS"},
+	{"plugins.webhook.body_template", "WEBHOOK_BODY_TEMPLATE"},
+	{"plugins.webhook.timeout", "WEBHOOK_TIMEOUT"},
+	{"plugins.webhook.retries", "WEBHOOK_RETRIES"},
+	{"plugins.webhook.retry_backoff", "WEBHOOK_RETRY_BACKOFF"},
+	{"plugins.webhook.hmac_secret", "WEBHOOK_HMAC_SECRET"},
+	{"plugins.webhook.hmac_header", "WEBHOOK_HMAC_HEADER"},
+	{"plugins.alertmanager.url", "ALERTMANAGER_URL"},
+	{"plugins.alertmanager.alert_name", "ALERTMANAGER_ALERT_NAME"},
+	{"plugins.alertmanager.labels", "ALERTMANAGER_LABELS"},
+	{"plugins.alertmanager.annotations", "ALERTMANAGER_ANNOTATIONS"},
+	{"plugins.alertmanager.generator_url", "ALERTMANAGER_GENERATOR_URL"},
+	{"plugins.alertmanager.timeout", "ALERTMANAGER_TIMEOUT"},
+	{"plugins.alertmanager.resend_interval", "ALERTMANAGER_RESEND_INTERVAL"},
+	{"plugins.exec_action.command", "EXEC_ACTION_COMMAND"},
+	{"plugins.exec_action.args", "EXEC_ACTION_ARGS"},
+	{"plugins.exec_action.working_dir", "EXEC_ACTION_WORKING_DIR"},
+	{"plugins.exec_action.timeout", "EXEC_ACTION_TIMEOUT"},
+	{"plugins.exec_action.allowed_env", "EXEC_ACTION_ALLOWED_ENV"},
+	{"plugins.k8s_scale.kind", "K8S_SCALE_KIND"},
+	{"plugins.k8s_scale.name", "K8S_SCALE_NAME"},
+	{"plugins.k8s_scale.namespace", "K8S_SCALE_NAMESPACE"},
+	{"plugins.k8s_scale.replicas", "K8S_SCALE_REPLICAS"},
+	{"plugins.k8s_scale.step", "K8S_SCALE_STEP"},
+	{"plugins.k8s_scale.min_replicas", "K8S_SCALE_MIN_REPLICAS"},
+	{"plugins.k8s_scale.max_replicas", "K8S_SCALE_MAX_REPLICAS"},
+}
+
+// RetryConfig configures the retries of failed plugin executions
+type RetryConfig struct {
+	// MaxRetries is the number of retries after the first attempt; 0 disables retries
+	MaxRetries      int           `mapstructure:"max_retries"`
+	InitialInterval time.Duration `mapstructure:"initial_interval"`
+	MaxInterval     time.Duration `mapstructure:"max_interval"`
+	Multiplier      float64       `mapstructure:"multiplier"`
+	// Jitter randomizes each interval by up to ±Jitter (0.2 = ±20%)
+	Jitter float64 `mapstructure:"jitter"`
+	// MaxElapsedTime bounds the time spent on an execution including retries; 0 means unbounded
+	MaxElapsedTime time.Duration `mapstructure:"max_elapsed_time"`
 }
 
-// ThresholdSection holds configuration for a single threshold (soft or hard)
+// ThresholdSection holds configuration for a single threshold: soft, hard or an entry of [[levels]]
 type ThresholdSection struct {
-	Threshold    float64       `mapstructure:"threshold"`
+	Threshold float64 `mapstructure:"threshold"`
+	// Lower and Upper bound the range of the outside_range and inside_range operators,
+	// which require both and ignore Threshold
+	Lower        *float64      `mapstructure:"lower"`
+	Upper        *float64      `mapstructure:"upper"`
 	Plugin       string        `mapstructure:"plugin"`
 	Duration     time.Duration `mapstructure:"duration"`
 	BackoffDelay time.Duration `mapstructure:"backoff_delay"`
+	// RecoveryPlugin runs when the series leaves this threshold's active state
+	RecoveryPlugin string `mapstructure:"recovery_plugin"`
+	// Plugins chains several plugins; Plugin, when also set, runs first
+	Plugins []string `mapstructure:"plugins"`
+	// Execution runs the chained plugins "sequential" (default) or "parallel"
+	Execution string `mapstructure:"execution"`
+	// FailurePolicy decides which plugins run after a failure and when the backoff starts:
+	// "stop_on_error" (default), "continue" or "all_must_succeed"
+	FailurePolicy string `mapstructure:"failure_policy"`
+	// DryRun overrides the monitor's dry-run setting for this threshold when set
+	DryRun *bool `mapstructure:"dry_run"`
+	// ClearThreshold is the value the metric must be back past before the active state is
+	// left; defaults to Threshold. Hysteresis sets it as a band from Threshold instead.
+	ClearThreshold *float64 `mapstructure:"clear_threshold"`
+	Hysteresis     float64  `mapstructure:"hysteresis"`
+	// ClearDuration is how long the metric must stay past the clear threshold before the
+	// active state is left
+	ClearDuration time.Duration `mapstructure:"clear_duration"`
+}
+
+// PluginNames returns the plugins to run when the threshold fires, in order
+func (s *ThresholdSection) PluginNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range append([]string{s.Plugin}, s.Plugins...) {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// LevelSection holds configuration for a single entry of [[levels]]
+type LevelSection struct {
+	// Name identifies the level in events, logs and metrics; its state is <Name>ThresholdActive
+	Name             string `mapstructure:"name"`
+	ThresholdSection `mapstructure:",squash"`
+}
+
+// MonitorConfig holds configuration for a single monitored metric.
+// Each monitor runs its own polling loop and threshold state machine.
+type MonitorConfig struct {
+	Name                 string            `mapstructure:"name"`
+	Query                string            `mapstructure:"query"`
+	MetricName           string            `mapstructure:"metric_name"`
+	LabelFilters         string            `mapstructure:"label_filters"`
+	ThresholdOperator    string            `mapstructure:"threshold_operator"`
+	Soft                 *ThresholdSection `mapstructure:"soft"`
+	Hard                 *ThresholdSection `mapstructure:"hard"`
+	PollingInterval      time.Duration     `mapstructure:"polling_interval"`
+	MissingValueBehavior string            `mapstructure:"missing_value_behavior"`
+	SeriesStaleness      time.Duration     `mapstructure:"series_staleness"`
+	// DryRun overrides the top-level dry_run setting for this monitor when set
+	DryRun *bool `mapstructure:"dry_run"`
+	// Levels replaces Soft and Hard with any number of levels, from the least to the most severe
+	Levels []LevelSection `mapstructure:"levels"`
+	// Condition compares the thresholds against the query value ("value", default), its
+	// derivative over ConditionWindow ("deriv") or its value predicted ConditionHorizon
+	// ahead from ConditionWindow ("predict_linear")
+	Condition        string        `mapstructure:"condition"`
+	ConditionWindow  time.Duration `mapstructure:"condition_window"`
+	ConditionHorizon time.Duration `mapstructure:"condition_horizon"`
+	// ConditionUnit is the time unit of the deriv condition's slope; per second when not set
+	ConditionUnit time.Duration `mapstructure:"condition_unit"`
+	// BaselineWindow makes the thresholds numbers of standard deviations from the mean of
+	// each series over this window, moved BaselineOffset into the past and recomputed every
+	// BaselineRefresh
+	BaselineWindow  time.Duration `mapstructure:"baseline_window"`
+	BaselineOffset  time.Duration `mapstructure:"baseline_offset"`
+	BaselineRefresh time.Duration `mapstructure:"baseline_refresh"`
+	// BaselineMinStdDev is the smallest standard deviation a baseline is applied with, so a series
+	// without variation doesn't collapse every threshold onto its mean; 1% of the mean's
+	// magnitude when not set
+	BaselineMinStdDev float64 `mapstructure:"baseline_min_stddev"`
 }
 
 // Config holds all configuration for the application
@@ -39,6 +220,8 @@ type Config struct {
 	LogLevel string `mapstructure:"log_level"`
 
 	// Metric configuration
+	// Query is a full PromQL expression and replaces MetricName/LabelFilters when set
+	Query        string `mapstructure:"query"`
 	MetricName   string `mapstructure:"metric_name"`
 	LabelFilters string `mapstructure:"label_filters"`
 
@@ -46,6 +229,20 @@ type Config struct {
 	ThresholdOperator string            `mapstructure:"threshold_operator"`
 	Soft              *ThresholdSection `mapstructure:"soft"`
 	Hard              *ThresholdSection `mapstructure:"hard"`
+	// Levels replaces Soft and Hard with any number of levels, from the least to the most severe
+	Levels []LevelSection `mapstructure:"levels"`
+
+	// Trend condition configuration, see MonitorConfig.Condition
+	Condition        string        `mapstructure:"condition"`
+	ConditionWindow  time.Duration `mapstructure:"condition_window"`
+	ConditionHorizon time.Duration `mapstructure:"condition_horizon"`
+	ConditionUnit    time.Duration `mapstructure:"condition_unit"`
+
+	// Baseline threshold configuration, see MonitorConfig.BaselineWindow
+	BaselineWindow    time.Duration `mapstructure:"baseline_window"`
+	BaselineOffset    time.Duration `mapstructure:"baseline_offset"`
+	BaselineRefresh   time.Duration `mapstructure:"baseline_refresh"`
+	BaselineMinStdDev float64       `mapstructure:"baseline_min_stddev"`
 
 	// Polling configuration
 	PollingInterval time.Duration `mapstructure:"polling_interval"`
@@ -56,16 +253,134 @@ type Config struct {
 	// Plugin configuration
 	PluginDir string `mapstructure:"plugin_dir"`
 
+	// HTTP server configuration (health, readiness and state endpoints)
+	HTTPListenAddress string `mapstructure:"http_listen_address"`
+
 	// Leader election configuration
 	LeaderElectionEnabled       bool   `mapstructure:"leader_election_enabled"`
 	LeaderElectionLockName      string `mapstructure:"leader_election_lock_name"`
 	LeaderElectionLockNamespace string `mapstructure:"leader_election_lock_namespace"`
 
+	// State store configuration (persists state machine state across restarts and failovers)
+	StateStore          string `mapstructure:"state_store"`
+	StateStorePath      string `mapstructure:"state_store_path"`
+	StateStoreConfigMap string `mapstructure:"state_store_configmap"`
+	StateStoreNamespace string `mapstructure:"state_store_namespace"`
+
 	// Missing value behavior
 	MissingValueBehavior string `mapstructure:"missing_value_behavior"`
 
+	// How long a series may be absent from query results before its state is discarded
+	SeriesStaleness time.Duration `mapstructure:"series_staleness"`
+
+	// DryRun evaluates thresholds without executing plugins; executions are logged and
+	// counted in metric_reader_dry_run_actions_total instead
+	DryRun bool `mapstructure:"dry_run"`
+
 	// Plugin-specific configuration
 	Plugins PluginConfig `mapstructure:"plugins"`
+
+	// PluginTimeout bounds each plugin execution; 0 disables the timeout
+	PluginTimeout time.Duration `mapstructure:"plugin_timeout"`
+
+	// PluginTimeouts holds the [plugins.<name>] execution_timeout overrides of PluginTimeout
+	PluginTimeouts map[string]time.Duration `mapstructure:"-"`
+
+	// ActionWorkers runs plugin executions on a pool of this many workers instead of inside
+	// the polling loop; 0 executes them synchronously
+	ActionWorkers int `mapstructure:"action_workers"`
+
+	// ActionQueueSize is the number of executions that may wait for a worker
+	ActionQueueSize int `mapstructure:"action_queue_size"`
+
+	// Retry is the default retry policy of plugin executions
+	Retry RetryConfig `mapstructure:"retry"`
+
+	// PluginRetries holds the [plugins.<name>.retry] overrides of the default retry policy
+	PluginRetries map[string]RetryConfig `mapstructure:"-"`
+
+	// PluginEnv holds the plugin configuration as the environment variables the plugins read
+	PluginEnv map[string]string `mapstructure:"-"`
+
+	// Monitors configures multiple metrics to watch from a single process.
+	// When empty, the top-level metric and threshold settings define a single monitor.
+	Monitors []MonitorConfig `mapstructure:"monitors"`
+}
+
+// MonitorConfigs returns the monitors to run. When no [[monitors]] are configured,
+// a single monitor is built from the top-level metric and threshold settings.
+// Polling interval, missing value behavior, series staleness and dry run fall back to the top-level values
+// when a monitor does not set them, and the monitor name defaults to its metric name or query.
+func (c *Config) MonitorConfigs() []MonitorConfig {
+	if len(c.Monitors) == 0 {
+		return []MonitorConfig{{
+			Name:                 defaultMonitorName(c.MetricName, c.Query),
+			Query:                c.Query,
+			MetricName:           c.MetricName,
+			LabelFilters:         c.LabelFilters,
+			ThresholdOperator:    c.ThresholdOperator,
+			Soft:                 c.Soft,
+			Hard:                 c.Hard,
+			Levels:               c.Levels,
+			PollingInterval:      c.PollingInterval,
+			MissingValueBehavior: c.MissingValueBehavior,
+			SeriesStaleness:      c.SeriesStaleness,
+			DryRun:               &c.DryRun,
+			Condition:            c.Condition,
+			ConditionWindow:      c.ConditionWindow,
+			ConditionHorizon:     c.ConditionHorizon,
+			ConditionUnit:        c.ConditionUnit,
+			BaselineWindow:       c.BaselineWindow,
+			BaselineOffset:       c.BaselineOffset,
+			BaselineRefresh:      c.BaselineRefresh,
+			BaselineMinStdDev:    c.BaselineMinStdDev,
+		}}
+	}
+
+	monitors := make([]MonitorConfig, len(c.Monitors))
+	for i, m := range c.Monitors {
+		if m.Name == "" {
+			m.Name = defaultMonitorName(m.MetricName, m.Query)
+		}
+		if m.PollingInterval == 0 {
+			m.PollingInterval = c.PollingInterval
+		}
+		if m.MissingValueBehavior == "" {
+			m.MissingValueBehavior = c.MissingValueBehavior
+		}
+		if m.SeriesStaleness == 0 {
+			m.SeriesStaleness = c.SeriesStaleness
+		}
+		if m.DryRun == nil {
+			m.DryRun = &c.DryRun
+		}
+		monitors[i] = m
+	}
+	return monitors
+}
+
+// ThresholdLevels returns the configured threshold levels in escalation order: the [[levels]]
+// entries, or the soft and hard sections named "soft" and "hard"
+func (c *MonitorConfig) ThresholdLevels() []LevelSection {
+	if len(c.Levels) > 0 {
+		return c.Levels
+	}
+	var levels []LevelSection
+	if c.Soft != nil {
+		levels = append(levels, LevelSection{Name: "soft", ThresholdSection: *c.Soft})
+	}
+	if c.Hard != nil {
+		levels = append(levels, LevelSection{Name: "hard", ThresholdSection: *c.Hard})
+	}
+	return levels
+}
+
+// defaultMonitorName names a monitor after its metric, or after its query when no metric name is set
+func defaultMonitorName(metricName, query string) string {
+	if metricName != "" {
+		return metricName
+	}
+	return query
 }
 
 // LoadConfig loads configuration from file and environment variables
@@ -81,6 +396,23 @@ func LoadConfig() (*Config, error) {
 	v.SetDefault("leader_election_lock_name", "metric-reader-leader")
 	v.SetDefault("leader_election_lock_namespace", "")
 	v.SetDefault("missing_value_behavior", "zero")
+	v.SetDefault("series_staleness", "5m")
+	v.SetDefault("http_listen_address", ":8080")
+	v.SetDefault("state_store", "")
+	v.SetDefault("state_store_path", "/var/lib/metric-reader/state.json")
+	v.SetDefault("state_store_configmap", "metric-reader-state")
+	v.SetDefault("state_store_namespace", "")
+
+	v.SetDefault("dry_run", false)
+	v.SetDefault("plugin_timeout", "5m")
+	v.SetDefault("action_workers", 0)
+	v.SetDefault("action_queue_size", 100)
+	v.SetDefault("retry.max_retries", 0)
+	v.SetDefault("retry.initial_interval", "1s")
+	v.SetDefault("retry.max_interval", "30s")
+	v.SetDefault("retry.multiplier", 2.0)
+	v.SetDefault("retry.jitter", 0.2)
+	v.SetDefault("retry.max_elapsed_time", "1m")
 
 	// Set defaults for plugin configuration
 	v.SetDefault("plugins.file_action.dir", "/tmp/metric-files")
@@ -108,35 +440,78 @@ func LoadConfig() (*Config, error) {
 	v.AutomaticEnv()
 	// Bind each config key to its corresponding environment variable
 	v.BindEnv("log_level", "LOG_LEVEL")
+	v.BindEnv("query", "QUERY")
 	v.BindEnv("metric_name", "METRIC_NAME")
 	v.BindEnv("label_filters", "LABEL_FILTERS")
 	v.BindEnv("threshold_operator", "THRESHOLD_OPERATOR")
+	v.BindEnv("condition", "CONDITION")
+	v.BindEnv("condition_window", "CONDITION_WINDOW")
+	v.BindEnv("condition_horizon", "CONDITION_HORIZON")
+	v.BindEnv("condition_unit", "CONDITION_UNIT")
+	v.BindEnv("baseline_window", "BASELINE_WINDOW")
+	v.BindEnv("baseline_offset", "BASELINE_OFFSET")
+	v.BindEnv("baseline_refresh", "BASELINE_REFRESH")
+	v.BindEnv("baseline_min_stddev", "BASELINE_MIN_STDDEV")
 
 	// Threshold configuration
 	v.BindEnv("soft.threshold", "SOFT_THRESHOLD")
+	v.BindEnv("soft.lower", "SOFT_LOWER")
+	v.BindEnv("soft.upper", "SOFT_UPPER")
 	v.BindEnv("soft.plugin", "SOFT_PLUGIN")
 	v.BindEnv("soft.duration", "SOFT_DURATION")
 	v.BindEnv("soft.backoff_delay", "SOFT_BACKOFF_DELAY")
+	v.BindEnv("soft.recovery_plugin", "SOFT_RECOVERY_PLUGIN")
+	v.BindEnv("soft.plugins", "SOFT_PLUGINS")
+	v.BindEnv("soft.execution", "SOFT_EXECUTION")
+	v.BindEnv("soft.failure_policy", "SOFT_FAILURE_POLICY")
+	v.BindEnv("soft.dry_run", "SOFT_DRY_RUN")
+	v.BindEnv("soft.clear_threshold", "SOFT_CLEAR_THRESHOLD")
+	v.BindEnv("soft.hysteresis", "SOFT_HYSTERESIS")
+	v.BindEnv("soft.clear_duration", "SOFT_CLEAR_DURATION")
 
 	v.BindEnv("hard.threshold", "HARD_THRESHOLD")
+	v.BindEnv("hard.lower", "HARD_LOWER")
+	v.BindEnv("hard.upper", "HARD_UPPER")
 	v.BindEnv("hard.plugin", "HARD_PLUGIN")
 	v.BindEnv("hard.duration", "HARD_DURATION")
 	v.BindEnv("hard.backoff_delay", "HARD_BACKOFF_DELAY")
+	v.BindEnv("hard.recovery_plugin", "HARD_RECOVERY_PLUGIN")
+	v.BindEnv("hard.plugins", "HARD_PLUGINS")
+	v.BindEnv("hard.execution", "HARD_EXECUTION")
+	v.BindEnv("hard.failure_policy", "HARD_FAILURE_POLICY")
+	v.BindEnv("hard.dry_run", "HARD_DRY_RUN")
+	v.BindEnv("hard.clear_threshold", "HARD_CLEAR_THRESHOLD")
+	v.BindEnv("hard.hysteresis", "HARD_HYSTERESIS")
+	v.BindEnv("hard.clear_duration", "HARD_CLEAR_DURATION")
 
 	v.BindEnv("polling_interval", "POLLING_INTERVAL")
 	v.BindEnv("prometheus_endpoint", "PROMETHEUS_ENDPOINT")
 	v.BindEnv("plugin_dir", "PLUGIN_DIR")
+	v.BindEnv("http_listen_address", "HTTP_LISTEN_ADDRESS")
 	v.BindEnv("leader_election_enabled", "LEADER_ELECTION_ENABLED")
 	v.BindEnv("leader_election_lock_name", "LEADER_ELECTION_LOCK_NAME")
 	v.BindEnv("leader_election_lock_namespace", "LEADER_ELECTION_LOCK_NAMESPACE")
+	v.BindEnv("state_store", "STATE_STORE")
+	v.BindEnv("state_store_path", "STATE_STORE_PATH")
+	v.BindEnv("state_store_configmap", "STATE_STORE_CONFIGMAP")
+	v.BindEnv("state_store_namespace", "STATE_STORE_NAMESPACE")
 	v.BindEnv("missing_value_behavior", "MISSING_VALUE_BEHAVIOR")
+	v.BindEnv("series_staleness", "SERIES_STALENESS")
+	v.BindEnv("dry_run", "DRY_RUN")
+	v.BindEnv("plugin_timeout", "PLUGIN_TIMEOUT")
+	v.BindEnv("action_workers", "ACTION_WORKERS")
+	v.BindEnv("action_queue_size", "ACTION_QUEUE_SIZE")
+	v.BindEnv("retry.max_retries", "RETRY_MAX_RETRIES")
+	v.BindEnv("retry.initial_interval", "RETRY_INITIAL_INTERVAL")
+	v.BindEnv("retry.max_interval", "RETRY_MAX_INTERVAL")
+	v.BindEnv("retry.multiplier", "RETRY_MULTIPLIER")
+	v.BindEnv("retry.jitter", "RETRY_JITTER")
+	v.BindEnv("retry.max_elapsed_time", "RETRY_MAX_ELAPSED_TIME")
 
 	// Plugin-specific configuration
-	v.BindEnv("plugins.file_action.dir", "FILE_ACTION_DIR")
-	v.BindEnv("plugins.file_action.size", "FILE_ACTION_SIZE")
-	v.BindEnv("plugins.efs_emergency.file_system_id", "EFS_FILE_SYSTEM_ID")
-	v.BindEnv("plugins.efs_emergency.file_system_prometheus_label", "EFS_FILE_SYSTEM_PROMETHEUS_LABEL")
-	v.BindEnv("plugins.efs_emergency.aws_region", "AWS_REGION")
+	for _, b := range pluginEnvBindings {
+		v.BindEnv(b.key, b.env)
+	}
 
 	// Parse config into struct
 	var config Config
@@ -144,5 +519,59 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("error unmarshaling config: %w", err)
 	}
 
+	// Per-plugin execution settings override the defaults; retry settings key by key
+	config.PluginTimeouts = make(map[string]time.Duration)
+	config.PluginRetries = make(map[string]RetryConfig)
+	for name := range v.GetStringMap("plugins") {
+		if key := "plugins." + name + ".execution_timeout"; v.IsSet(key) {
+			timeout, err := time.ParseDuration(v.GetString(key))
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %s: %w", key, err)
+			}
+			config.PluginTimeouts[name] = timeout
+		}
+
+		key := "plugins." + name + ".retry"
+		if !v.IsSet(key) {
+			continue
+		}
+		retry := config.Retry
+		if err := v.UnmarshalKey(key, &retry); err != nil {
+			return nil, fmt.Errorf("error unmarshaling %s: %w", key, err)
+		}
+		config.PluginRetries[name] = retry
+	}
+
+	// Collect the plugin configuration for export to the plugins' environment. Only keys set in
+	// the config file or the environment are exported; plugins apply their own defaults.
+	config.PluginEnv = make(map[string]string)
+	for _, b := range pluginEnvBindings {
+		if os.Getenv(b.env) == "" && !v.InConfig(b.key) {
+			continue
+		}
+		value, err := pluginEnvValue(v.Get(b.key))
+		if err != nil {
+			return nil, fmt.Errorf("error converting %s to %s: %w", b.key, b.env, err)
+		}
+		config.PluginEnv[b.env] = value
+	}
+
 	return &config, nil
 }
+
+// pluginEnvValue formats a configuration value as an environment variable.
+// Tables such as plugins.webhook.headers and arrays such as plugins.exec_action.args are encoded as JSON.
+func pluginEnvValue(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case map[string]interface{}, map[string]string, []interface{}, []string:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	default:
+		return fmt.Sprint(value), nil
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLockNamespaceConfig(t *testing.T) {
@@ -348,3 +350,681 @@ func TestEnvironmentVariableThresholdConfig(t *testing.T) {
 		t.Errorf("Expected threshold_operator 'less_than' from env, got %q", config.ThresholdOperator)
 	}
 }
+
+func TestMonitorsConfig(t *testing.T) {
+	// Save current working directory
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	defer os.Chdir(originalWd)
+
+	// Clear any env vars that would override the config file
+	envVars := []string{"METRIC_NAME", "POLLING_INTERVAL", "MISSING_VALUE_BEHAVIOR", "THRESHOLD_OPERATOR"}
+	savedEnvs := make(map[string]string)
+	for _, key := range envVars {
+		savedEnvs[key] = os.Getenv(key)
+		os.Unsetenv(key)
+	}
+	defer func() {
+		for key, value := range savedEnvs {
+			if value != "" {
+				os.Setenv(key, value)
+			} else {
+				os.Unsetenv(key)
+			}
+		}
+	}()
+
+	tmpDir := t.TempDir()
+
+	configContent := `polling_interval = "20s"
+missing_value_behavior = "last_value"
+
+[[monitors]]
+name = "cpu"
+metric_name = "node_cpu_usage"
+label_filters = 'instance="a"'
+threshold_operator = "greater_than"
+polling_interval = "5s"
+
+[monitors.soft]
+threshold = 80.0
+plugin = "log_action"
+duration = "30s"
+
+[monitors.hard]
+threshold = 95.0
+plugin = "file_action"
+duration = "1m"
+
+[[monitors]]
+metric_name = "efs_burst_credits"
+threshold_operator = "less_than"
+missing_value_behavior = "assume_breached"
+
+[monitors.soft]
+threshold = 1000.0
+plugin = "efs_emergency"
+`
+
+	configPath := tmpDir + "/config.toml"
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	os.Chdir(tmpDir)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	monitors := config.MonitorConfigs()
+	if len(monitors) != 2 {
+		t.Fatalf("Expected 2 monitors, got %d", len(monitors))
+	}
+
+	cpu := monitors[0]
+	if cpu.Name != "cpu" {
+		t.Errorf("Expected first monitor name 'cpu', got %q", cpu.Name)
+	}
+	if cpu.LabelFilters != `instance="a"` {
+		t.Errorf("Expected first monitor label filters 'instance=\"a\"', got %q", cpu.LabelFilters)
+	}
+	if cpu.PollingInterval.Seconds() != 5 {
+		t.Errorf("Expected first monitor polling interval 5s, got %v", cpu.PollingInterval)
+	}
+	if cpu.MissingValueBehavior != "last_value" {
+		t.Errorf("Expected first monitor to inherit missing_value_behavior 'last_value', got %q", cpu.MissingValueBehavior)
+	}
+	if cpu.Soft == nil || cpu.Soft.Threshold != 80.0 || cpu.Soft.Duration.Seconds() != 30 {
+		t.Errorf("Expected first monitor soft threshold 80.0 for 30s, got %+v", cpu.Soft)
+	}
+	if cpu.Hard == nil || cpu.Hard.Plugin != "file_action" {
+		t.Errorf("Expected first monitor hard plugin 'file_action', got %+v", cpu.Hard)
+	}
+
+	efs := monitors[1]
+	if efs.Name != "efs_burst_credits" {
+		t.Errorf("Expected second monitor name to default to metric name, got %q", efs.Name)
+	}
+	if efs.PollingInterval.Seconds() != 20 {
+		t.Errorf("Expected second monitor to inherit polling interval 20s, got %v", efs.PollingInterval)
+	}
+	if efs.MissingValueBehavior != "assume_breached" {
+		t.Errorf("Expected second monitor missing_value_behavior 'assume_breached', got %q", efs.MissingValueBehavior)
+	}
+	if efs.Hard != nil {
+		t.Errorf("Expected second monitor to have no hard threshold, got %+v", efs.Hard)
+	}
+}
+
+func TestLegacyConfigBuildsSingleMonitor(t *testing.T) {
+	config := &Config{
+		MetricName:           "up",
+		LabelFilters:         `job="prometheus"`,
+		ThresholdOperator:    "greater_than",
+		Soft:                 &ThresholdSection{Threshold: 1},
+		PollingInterval:      time.Second,
+		MissingValueBehavior: "zero",
+	}
+
+	monitors := config.MonitorConfigs()
+	if len(monitors) != 1 {
+		t.Fatalf("Expected 1 monitor, got %d", len(monitors))
+	}
+	if monitors[0].Name != "up" || monitors[0].MetricName != "up" {
+		t.Errorf("Expected monitor named after metric 'up', got %+v", monitors[0])
+	}
+	if monitors[0].Soft != config.Soft {
+		t.Error("Expected monitor to use top-level soft threshold section")
+	}
+}
+
+func TestQueryConfig(t *testing.T) {
+	originalQuery := os.Getenv("QUERY")
+	defer func() {
+		if originalQuery != "" {
+			os.Setenv("QUERY", originalQuery)
+		} else {
+			os.Unsetenv("QUERY")
+		}
+	}()
+
+	os.Setenv("QUERY", "sum(rate(http_requests_total[5m]))")
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.Query != "sum(rate(http_requests_total[5m]))" {
+		t.Errorf("Expected query from QUERY env var, got %q", config.Query)
+	}
+
+	monitors := config.MonitorConfigs()
+	if len(monitors) != 1 || monitors[0].Query != config.Query {
+		t.Fatalf("Expected a single monitor using the query, got %+v", monitors)
+	}
+	if config.MetricName == "" && monitors[0].Name != config.Query {
+		t.Errorf("Expected monitor name to default to the query, got %q", monitors[0].Name)
+	}
+}
+
+func TestPluginEnvFromTOML(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	defer os.Chdir(originalWd)
+
+	for _, b := range pluginEnvBindings {
+		t.Setenv(b.env, "")
+		os.Unsetenv(b.env)
+	}
+	// Environment variables take precedence over the config file
+	t.Setenv("WEBHOOK_RETRIES", "5")
+
+	tmpDir := t.TempDir()
+	configContent := `metric_name = "test_metric"
+
+[plugins.webhook]
+url = "https://hooks.example.com/metric-reader"
+timeout = "3s"
+
+[plugins.webhook.headers]
+Authorization = "Bearer token"
+
+[plugins.exec_action]
+command = "kubectl"
+args = ["rollout", "restart", "deployment/web"]
+`
+	if err := os.WriteFile(tmpDir+"/config.toml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	os.Chdir(tmpDir)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	expected := map[string]string{
+		"WEBHOOK_URL":     "https://hooks.example.com/metric-reader",
+		"WEBHOOK_TIMEOUT": "3s",
+		"WEBHOOK_RETRIES": "5",
+		// Table keys are lower-cased by the config loader; HTTP header names are case-insensitive
+		"WEBHOOK_HEADERS":     `{"authorization":"Bearer token"}`,
+		"EXEC_ACTION_COMMAND": "kubectl",
+		"EXEC_ACTION_ARGS":    `["rollout","restart","deployment/web"]`,
+	}
+	for env, want := range expected {
+		if got := config.PluginEnv[env]; got != want {
+			t.Errorf("expected %s=%q, got %q", env, want, got)
+		}
+	}
+	for _, env := range []string{"WEBHOOK_HMAC_SECRET", "WEBHOOK_METHOD", "FILE_ACTION_DIR"} {
+		if _, ok := config.PluginEnv[env]; ok {
+			t.Errorf("expected unset %s not to be exported", env)
+		}
+	}
+	if config.Plugins.Webhook.Timeout != 3*time.Second {
+		t.Errorf("expected plugins.webhook.timeout 3s, got %v", config.Plugins.Webhook.Timeout)
+	}
+}
+
+func TestThresholdPluginChainConfig(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	defer os.Chdir(originalWd)
+
+	// Environment variables take precedence over the config file
+	t.Setenv("HARD_PLUGINS", "alertmanager,k8s_scale")
+
+	tmpDir := t.TempDir()
+	configContent := `metric_name = "test_metric"
+threshold_operator = "greater_than"
+
+[soft]
+threshold = 80
+plugin = "log_action"
+plugins = ["webhook", "log_action"]
+execution = "parallel"
+failure_policy = "continue"
+
+[hard]
+threshold = 95
+`
+	if err := os.WriteFile(tmpDir+"/config.toml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	os.Chdir(tmpDir)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// plugin runs first and duplicates are dropped
+	if got := strings.Join(config.Soft.PluginNames(), ","); got != "log_action,webhook" {
+		t.Errorf("Expected soft plugins 'log_action,webhook', got %q", got)
+	}
+	if config.Soft.Execution != "parallel" || config.Soft.FailurePolicy != "continue" {
+		t.Errorf("Expected parallel execution with continue policy, got %q and %q", config.Soft.Execution, config.Soft.FailurePolicy)
+	}
+	if got := strings.Join(config.Hard.PluginNames(), ","); got != "alertmanager,k8s_scale" {
+		t.Errorf("Expected hard plugins 'alertmanager,k8s_scale' from env, got %q", got)
+	}
+}
+
+func TestClearThresholdConfig(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	defer os.Chdir(originalWd)
+
+	t.Setenv("SOFT_CLEAR_DURATION", "2m")
+	t.Setenv("HARD_HYSTERESIS", "2.5")
+
+	tmpDir := t.TempDir()
+	configContent := `metric_name = "test_metric"
+threshold_operator = "greater_than"
+
+[soft]
+threshold = 80
+clear_threshold = 70
+
+[hard]
+threshold = 95
+clear_duration = "30s"
+`
+	if err := os.WriteFile(tmpDir+"/config.toml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	os.Chdir(tmpDir)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if config.Soft.ClearThreshold == nil || *config.Soft.ClearThreshold != 70 {
+		t.Errorf("Expected soft clear threshold 70, got %v", config.Soft.ClearThreshold)
+	}
+	if config.Soft.ClearDuration != 2*time.Minute {
+		t.Errorf("Expected soft clear duration 2m from env, got %v", config.Soft.ClearDuration)
+	}
+	if config.Hard.ClearThreshold != nil || config.Hard.Hysteresis != 2.5 {
+		t.Errorf("Expected hard hysteresis 2.5 from env without a clear threshold, got %v and %v", config.Hard.ClearThreshold, config.Hard.Hysteresis)
+	}
+	if config.Hard.ClearDuration != 30*time.Second {
+		t.Errorf("Expected hard clear duration 30s, got %v", config.Hard.ClearDuration)
+	}
+}
+
+func TestRangeThresholdConfig(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	defer os.Chdir(originalWd)
+
+	t.Setenv("SOFT_UPPER", "500")
+
+	tmpDir := t.TempDir()
+	configContent := `metric_name = "queue_depth"
+threshold_operator = "outside_range"
+
+[soft]
+lower = 10
+upper = 1000
+plugin = "log_action"
+
+[hard]
+lower = 0
+upper = 5000
+`
+	if err := os.WriteFile(tmpDir+"/config.toml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	os.Chdir(tmpDir)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if config.Soft.Lower == nil || *config.Soft.Lower != 10 {
+		t.Errorf("Expected soft lower bound 10, got %v", config.Soft.Lower)
+	}
+	if config.Soft.Upper == nil || *config.Soft.Upper != 500 {
+		t.Errorf("Expected soft upper bound 500 from env, got %v", config.Soft.Upper)
+	}
+	if config.Hard.Lower == nil || *config.Hard.Lower != 0 || config.Hard.Upper == nil || *config.Hard.Upper != 5000 {
+		t.Errorf("Expected hard bounds 0 and 5000, got %v and %v", config.Hard.Lower, config.Hard.Upper)
+	}
+	if _, err := newMonitor(config.MonitorConfigs()[0]); err != nil {
+		t.Errorf("Expected a valid monitor, got %v", err)
+	}
+}
+
+func TestConditionConfig(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	defer os.Chdir(originalWd)
+
+	t.Setenv("CONDITION_HORIZON", "2h")
+
+	tmpDir := t.TempDir()
+	configContent := `metric_name = "aws_efs_burst_credit_balance"
+threshold_operator = "less_or_equal"
+condition = "predict_linear"
+condition_window = "1h"
+
+[soft]
+threshold = 0
+
+[[monitors]]
+name = "drain"
+metric_name = "aws_efs_burst_credit_balance"
+threshold_operator = "less_than"
+condition = "deriv"
+condition_window = "15m"
+condition_unit = "1m"
+
+[monitors.soft]
+threshold = -1000
+`
+	if err := os.WriteFile(tmpDir+"/config.toml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	os.Chdir(tmpDir)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if config.Condition != "predict_linear" || config.ConditionWindow != time.Hour || config.ConditionHorizon != 2*time.Hour {
+		t.Errorf("Unexpected top-level condition: %q %v %v", config.Condition, config.ConditionWindow, config.ConditionHorizon)
+	}
+
+	monitors := config.MonitorConfigs()
+	if len(monitors) != 1 {
+		t.Fatalf("Expected 1 monitor, got %d", len(monitors))
+	}
+	drain := monitors[0]
+	if drain.Condition != "deriv" || drain.ConditionWindow != 15*time.Minute || drain.ConditionUnit != time.Minute {
+		t.Errorf("Unexpected monitor condition: %q %v %v", drain.Condition, drain.ConditionWindow, drain.ConditionUnit)
+	}
+	if drain.ConditionHorizon != 0 {
+		t.Errorf("Expected monitors not to inherit the top-level condition, got horizon %v", drain.ConditionHorizon)
+	}
+}
+
+func TestBaselineConfig(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	defer os.Chdir(originalWd)
+
+	t.Setenv("BASELINE_REFRESH", "10m")
+
+	tmpDir := t.TempDir()
+	configContent := `metric_name = "http_requests_rate"
+threshold_operator = "greater_than"
+baseline_window = "1h"
+baseline_offset = "168h"
+
+[soft]
+threshold = 3
+
+[[monitors]]
+name = "latency"
+metric_name = "http_request_duration_seconds"
+threshold_operator = "outside_range"
+baseline_window = "6h"
+
+[monitors.soft]
+lower = -3
+upper = 3
+`
+	if err := os.WriteFile(tmpDir+"/config.toml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	os.Chdir(tmpDir)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if config.BaselineWindow != time.Hour || config.BaselineOffset != 168*time.Hour || config.BaselineRefresh != 10*time.Minute {
+		t.Errorf("Unexpected top-level baseline: %v %v %v", config.BaselineWindow, config.BaselineOffset, config.BaselineRefresh)
+	}
+
+	monitors := config.MonitorConfigs()
+	if len(monitors) != 1 {
+		t.Fatalf("Expected 1 monitor, got %d", len(monitors))
+	}
+	latency := monitors[0]
+	if latency.BaselineWindow != 6*time.Hour || latency.BaselineOffset != 0 {
+		t.Errorf("Unexpected monitor baseline: %v %v", latency.BaselineWindow, latency.BaselineOffset)
+	}
+}
+
+func TestLevelsConfig(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	defer os.Chdir(originalWd)
+
+	tmpDir := t.TempDir()
+	configContent := `[[monitors]]
+name = "disk"
+metric_name = "disk_usage_percent"
+threshold_operator = "greater_than"
+
+[[monitors.levels]]
+name = "warn"
+threshold = 70
+plugin = "log_action"
+
+[[monitors.levels]]
+name = "critical"
+threshold = 90
+duration = "5m"
+plugins = ["webhook", "alertmanager"]
+execution = "parallel"
+recovery_plugin = "webhook"
+
+[[monitors.levels]]
+name = "emergency"
+threshold = 98
+backoff_delay = "10m"
+`
+	if err := os.WriteFile(tmpDir+"/config.toml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	os.Chdir(tmpDir)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	monitors := config.MonitorConfigs()
+	if len(monitors) != 1 {
+		t.Fatalf("Expected 1 monitor, got %d", len(monitors))
+	}
+	levels := monitors[0].ThresholdLevels()
+	if len(levels) != 3 {
+		t.Fatalf("Expected 3 levels, got %d", len(levels))
+	}
+	if levels[0].Name != "warn" || levels[0].Threshold != 70 || levels[0].Plugin != "log_action" {
+		t.Errorf("Unexpected warn level: %+v", levels[0])
+	}
+	critical := levels[1]
+	if critical.Name != "critical" || critical.Duration != 5*time.Minute || critical.Execution != "parallel" || critical.RecoveryPlugin != "webhook" {
+		t.Errorf("Unexpected critical level: %+v", critical)
+	}
+	if got := strings.Join(critical.PluginNames(), ","); got != "webhook,alertmanager" {
+		t.Errorf("Expected critical plugins 'webhook,alertmanager', got %q", got)
+	}
+	if levels[2].Name != "emergency" || levels[2].BackoffDelay != 10*time.Minute {
+		t.Errorf("Unexpected emergency level: %+v", levels[2])
+	}
+}
+
+func TestRetryConfig(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	defer os.Chdir(originalWd)
+
+	// Environment variables take precedence over the config file
+	t.Setenv("RETRY_JITTER", "0.5")
+
+	tmpDir := t.TempDir()
+	configContent := `metric_name = "test_metric"
+
+[retry]
+max_retries = 2
+initial_interval = "2s"
+
+[plugins.efs_emergency.retry]
+max_retries = 5
+max_elapsed_time = "5m"
+`
+	if err := os.WriteFile(tmpDir+"/config.toml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	os.Chdir(tmpDir)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	expectedDefault := RetryConfig{MaxRetries: 2, InitialInterval: 2 * time.Second, MaxInterval: 30 * time.Second, Multiplier: 2, Jitter: 0.5, MaxElapsedTime: time.Minute}
+	if config.Retry != expectedDefault {
+		t.Errorf("Expected default retry %+v, got %+v", expectedDefault, config.Retry)
+	}
+
+	// Unset keys of a plugin's retry section fall back to the default policy
+	expectedOverride := expectedDefault
+	expectedOverride.MaxRetries = 5
+	expectedOverride.MaxElapsedTime = 5 * time.Minute
+	if got := config.PluginRetries["efs_emergency"]; got != expectedOverride {
+		t.Errorf("Expected efs_emergency retry %+v, got %+v", expectedOverride, got)
+	}
+	if _, ok := config.PluginRetries["webhook"]; ok {
+		t.Error("Expected no retry override for webhook")
+	}
+}
+
+func TestPluginExecutionConfig(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	defer os.Chdir(originalWd)
+
+	t.Setenv("ACTION_WORKERS", "4")
+
+	tmpDir := t.TempDir()
+	configContent := `metric_name = "test_metric"
+plugin_timeout = "2m"
+
+[plugins.efs_emergency]
+execution_timeout = "30s"
+`
+	if err := os.WriteFile(tmpDir+"/config.toml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	os.Chdir(tmpDir)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if config.PluginTimeout != 2*time.Minute {
+		t.Errorf("Expected plugin_timeout 2m, got %v", config.PluginTimeout)
+	}
+	if got := config.PluginTimeouts["efs_emergency"]; got != 30*time.Second {
+		t.Errorf("Expected efs_emergency execution_timeout 30s, got %v", got)
+	}
+	if config.ActionWorkers != 4 || config.ActionQueueSize != 100 {
+		t.Errorf("Expected 4 action workers with the default queue size 100, got %d and %d", config.ActionWorkers, config.ActionQueueSize)
+	}
+}
+
+func TestDryRunConfig(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	defer os.Chdir(originalWd)
+
+	t.Setenv("DRY_RUN", "true")
+
+	tmpDir := t.TempDir()
+	configContent := `[[monitors]]
+name = "disk"
+metric_name = "disk_usage"
+threshold_operator = "greater_than"
+
+[monitors.soft]
+threshold = 80.0
+plugin = "log_action"
+
+[monitors.hard]
+threshold = 95.0
+plugin = "efs_emergency"
+dry_run = false
+
+[[monitors]]
+name = "cpu"
+metric_name = "cpu_usage"
+threshold_operator = "greater_than"
+dry_run = false
+
+[monitors.soft]
+threshold = 90.0
+plugin = "log_action"
+`
+	if err := os.WriteFile(tmpDir+"/config.toml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	os.Chdir(tmpDir)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if !config.DryRun {
+		t.Fatal("Expected dry_run to be enabled from DRY_RUN")
+	}
+
+	monitors := config.MonitorConfigs()
+	if len(monitors) != 2 {
+		t.Fatalf("Expected 2 monitors, got %d", len(monitors))
+	}
+	if monitors[0].DryRun == nil || !*monitors[0].DryRun {
+		t.Error("Expected the disk monitor to inherit dry_run")
+	}
+	if monitors[1].DryRun == nil || *monitors[1].DryRun {
+		t.Error("Expected the cpu monitor to override dry_run")
+	}
+	if monitors[0].Hard.DryRun == nil || *monitors[0].Hard.DryRun {
+		t.Error("Expected the disk hard threshold to override dry_run")
+	}
+}
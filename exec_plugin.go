@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	pluginapi "metric-reader/pkg/plugin"
+)
+
+const (
+	// execPluginHandshakeTimeout bounds how long a starting exec plugin may take to answer the handshake
+	execPluginHandshakeTimeout = 10 * time.Second
+	// execPluginCallTimeout bounds calls made with a context without deadline
+	execPluginCallTimeout = 5 * time.Minute
+)
+
+// execPluginProtocolVersions are the exec plugin protocol versions supported by the host
+var execPluginProtocolVersions = []int{pluginapi.ProtocolVersion}
+
+// errExecPluginExited is returned when the plugin process exits while a call is in progress
+var errExecPluginExited = errors.New("plugin process exited")
+
+// execPlugin runs a plugin as a subprocess and talks to it with JSON over stdio.
+// A crashing plugin only fails the call in progress; the process is restarted on the next call.
+type execPlugin struct {
+	path string
+	args []string
+
+	// name is set at each handshake and read without mu, so Name never waits for a call in flight
+	name atomic.Pointer[string]
+
+	// mu serialises calls; the protocol has a single request in flight per process
+	mu      sync.Mutex
+	proc    *execPluginProcess
+	nextID  uint64
+	version int
+}
+
+// execPluginProcess is a running plugin process
+type execPluginProcess struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	responses chan *pluginapi.Response
+	// done is closed by stop so that responses nobody waits for don't block the reader
+	done chan struct{}
+	// exited is closed once the process has exited
+	exited chan struct{}
+	err    error
+}
+
+// LoadExecPlugin starts an exec plugin and performs the handshake
+func LoadExecPlugin(path string, args ...string) (pluginapi.ActionPlugin, error) {
+	p := &execPlugin{path: path, args: args}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.start(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// start launches the plugin process and negotiates the protocol version. Must be called with p.mu held.
+func (p *execPlugin) start() error {
+	cmd := exec.Command(p.path, p.args...)
+	cmd.Env = append(os.Environ(), pluginapi.MagicCookieKey+"="+pluginapi.MagicCookieValue)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create plugin stdin: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create plugin stdout: %v", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create plugin stderr: %v", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start plugin %s: %v", p.path, err)
+	}
+
+	proc := &execPluginProcess{
+		cmd:       cmd,
+		stdin:     stdin,
+		responses: make(chan *pluginapi.Response),
+		done:      make(chan struct{}),
+		exited:    make(chan struct{}),
+	}
+
+	// Forward the plugin's stderr to the log
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			log.Info().Str("plugin_path", p.path).Str("stream", "stderr").Msg(scanner.Text())
+		}
+	}()
+
+	// Read responses until stdout is closed, then wait for the process to exit
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			var resp pluginapi.Response
+			if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+				log.Warn().Err(err).Str("plugin_path", p.path).Msg("ignoring malformed plugin response")
+				continue
+			}
+			select {
+			case proc.responses <- &resp:
+			case <-proc.done:
+			}
+		}
+		<-stderrDone
+		proc.err = cmd.Wait()
+		close(proc.exited)
+	}()
+
+	p.proc = proc
+
+	ctx, cancel := context.WithTimeout(context.Background(), execPluginHandshakeTimeout)
+	defer cancel()
+
+	var handshake pluginapi.HandshakeResponse
+	if err := p.call(ctx, pluginapi.MethodHandshake, pluginapi.HandshakeRequest{ProtocolVersions: execPluginProtocolVersions}, &handshake); err != nil {
+		p.stop()
+		return fmt.Errorf("plugin %s handshake failed: %v", p.path, err)
+	}
+	if !supportsProtocolVersion(handshake.ProtocolVersion) {
+		p.stop()
+		return fmt.Errorf("plugin %s chose unsupported protocol version %d", p.path, handshake.ProtocolVersion)
+	}
+	if handshake.Name == "" {
+		p.stop()
+		return fmt.Errorf("plugin %s did not report a name", p.path)
+	}
+
+	if name := p.name.Load(); name != nil && *name != handshake.Name {
+		log.Warn().Str("expected", *name).Str("actual", handshake.Name).Msg("restarted plugin reports a different name")
+	}
+	p.name.Store(&handshake.Name)
+	p.version = handshake.ProtocolVersion
+
+	log.Debug().
+		Str("plugin", p.Name()).
+		Str("plugin_path", p.path).
+		Int("pid", cmd.Process.Pid).
+		Int("protocol_version", p.version).
+		Msg("exec plugin started")
+
+	return nil
+}
+
+// stop kills the plugin process. Must be called with p.mu held.
+func (p *execPlugin) stop() {
+	if p.proc == nil {
+		return
+	}
+	close(p.proc.done)
+	p.proc.stdin.Close()
+	p.proc.cmd.Process.Kill()
+	<-p.proc.exited
+	p.proc = nil
+}
+
+// close stops the plugin process. Plugin processes also exit when metric-reader exits and closes their stdin.
+func (p *execPlugin) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stop()
+}
+
+// running reports whether the plugin process is alive. Must be called with p.mu held.
+func (p *execPlugin) running() bool {
+	if p.proc == nil {
+		return false
+	}
+	select {
+	case <-p.proc.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// ensureRunning restarts the plugin process if it has exited. Must be called with p.mu held.
+func (p *execPlugin) ensureRunning() error {
+	if p.running() {
+		return nil
+	}
+
+	if p.proc != nil {
+		log.Warn().
+			Str("plugin", p.Name()).
+			AnErr("exit_error", p.proc.err).
+			Msg("exec plugin exited, restarting")
+		p.proc = nil
+	}
+	return p.start()
+}
+
+// call sends a request and decodes the result into result. Must be called with p.mu held.
+// The process is killed when ctx ends before the plugin answers, and restarted on the next call.
+func (p *execPlugin) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	proc := p.proc
+
+	p.nextID++
+	req := pluginapi.Request{ID: p.nextID, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s params: %v", method, err)
+		}
+		req.Params = data
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s request: %v", method, err)
+	}
+	if _, err := proc.stdin.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to send %s request: %v", method, err)
+	}
+
+	for {
+		select {
+		case resp := <-proc.responses:
+			if resp.ID != req.ID {
+				log.Warn().
+					Str("plugin", p.Name()).
+					Uint64("id", resp.ID).
+					Msg("ignoring plugin response to an unknown request")
+				continue
+			}
+			if resp.Error != "" {
+				return errors.New(resp.Error)
+			}
+			if result != nil && len(resp.Result) > 0 {
+				if err := json.Unmarshal(resp.Result, result); err != nil {
+					return fmt.Errorf("failed to decode %s result: %v", method, err)
+				}
+			}
+			return nil
+		case <-proc.exited:
+			return fmt.Errorf("%w during %s: %v", errExecPluginExited, method, proc.err)
+		case <-ctx.Done():
+			p.stop()
+			return fmt.Errorf("%s call aborted: %v", method, ctx.Err())
+		}
+	}
+}
+
+// invoke restarts the plugin if needed and calls method
+func (p *execPlugin) invoke(ctx context.Context, method string, params interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.ensureRunning(); err != nil {
+		return err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, execPluginCallTimeout)
+		defer cancel()
+	}
+	return p.call(ctx, method, params, nil)
+}
+
+// HandleEvent implements ActionPlugin
+func (p *execPlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
+	return p.invoke(ctx, pluginapi.MethodHandleEvent, event)
+}
+
+// Name implements ActionPlugin with the name reported in the handshake
+func (p *execPlugin) Name() string {
+	if name := p.name.Load(); name != nil {
+		return *name
+	}
+	return ""
+}
+
+// ValidateConfig implements ActionPlugin
+func (p *execPlugin) ValidateConfig() error {
+	return p.invoke(context.Background(), pluginapi.MethodValidateConfig, nil)
+}
+
+// supportsProtocolVersion reports whether the host implements a protocol version
+func supportsProtocolVersion(version int) bool {
+	for _, v := range execPluginProtocolVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
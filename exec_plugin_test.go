@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pluginapi "metric-reader/pkg/plugin"
+)
+
+// helperPlugin is served by TestHelperProcess when the test binary is started as an exec plugin
+type helperPlugin struct{}
+
+func (helperPlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
+	switch event.MetricName {
+	case "crash":
+		os.Exit(3)
+	case "hang":
+		time.Sleep(time.Minute)
+	case "unsolicited":
+		// Answer a request that was never sent once the real response has been written
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			fmt.Fprintln(os.Stdout, `{"id":999999}`)
+		}()
+	case "fail":
+		return fmt.Errorf("action failed for %s", event.Labels["instance"])
+	}
+	fmt.Fprintf(os.Stderr, "handled %s from pid %d\n", event.MetricName, os.Getpid())
+	return nil
+}
+
+func (helperPlugin) Name() string {
+	return "helper"
+}
+
+func (helperPlugin) ValidateConfig() error {
+	if os.Getenv("HELPER_PLUGIN_INVALID") != "" {
+		return fmt.Errorf("HELPER_PLUGIN_INVALID is set")
+	}
+	return nil
+}
+
+// TestHelperProcess is not a real test; it runs helperPlugin when started by writeHelperPlugin
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	pluginapi.Serve(helperPlugin{})
+	os.Exit(0)
+}
+
+// writeHelperPlugin writes an executable named name to dir that starts the test binary as an exec plugin
+func writeHelperPlugin(t *testing.T, dir, name string) string {
+	t.Helper()
+	t.Setenv("GO_WANT_HELPER_PROCESS", "1")
+
+	path := filepath.Join(dir, name)
+	script := fmt.Sprintf("#!/bin/sh\nexec %q -test.run='^TestHelperProcess$'\n", os.Args[0])
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write helper plugin: %v", err)
+	}
+	return path
+}
+
+func TestExecPluginHandshakeAndEvents(t *testing.T) {
+	path := writeHelperPlugin(t, t.TempDir(), "helper")
+
+	p, err := LoadExecPlugin(path)
+	if err != nil {
+		t.Fatalf("LoadExecPlugin failed: %v", err)
+	}
+	defer p.(*execPlugin).close()
+
+	if p.Name() != "helper" {
+		t.Errorf("expected name from handshake to be helper, got %q", p.Name())
+	}
+	if err := p.ValidateConfig(); err != nil {
+		t.Errorf("ValidateConfig failed: %v", err)
+	}
+
+	event := &pluginapi.ThresholdEvent{Version: pluginapi.EventVersion, MetricName: "cpu_usage"}
+	if err := executePlugin(context.Background(), p, event); err != nil {
+		t.Errorf("executePlugin failed: %v", err)
+	}
+
+	// Errors returned by the plugin are passed through
+	event = &pluginapi.ThresholdEvent{MetricName: "fail", Labels: map[string]string{"instance": "a"}}
+	err = executePlugin(context.Background(), p, event)
+	if err == nil || err.Error() != "action failed for a" {
+		t.Errorf("expected plugin error to be returned, got %v", err)
+	}
+}
+
+func TestExecPluginValidateConfigError(t *testing.T) {
+	path := writeHelperPlugin(t, t.TempDir(), "helper")
+	t.Setenv("HELPER_PLUGIN_INVALID", "1")
+
+	p, err := LoadExecPlugin(path)
+	if err != nil {
+		t.Fatalf("LoadExecPlugin failed: %v", err)
+	}
+	defer p.(*execPlugin).close()
+
+	if err := p.ValidateConfig(); err == nil || !strings.Contains(err.Error(), "HELPER_PLUGIN_INVALID") {
+		t.Errorf("expected validation error from plugin, got %v", err)
+	}
+}
+
+func TestExecPluginRestartsAfterCrash(t *testing.T) {
+	path := writeHelperPlugin(t, t.TempDir(), "helper")
+
+	p, err := LoadExecPlugin(path)
+	if err != nil {
+		t.Fatalf("LoadExecPlugin failed: %v", err)
+	}
+	ep := p.(*execPlugin)
+	defer ep.close()
+
+	firstPid := ep.proc.cmd.Process.Pid
+
+	err = ep.HandleEvent(context.Background(), &pluginapi.ThresholdEvent{MetricName: "crash"})
+	if !errors.Is(err, errExecPluginExited) {
+		t.Fatalf("expected crash to fail the call with errExecPluginExited, got %v", err)
+	}
+
+	// The next call starts a new process
+	if err := ep.HandleEvent(context.Background(), &pluginapi.ThresholdEvent{MetricName: "cpu_usage"}); err != nil {
+		t.Fatalf("expected call after crash to succeed, got %v", err)
+	}
+	if ep.proc.cmd.Process.Pid == firstPid {
+		t.Error("expected the plugin process to be restarted")
+	}
+}
+
+func TestExecPluginKilledOnTimeout(t *testing.T) {
+	path := writeHelperPlugin(t, t.TempDir(), "helper")
+
+	p, err := LoadExecPlugin(path)
+	if err != nil {
+		t.Fatalf("LoadExecPlugin failed: %v", err)
+	}
+	ep := p.(*execPlugin)
+	defer ep.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := ep.HandleEvent(ctx, &pluginapi.ThresholdEvent{MetricName: "hang"}); err == nil {
+		t.Fatal("expected hanging call to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected hanging call to be aborted, took %v", elapsed)
+	}
+
+	if err := ep.HandleEvent(context.Background(), &pluginapi.ThresholdEvent{MetricName: "cpu_usage"}); err != nil {
+		t.Errorf("expected call after timeout to succeed, got %v", err)
+	}
+}
+
+func TestExecPluginNameDuringCall(t *testing.T) {
+	path := writeHelperPlugin(t, t.TempDir(), "helper")
+
+	p, err := LoadExecPlugin(path)
+	if err != nil {
+		t.Fatalf("LoadExecPlugin failed: %v", err)
+	}
+	ep := p.(*execPlugin)
+	defer ep.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ep.HandleEvent(ctx, &pluginapi.ThresholdEvent{MetricName: "hang"})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	named := make(chan string)
+	go func() { named <- ep.Name() }()
+	select {
+	case name := <-named:
+		if name != "helper" {
+			t.Errorf("expected name helper, got %q", name)
+		}
+	case <-time.After(time.Second):
+		t.Error("Name blocked while a call was in progress")
+	}
+	<-done
+}
+
+func TestExecPluginStopsWithUnsolicitedResponse(t *testing.T) {
+	path := writeHelperPlugin(t, t.TempDir(), "helper")
+
+	p, err := LoadExecPlugin(path)
+	if err != nil {
+		t.Fatalf("LoadExecPlugin failed: %v", err)
+	}
+	if err := p.HandleEvent(context.Background(), &pluginapi.ThresholdEvent{MetricName: "unsolicited"}); err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	// The response nobody waits for must not keep the process from being stopped
+	stopped := make(chan struct{})
+	go func() {
+		p.(*execPlugin).close()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the plugin to stop")
+	}
+}
+
+func TestLoadRequiredPlugins_ExecPlugin(t *testing.T) {
+	registry := pluginapi.NewRegistry()
+
+	dir := t.TempDir()
+	writeHelperPlugin(t, dir, "helper")
+	// Files with an extension other than .so and non-executable files are not plugins
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes"), []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadRequiredPlugins(registry, dir, map[string]bool{"helper": true}); err != nil {
+		t.Fatalf("LoadRequiredPlugins failed: %v", err)
+	}
+
+	p, ok := registry.Get("helper")
+	if !ok {
+		t.Fatal("expected exec plugin to be registered")
+	}
+	p.(*execPlugin).close()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// pluginsLoaded is set once the required plugins have been loaded and assigned to thresholds.
+	pluginsLoaded atomic.Bool
+	// prometheusQuerySucceeded is set after the first successful Prometheus query of any monitor.
+	prometheusQuerySucceeded atomic.Bool
+)
+
+// stateResponse is the JSON document returned by the state endpoint
+type stateResponse struct {
+	Leader   bool            `json:"leader"`
+	Monitors []monitorStatus `json:"monitors"`
+}
+
+// newHTTPHandler returns the handler serving the health, readiness, state and metrics endpoints
+func newHTTPHandler(monitors []*monitor) http.Handler {
+	mux := http.NewServeMux()
+
+	// Liveness: the process is running and able to serve requests
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok\n"))
+	})
+
+	// Readiness: plugins are loaded and Prometheus has been queried successfully.
+	// Non-leaders do not query Prometheus, so they only wait for the plugin load.
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !pluginsLoaded.Load() {
+			http.Error(w, "plugins not loaded", http.StatusServiceUnavailable)
+			return
+		}
+		if IsLeader() && !prometheusQuerySucceeded.Load() {
+			http.Error(w, "no successful prometheus query yet", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok\n"))
+	})
+
+	// State: current threshold state of every series of every monitor
+	mux.HandleFunc("/state", func(w http.ResponseWriter, r *http.Request) {
+		response := stateResponse{
+			Leader:   IsLeader(),
+			Monitors: make([]monitorStatus, 0, len(monitors)),
+		}
+		for _, m := range monitors {
+			response.Monitors = append(response.Monitors, m.status())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			log.Error().Err(err).Msg("failed to encode state response")
+		}
+	})
+
+	// Metrics: metric-reader's own metrics in the Prometheus exposition format
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+
+	return mux
+}
+
+// startHTTPServer serves the health, readiness, state and metrics endpoints in the background
+// until ctx is cancelled. An empty address disables the server.
+func startHTTPServer(ctx context.Context, address string, monitors []*monitor) {
+	if address == "" {
+		log.Info().Msg("http server disabled")
+		return
+	}
+
+	server := &http.Server{
+		Addr:              address,
+		Handler:           newHTTPHandler(monitors),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		log.Info().Str("address", address).Msg("starting http server")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal().Err(err).Str("address", address).Msg("http server failed")
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("failed to shut down http server")
+		}
+	}()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"metric-reader/pkg/threshold"
+)
+
+func TestHealthzEndpoint(t *testing.T) {
+	handler := newHTTPHandler(nil)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected /healthz to return 200, got %d", recorder.Code)
+	}
+}
+
+func TestReadyzEndpoint(t *testing.T) {
+	defer pluginsLoaded.Store(false)
+	defer prometheusQuerySucceeded.Store(false)
+	defer leaderActive.Store(false)
+
+	handler := newHTTPHandler(nil)
+	ready := func() int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return recorder.Code
+	}
+
+	leaderActive.Store(true)
+	pluginsLoaded.Store(false)
+	prometheusQuerySucceeded.Store(false)
+
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz to return 503 before plugins are loaded, got %d", code)
+	}
+
+	pluginsLoaded.Store(true)
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz to return 503 before the first successful query, got %d", code)
+	}
+
+	prometheusQuerySucceeded.Store(true)
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("Expected /readyz to return 200 once ready, got %d", code)
+	}
+
+	// Standby replicas don't query Prometheus and are ready once plugins are loaded
+	leaderActive.Store(false)
+	prometheusQuerySucceeded.Store(false)
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("Expected /readyz to return 200 on a non-leader with plugins loaded, got %d", code)
+	}
+}
+
+func TestStateEndpoint(t *testing.T) {
+	leaderActive.Store(true)
+	defer leaderActive.Store(false)
+
+	m, err := newMonitor(MonitorConfig{
+		Name:                 "queues",
+		MetricName:           "queue_depth",
+		ThresholdOperator:    "greater_than",
+		Soft:                 &ThresholdSection{Threshold: 10, BackoffDelay: time.Minute},
+		PollingInterval:      time.Second,
+		MissingValueBehavior: "zero",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	now := time.Now()
+	vector := model.Vector{
+		{Metric: model.Metric{"queue": "a"}, Value: 50},
+		{Metric: model.Metric{"queue": "b"}, Value: 1},
+	}
+	m.processVector(context.Background(), vector, now)
+	m.processVector(context.Background(), vector, now.Add(time.Second))
+
+	recorder := httptest.NewRecorder()
+	newHTTPHandler([]*monitor{m}).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/state", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected /state to return 200, got %d", recorder.Code)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected JSON content type, got %q", contentType)
+	}
+
+	var response stateResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode state response: %v", err)
+	}
+
+	if !response.Leader {
+		t.Error("Expected leader to be reported as true")
+	}
+	if len(response.Monitors) != 1 || response.Monitors[0].Name != "queues" {
+		t.Fatalf("Expected one monitor named 'queues', got %+v", response.Monitors)
+	}
+
+	series := response.Monitors[0].Series
+	if len(series) != 2 {
+		t.Fatalf("Expected 2 series, got %d", len(series))
+	}
+	if series[0].Labels["queue"] != "a" || series[0].State != threshold.SoftThresholdActive {
+		t.Errorf("Expected series a to be SoftThresholdActive, got %+v", series[0])
+	}
+	if series[0].Levels["soft"].ThresholdStartTime == nil {
+		t.Error("Expected soft threshold start time for series a")
+	}
+	if series[0].LastValue == nil || *series[0].LastValue != 50 {
+		t.Errorf("Expected last value 50 for series a, got %v", series[0].LastValue)
+	}
+	if series[1].Labels["queue"] != "b" || series[1].State != threshold.NotBreached {
+		t.Errorf("Expected series b to be NotBreached, got %+v", series[1])
+	}
+	if len(series[1].Levels) != 0 {
+		t.Errorf("Expected unset timers to be omitted for series b, got %+v", series[1])
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"strings"
 	"sync/atomic"
@@ -31,15 +32,36 @@ func IsLeader() bool {
 	return leaderActive.Load()
 }
 
+// serviceAccountNamespace returns the namespace of the pod's service account.
+func serviceAccountNamespace() (string, error) {
+	namespaceBytes, err := os.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		return "", fmt.Errorf("unable to detect namespace from service account: %v", err)
+	}
+	namespace := strings.TrimSpace(string(namespaceBytes))
+	if namespace == "" {
+		return "", fmt.Errorf("detected namespace is empty")
+	}
+	return namespace, nil
+}
+
 // startLeaderElection initialises the optional Kubernetes leader-election process.
 // When leader-election is disabled the function simply marks the instance as leader and returns.
-func startLeaderElection(ctx context.Context, config *Config) {
+// onStartedLeading, if set, runs every time this instance becomes leader, before actions are enabled.
+func startLeaderElection(ctx context.Context, config *Config, onStartedLeading func(context.Context)) {
 	zerologAdapter := zerologr.New(&log.Logger)
 	klog.SetLogger(zerologAdapter)
 
+	becomeLeader := func(c context.Context) {
+		if onStartedLeading != nil {
+			onStartedLeading(c)
+		}
+		leaderActive.Store(true)
+	}
+
 	// Leader-election can be opted-out via config.
 	if !config.LeaderElectionEnabled {
-		leaderActive.Store(true)
+		becomeLeader(ctx)
 		log.Info().Msg("leader election disabled, executing actions on every replica")
 		return
 	}
@@ -53,23 +75,17 @@ func startLeaderElection(ctx context.Context, config *Config) {
 	if err != nil {
 		// If we cannot obtain an in-cluster config (e.g. when running locally)
 		// assume single-replica and skip leader-election.
-		leaderActive.Store(true)
+		becomeLeader(ctx)
 		log.Warn().Err(err).Msg("unable to get in-cluster config, skipping leader election")
 		return
 	}
 
 	// If namespace is not set, try to detect it from the service account
 	if lockNamespace == "" {
-		namespaceBytes, err := os.ReadFile(serviceAccountNamespaceFile)
+		lockNamespace, err = serviceAccountNamespace()
 		if err != nil {
-			leaderActive.Store(true)
-			log.Warn().Err(err).Msg("unable to detect namespace from service account, skipping leader election")
-			return
-		}
-		lockNamespace = strings.TrimSpace(string(namespaceBytes))
-		if lockNamespace == "" {
-			leaderActive.Store(true)
-			log.Warn().Msg("detected namespace is empty, skipping leader election")
+			becomeLeader(ctx)
+			log.Warn().Err(err).Msg("skipping leader election")
 			return
 		}
 		log.Info().Str("namespace", lockNamespace).Msg("auto-detected namespace from service account")
@@ -77,7 +93,7 @@ func startLeaderElection(ctx context.Context, config *Config) {
 
 	client, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
-		leaderActive.Store(true)
+		becomeLeader(ctx)
 		log.Warn().Err(err).Msg("unable to build kubernetes client, skipping leader election")
 		return
 	}
@@ -102,7 +118,7 @@ func startLeaderElection(ctx context.Context, config *Config) {
 		RetryPeriod:     2 * time.Second,
 		Callbacks: leaderelection.LeaderCallbacks{
 			OnStartedLeading: func(c context.Context) {
-				leaderActive.Store(true)
+				becomeLeader(c)
 				log.Info().Msg("gained leadership; actions will be executed from this replica")
 			},
 			OnStoppedLeading: func() {
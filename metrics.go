@@ -0,0 +1,109 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// metricsRegistry holds metric-reader's own metrics exposed on /metrics
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	monitorState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "metric_reader_monitor_state",
+		Help: "Most severe threshold state across the series of a monitor (0 = NotBreached, n = active state of the n-th threshold level, so 1 = SoftThresholdActive and 2 = HardThresholdActive).",
+	}, []string{"monitor"})
+
+	stateTransitionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "metric_reader_state_transitions_total",
+		Help: "Total number of threshold state machine transitions.",
+	}, []string{"monitor", "from", "to"})
+
+	pluginExecutionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "metric_reader_plugin_executions_total",
+		Help: "Total number of plugin executions by result (success or error).",
+	}, []string{"plugin", "result"})
+
+	pluginExecutionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "metric_reader_plugin_execution_duration_seconds",
+		Help:    "Duration of plugin executions.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 4, 9),
+	}, []string{"plugin"})
+
+	pluginRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "metric_reader_plugin_retries_total",
+		Help: "Total number of retries of failed plugin executions.",
+	}, []string{"plugin"})
+
+	actionFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "metric_reader_action_failures_total",
+		Help: "Total number of plugin executions that failed after exhausting their retries.",
+	}, []string{"monitor", "level", "plugin"})
+
+	dryRunActionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "metric_reader_dry_run_actions_total",
+		Help: "Total number of plugin executions skipped because the threshold is in dry-run mode.",
+	}, []string{"monitor", "level", "plugin"})
+
+	actionsDroppedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "metric_reader_actions_dropped_total",
+		Help: "Total number of plugin executions dropped because the action pool queue was full.",
+	}, []string{"monitor", "level", "plugin"})
+
+	actionsQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "metric_reader_actions_queued",
+		Help: "Number of plugin executions waiting for a worker of the action pool.",
+	})
+
+	actionsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "metric_reader_actions_in_flight",
+		Help: "Number of plugin executions running on the action pool.",
+	})
+
+	prometheusQueryErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "metric_reader_prometheus_query_errors_total",
+		Help: "Total number of failed Prometheus queries.",
+	}, []string{"monitor"})
+
+	prometheusQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "metric_reader_prometheus_query_duration_seconds",
+		Help:    "Duration of Prometheus queries.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"monitor"})
+
+	lastObservedValue = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "metric_reader_last_value",
+		Help: "Last value observed for a series.",
+	}, []string{"monitor", "series"})
+
+	leaderStatus = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "metric_reader_leader",
+		Help: "Whether this instance currently holds the leader lock (1) or not (0).",
+	}, func() float64 {
+		if leaderActive.Load() {
+			return 1
+		}
+		return 0
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		monitorState,
+		stateTransitionsTotal,
+		pluginExecutionsTotal,
+		pluginExecutionDuration,
+		pluginRetriesTotal,
+		actionFailuresTotal,
+		dryRunActionsTotal,
+		actionsDroppedTotal,
+		actionsQueued,
+		actionsInFlight,
+		prometheusQueryErrorsTotal,
+		prometheusQueryDuration,
+		lastObservedValue,
+		leaderStatus,
+	)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	pluginapi "metric-reader/pkg/plugin"
+	"metric-reader/pkg/threshold"
+)
+
+func TestStateMetrics(t *testing.T) {
+	leaderActive.Store(true)
+	defer leaderActive.Store(false)
+
+	m, err := newMonitor(MonitorConfig{
+		Name:                 "metrics_state",
+		MetricName:           "queue_depth",
+		ThresholdOperator:    "greater_than",
+		Soft:                 &ThresholdSection{Threshold: 10},
+		PollingInterval:      time.Second,
+		MissingValueBehavior: "zero",
+		SeriesStaleness:      time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	high := model.Metric{"queue": "high"}
+	vector := model.Vector{{Metric: high, Value: 50}}
+
+	now := time.Now()
+	m.processVector(context.Background(), vector, now)
+	if got := testutil.ToFloat64(monitorState.WithLabelValues("metrics_state")); got != 0 {
+		t.Errorf("Expected monitor state 0 before the soft duration elapsed, got %v", got)
+	}
+
+	m.processVector(context.Background(), vector, now.Add(time.Second))
+	if got := testutil.ToFloat64(monitorState.WithLabelValues("metrics_state")); got != 1 {
+		t.Errorf("Expected monitor state 1 once the soft threshold is active, got %v", got)
+	}
+
+	transitions := stateTransitionsTotal.WithLabelValues("metrics_state", string(threshold.NotBreached), string(threshold.SoftThresholdActive))
+	if got := testutil.ToFloat64(transitions); got != 1 {
+		t.Errorf("Expected 1 NotBreached -> SoftThresholdActive transition, got %v", got)
+	}
+
+	if got := testutil.ToFloat64(lastObservedValue.WithLabelValues("metrics_state", high.String())); got != 50 {
+		t.Errorf("Expected last value 50, got %v", got)
+	}
+
+	// The last value of a garbage-collected series is no longer exported
+	m.processVector(context.Background(), model.Vector{}, now.Add(2*time.Minute))
+	if lastObservedValue.DeleteLabelValues("metrics_state", high.String()) {
+		t.Error("Expected last value of stale series to be removed")
+	}
+}
+
+func TestPluginExecutionMetrics(t *testing.T) {
+	plugin := &metricsTestPlugin{}
+	event := &pluginapi.ThresholdEvent{MetricName: "up", Value: 1}
+
+	if err := executePlugin(context.Background(), plugin, event); err != nil {
+		t.Fatalf("Expected successful execution, got %v", err)
+	}
+	plugin.err = errors.New("boom")
+	if err := executePlugin(context.Background(), plugin, event); err == nil {
+		t.Fatal("Expected plugin error to be returned")
+	}
+
+	if got := testutil.ToFloat64(pluginExecutionsTotal.WithLabelValues("metrics_test_plugin", "success")); got != 1 {
+		t.Errorf("Expected 1 successful execution, got %v", got)
+	}
+	if got := testutil.ToFloat64(pluginExecutionsTotal.WithLabelValues("metrics_test_plugin", "error")); got != 1 {
+		t.Errorf("Expected 1 failed execution, got %v", got)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	leaderActive.Store(true)
+	defer leaderActive.Store(false)
+
+	recorder := httptest.NewRecorder()
+	newHTTPHandler(nil).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected /metrics to return 200, got %d", recorder.Code)
+	}
+
+	body := recorder.Body.String()
+	for _, want := range []string{"metric_reader_leader 1", "go_goroutines"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected /metrics output to contain %q", want)
+		}
+	}
+}
+
+// metricsTestPlugin returns a configurable error
+type metricsTestPlugin struct {
+	err error
+}
+
+func (p *metricsTestPlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
+	return p.err
+}
+
+func (p *metricsTestPlugin) Name() string {
+	return "metrics_test_plugin"
+}
+
+func (p *metricsTestPlugin) ValidateConfig() error {
+	return nil
+}
@@ -0,0 +1,806 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	pluginapi "metric-reader/pkg/plugin"
+	"metric-reader/pkg/threshold"
+)
+
+// series tracks the threshold state of a single time series returned by a monitor query
+type series struct {
+	state        *threshold.Series
+	lastValue    float64
+	hasLastValue bool
+	lastSeen     time.Time
+}
+
+// chainSettings holds how the plugins configured for a threshold level are chained
+type chainSettings struct {
+	execution     chainExecution
+	failurePolicy chainFailurePolicy
+}
+
+// monitor watches a single Prometheus query and drives one threshold state machine
+// per distinct series in the query result
+type monitor struct {
+	name                 string
+	metricName           string
+	query                string
+	pollingInterval      time.Duration
+	missingValueBehavior missingValueBehavior
+	seriesStaleness      time.Duration
+	// clock is shared with the state machine; see useClock
+	clock threshold.Clock
+
+	// engine runs the threshold state machine; nil when no threshold is configured
+	engine *threshold.Engine
+	// chains holds the chain settings of each configured threshold level by level name
+	chains map[string]chainSettings
+
+	// baseline configures baseline thresholds; baselines holds the baseline of each series,
+	// recomputed from the query history by refreshBaselines and guarded by mu
+	baseline           baselineSettings
+	baselines          map[model.Fingerprint]*threshold.Baseline
+	baselinesUpdatedAt time.Time
+	baselinesFailedAt  time.Time
+
+	// mu guards series, which is read concurrently by the HTTP state endpoint
+	mu     sync.Mutex
+	series map[model.Fingerprint]*series
+
+	// persister saves the state machine state when it changes; nil disables persistence.
+	// persisted is the last snapshot it saved, guarded by mu.
+	persister *statePersister
+	persisted []persistedSeries
+
+	// onTransition is attached to every tracked series; backtests use it to record the timeline
+	onTransition func(m *monitor, s *threshold.Series, oldState threshold.State, newState threshold.State)
+
+	logger zerolog.Logger
+}
+
+// newMonitor builds a monitor from its configuration. Plugins are not resolved here;
+// call assignPlugins once the required plugins have been loaded.
+func newMonitor(cfg MonitorConfig) (*monitor, error) {
+	if cfg.MetricName == "" && cfg.Query == "" {
+		return nil, fmt.Errorf("either QUERY or METRIC_NAME is required")
+	}
+	if cfg.PollingInterval <= 0 {
+		return nil, fmt.Errorf("polling interval must be greater than 0")
+	}
+	if cfg.SeriesStaleness < 0 {
+		return nil, fmt.Errorf("series staleness must not be negative")
+	}
+
+	m := &monitor{
+		name:            cfg.Name,
+		metricName:      cfg.MetricName,
+		pollingInterval: cfg.PollingInterval,
+		seriesStaleness: cfg.SeriesStaleness,
+		clock:           threshold.SystemClock{},
+		series:          make(map[model.Fingerprint]*series),
+		logger:          log.With().Str("monitor", cfg.Name).Logger(),
+	}
+
+	// Use the PromQL expression when set, otherwise build the query from metric name and label filters
+	switch {
+	case cfg.Query != "":
+		m.query = cfg.Query
+		if cfg.LabelFilters != "" {
+			m.logger.Warn().
+				Str("label_filters", cfg.LabelFilters).
+				Msg("QUERY is set, ignoring LABEL_FILTERS")
+		}
+	case cfg.LabelFilters != "":
+		m.query = fmt.Sprintf("%s{%s}", cfg.MetricName, cfg.LabelFilters)
+	default:
+		m.query = cfg.MetricName
+	}
+
+	if err := validateQuery(m.query); err != nil {
+		return nil, err
+	}
+
+	// Plugins receive the metric name; fall back to the query for expressions without one
+	if m.metricName == "" {
+		m.metricName = m.query
+	}
+
+	// Trend conditions evaluate the thresholds against the slope or prediction of the query
+	query, err := conditionQuery(m.query, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if query != m.query {
+		if err := validateQuery(query); err != nil {
+			return nil, err
+		}
+		m.query = query
+	}
+
+	behavior, err := parseMissingValueBehavior(cfg.MissingValueBehavior)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MISSING_VALUE_BEHAVIOR value %q: %v", cfg.MissingValueBehavior, err)
+	}
+	m.missingValueBehavior = behavior
+
+	if m.baseline, err = newBaselineSettings(cfg); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Levels) > 0 && (cfg.Soft != nil || cfg.Hard != nil) {
+		return nil, fmt.Errorf("[[levels]] cannot be combined with the [soft] and [hard] sections")
+	}
+
+	sections := cfg.ThresholdLevels()
+	if cfg.ThresholdOperator != "" && len(sections) > 0 {
+		operator, err := threshold.ParseOperator(cfg.ThresholdOperator)
+		if err != nil {
+			return nil, fmt.Errorf("invalid THRESHOLD_OPERATOR value: %v", err)
+		}
+
+		engineCfg := threshold.Config{
+			Monitor:      m.name,
+			MetricName:   m.metricName,
+			Query:        m.query,
+			Operator:     operator,
+			Relative:     m.baseline.enabled(),
+			Clock:        m.clock,
+			IsLeader:     IsLeader,
+			Execute:      executePlugin,
+			OnTransition: m.recordTransition,
+			OnDryRun:     m.recordDryRun,
+			Logger:       &m.logger,
+		}
+		m.chains = make(map[string]chainSettings)
+		dryRun := cfg.DryRun != nil && *cfg.DryRun
+
+		for i := range sections {
+			level, chain, err := newLevel(&sections[i].ThresholdSection, sections[i].Name, operator, dryRun)
+			if err != nil {
+				return nil, err
+			}
+			engineCfg.Levels = append(engineCfg.Levels, level)
+			m.chains[level.Name] = chain
+		}
+
+		if m.engine, err = threshold.NewEngine(engineCfg); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// useActionPool runs the monitor's actions on the action pool
+func (m *monitor) useActionPool(pool *actionPool) {
+	if m.engine != nil {
+		m.engine.UseDispatcher(pool, &m.mu, m.lookupSeries)
+	}
+}
+
+// lookupSeries returns the state of the tracked series with the given labels, nil when it
+// isn't tracked. The caller must hold m.mu.
+func (m *monitor) lookupSeries(labels model.Metric) *threshold.Series {
+	if s, ok := m.series[labels.Fingerprint()]; ok {
+		return s.state
+	}
+	return nil
+}
+
+// useClock makes the monitor and its state machine read the time from clock
+func (m *monitor) useClock(clock threshold.Clock) {
+	m.clock = clock
+	if m.engine != nil {
+		m.engine.UseClock(clock)
+	}
+}
+
+// recordTransition counts a state transition of one of the monitor's series
+func (m *monitor) recordTransition(s *threshold.Series, oldState threshold.State, newState threshold.State) {
+	stateTransitionsTotal.WithLabelValues(m.name, string(oldState), string(newState)).Inc()
+	if m.onTransition != nil {
+		m.onTransition(m, s, oldState, newState)
+	}
+}
+
+// recordDryRun counts a plugin execution skipped by a dry-run threshold
+func (m *monitor) recordDryRun(s *threshold.Series, p pluginapi.ActionPlugin, event *pluginapi.ThresholdEvent) {
+	dryRunActionsTotal.WithLabelValues(m.name, event.Level, p.Name()).Inc()
+}
+
+// newLevel builds a threshold level from its configuration section. dryRun is the monitor's
+// dry-run setting, which the section may override.
+func newLevel(section *ThresholdSection, name string, operator threshold.Operator, dryRun bool) (*threshold.Level, chainSettings, error) {
+	thresholdType := strings.ToUpper(name)
+	switch {
+	case operator.IsRange() && (section.Lower == nil || section.Upper == nil):
+		return nil, chainSettings{}, fmt.Errorf("%s threshold requires lower and upper with the %s operator", name, operator)
+	case !operator.IsRange() && (section.Lower != nil || section.Upper != nil):
+		return nil, chainSettings{}, fmt.Errorf("%s threshold lower and upper are only supported by the outside_range and inside_range operators", name)
+	}
+	execution, err := parseChainExecution(section.Execution)
+	if err != nil {
+		return nil, chainSettings{}, fmt.Errorf("invalid %s_EXECUTION value %q: %v", thresholdType, section.Execution, err)
+	}
+	failurePolicy, err := parseChainFailurePolicy(section.FailurePolicy)
+	if err != nil {
+		return nil, chainSettings{}, fmt.Errorf("invalid %s_FAILURE_POLICY value %q: %v", thresholdType, section.FailurePolicy, err)
+	}
+	if section.DryRun != nil {
+		dryRun = *section.DryRun
+	}
+	level := &threshold.Level{
+		Name:          name,
+		Value:         section.Threshold,
+		Duration:      section.Duration,
+		BackoffDelay:  section.BackoffDelay,
+		ClearValue:    section.ClearThreshold,
+		Hysteresis:    section.Hysteresis,
+		ClearDuration: section.ClearDuration,
+		DryRun:        dryRun,
+	}
+	if operator.IsRange() {
+		level.Lower, level.Upper = *section.Lower, *section.Upper
+	}
+	return level, chainSettings{execution: execution, failurePolicy: failurePolicy}, nil
+}
+
+// validateQuery parses a PromQL expression so that syntax errors fail at startup.
+// Only expressions returning an instant vector or a scalar can be evaluated against thresholds.
+func validateQuery(query string) error {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return fmt.Errorf("invalid PromQL query %q: %v", query, err)
+	}
+
+	switch expr.Type() {
+	case parser.ValueTypeVector, parser.ValueTypeScalar:
+		return nil
+	default:
+		return fmt.Errorf("PromQL query %q returns a %s, expected an instant vector or scalar", query, expr.Type())
+	}
+}
+
+// requiredPlugins adds the names of the plugins referenced by the monitor configuration to plugins
+func requiredPlugins(cfg MonitorConfig, plugins map[string]bool) {
+	for _, section := range cfg.ThresholdLevels() {
+		for _, name := range section.PluginNames() {
+			plugins[name] = true
+		}
+		if name := recoveryPluginName(section); name != "" {
+			plugins[name] = true
+		}
+	}
+}
+
+// recoveryPluginName returns the recovery plugin of a threshold. The alertmanager plugin re-sends
+// its alerts until they are resolved, so it is also the recovery plugin of the thresholds it fires
+// for unless another recovery plugin is configured.
+func recoveryPluginName(section LevelSection) string {
+	if section.RecoveryPlugin != "" {
+		return section.RecoveryPlugin
+	}
+	if slices.Contains(section.PluginNames(), "alertmanager") {
+		return "alertmanager"
+	}
+	return ""
+}
+
+// assignPlugins resolves the configured plugins from the registry and attaches them to the thresholds
+func (m *monitor) assignPlugins(registry *pluginapi.Registry, cfg MonitorConfig) {
+	if m.engine == nil {
+		return
+	}
+	for _, section := range cfg.ThresholdLevels() {
+		level := m.engine.Level(section.Name)
+		thresholdType := strings.ToUpper(section.Name)
+		validateThresholdPlugin(registry, section.PluginNames(), level, m.chains[section.Name], thresholdType)
+		if section.RecoveryPlugin != "" && section.RecoveryPlugin != "alertmanager" && slices.Contains(section.PluginNames(), "alertmanager") {
+			m.logger.Warn().
+				Str("threshold_level", section.Name).
+				Str("recovery_plugin", section.RecoveryPlugin).
+				Msg("alertmanager plugin is not the recovery plugin, its alerts keep firing after the series recovers")
+		}
+		validateRecoveryPlugin(registry, recoveryPluginName(section), level, thresholdType)
+	}
+}
+
+// logConfiguration logs the effective monitor configuration at startup
+func (m *monitor) logConfiguration() {
+	logEvent := m.logger.Info().
+		Str("metric_name", m.metricName).
+		Dur("polling_interval", m.pollingInterval).
+		Str("query", m.query).
+		Str("missing_value_behavior", string(m.missingValueBehavior)).
+		Dur("series_staleness", m.seriesStaleness)
+
+	if m.baseline.enabled() {
+		logEvent = logEvent.Dur("baseline_window", m.baseline.window).
+			Dur("baseline_offset", m.baseline.offset).
+			Dur("baseline_refresh", m.baseline.refresh)
+	}
+
+	if m.engine != nil {
+		logEvent = logEvent.Str("threshold_operator", string(m.engine.Operator()))
+		for _, level := range m.engine.Levels() {
+			if m.engine.Operator().IsRange() {
+				logEvent = logEvent.Float64(level.Name+"_lower", level.Lower).Float64(level.Name+"_upper", level.Upper)
+			} else {
+				logEvent = logEvent.Float64(level.Name+"_threshold", level.Value)
+			}
+			logEvent = logEvent.Dur(level.Name+"_duration", level.Duration).
+				Dur(level.Name+"_backoff_delay", level.BackoffDelay).
+				Bool(level.Name+"_dry_run", level.DryRun)
+			if level.ClearValue != nil {
+				logEvent = logEvent.Float64(level.Name+"_clear_threshold", *level.ClearValue)
+			}
+			if level.Hysteresis != 0 {
+				logEvent = logEvent.Float64(level.Name+"_hysteresis", level.Hysteresis)
+			}
+			if level.ClearDuration != 0 {
+				logEvent = logEvent.Dur(level.Name+"_clear_duration", level.ClearDuration)
+			}
+			if level.Plugin != nil {
+				logEvent = logEvent.Str(level.Name+"_threshold_plugin", level.Plugin.Name())
+			}
+		}
+	}
+
+	logEvent.Msg("initializing monitor")
+}
+
+// run polls Prometheus on the monitor's interval until ctx is cancelled
+func (m *monitor) run(ctx context.Context, v1api v1.API) {
+	ticker := time.NewTicker(m.pollingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Only process queries and state changes on the elected leader
+		// Non-leaders should only wait until they become leaders
+		if !IsLeader() {
+			continue
+		}
+
+		m.poll(ctx, v1api)
+	}
+}
+
+// poll runs the monitor query once and feeds the result into the state machine
+func (m *monitor) poll(ctx context.Context, v1api v1.API) {
+	queryCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	start := time.Now()
+	result, warnings, err := v1api.Query(queryCtx, m.query, start)
+	prometheusQueryDuration.WithLabelValues(m.name).Observe(time.Since(start).Seconds())
+	cancel()
+
+	if err != nil {
+		prometheusQueryErrorsTotal.WithLabelValues(m.name).Inc()
+		m.logger.Error().
+			Err(err).
+			Str("query", m.query).
+			Msgf("error querying prometheus: %v", err)
+		return
+	}
+	prometheusQuerySucceeded.Store(true)
+
+	if len(warnings) > 0 {
+		m.logger.Warn().
+			Strs("warnings", warnings).
+			Str("query", m.query).
+			Msgf("prometheus query warnings: %v", warnings)
+	}
+
+	var vector model.Vector
+	switch result.Type() {
+	case model.ValVector:
+		vector = result.(model.Vector)
+	case model.ValScalar:
+		// Scalar expressions are treated as a single series without labels
+		scalar := result.(*model.Scalar)
+		vector = model.Vector{{Metric: model.Metric{}, Value: scalar.Value, Timestamp: scalar.Timestamp}}
+	default:
+		m.logger.Error().
+			Str("query", m.query).
+			Str("result_type", result.Type().String()).
+			Msg("unexpected result type")
+		return
+	}
+
+	now := m.clock.Now()
+	m.refreshBaselines(ctx, v1api, now)
+	m.processVector(ctx, vector, now)
+}
+
+// processVector feeds every series in the query result into its own state machine.
+// Series that are absent from the result are handled according to the missing value
+// behavior until they have been absent for longer than the staleness window.
+func (m *monitor) processVector(ctx context.Context, vector model.Vector, now time.Time) {
+	// The state is written to the store after releasing m.mu, so that a slow store
+	// doesn't block the state endpoint
+	if snapshot, changed := m.evaluateVector(ctx, vector, now); changed {
+		m.persistState(ctx, snapshot)
+	}
+}
+
+// evaluateVector does the work of processVector under m.mu and returns the state to persist,
+// if it changed
+func (m *monitor) evaluateVector(ctx context.Context, vector model.Vector, now time.Time) ([]persistedSeries, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	present := make(map[model.Fingerprint]bool, len(vector))
+
+	for _, sample := range vector {
+		fingerprint := sample.Metric.Fingerprint()
+		present[fingerprint] = true
+
+		s := m.trackSeries(fingerprint, sample.Metric, now)
+		value := float64(sample.Value)
+
+		m.logger.Debug().
+			Str("query", m.query).
+			Str("series", sample.Metric.String()).
+			Float64("value", value).
+			Msg("reading metric value")
+
+		// Update last value for potential reuse
+		s.lastValue = value
+		s.hasLastValue = true
+		s.lastSeen = now
+		lastObservedValue.WithLabelValues(m.name, sample.Metric.String()).Set(value)
+
+		if m.baseline.enabled() {
+			s.state.Baseline = m.baselines[fingerprint]
+		}
+		m.evaluate(ctx, s, value)
+	}
+
+	// When the query returns nothing and no series is tracked, track the empty label set
+	// so that the missing value behavior still applies to a metric that has never reported.
+	// It stands in for the real series only until they report.
+	emptyFingerprint := model.Metric{}.Fingerprint()
+	if len(vector) == 0 {
+		if len(m.series) == 0 {
+			m.trackSeries(emptyFingerprint, model.Metric{}, now)
+		}
+		if s, ok := m.series[emptyFingerprint]; ok {
+			s.lastSeen = now
+		}
+	} else if s, ok := m.series[emptyFingerprint]; ok && !present[emptyFingerprint] {
+		m.logger.Info().
+			Str("state", string(s.state.State)).
+			Msg("query returned series, discarding the state tracked while it returned none")
+		delete(m.series, emptyFingerprint)
+		lastObservedValue.DeleteLabelValues(m.name, s.state.Labels.String())
+	}
+
+	for fingerprint, s := range m.series {
+		if present[fingerprint] {
+			continue
+		}
+
+		// Garbage-collect series that disappeared for longer than the staleness window
+		if m.seriesStaleness > 0 && now.Sub(s.lastSeen) > m.seriesStaleness {
+			m.logger.Info().
+				Str("series", s.state.Labels.String()).
+				Str("state", string(s.state.State)).
+				Time("last_seen", s.lastSeen).
+				Msg("series is stale, discarding its state")
+			delete(m.series, fingerprint)
+			lastObservedValue.DeleteLabelValues(m.name, s.state.Labels.String())
+			continue
+		}
+
+		m.handleMissingValue(ctx, s)
+	}
+
+	m.updateStateMetric()
+	return m.changedState()
+}
+
+// updateStateMetric reports the most severe state across all tracked series
+func (m *monitor) updateStateMetric() {
+	severity := 0
+	if m.engine != nil {
+		for _, s := range m.series {
+			if v := m.engine.Severity(s.state.State); v > severity {
+				severity = v
+			}
+		}
+	}
+	monitorState.WithLabelValues(m.name).Set(float64(severity))
+}
+
+// trackSeries returns the tracked series for a fingerprint, creating it when first seen
+func (m *monitor) trackSeries(fingerprint model.Fingerprint, metric model.Metric, now time.Time) *series {
+	if s, ok := m.series[fingerprint]; ok {
+		return s
+	}
+
+	s := &series{state: threshold.NewSeries(metric), lastSeen: now}
+	m.series[fingerprint] = s
+
+	m.logger.Debug().
+		Str("series", metric.String()).
+		Str("state", string(s.state.State)).
+		Msg("initialized threshold state machine for series")
+
+	return s
+}
+
+// handleMissingValue applies the missing value behavior to a series absent from the query result
+func (m *monitor) handleMissingValue(ctx context.Context, s *series) {
+	m.logger.Warn().
+		Str("query", m.query).
+		Str("series", s.state.Labels.String()).
+		Str("missing_value_behavior", string(m.missingValueBehavior)).
+		Msg("no data found for metric")
+
+	switch m.missingValueBehavior {
+	case missingValueBehaviorLastValue:
+		if s.hasLastValue {
+			m.logger.Info().
+				Str("query", m.query).
+				Str("series", s.state.Labels.String()).
+				Float64("value", s.lastValue).
+				Msg("using last known value for missing metric")
+			m.evaluate(ctx, s, s.lastValue)
+		} else {
+			m.logger.Warn().
+				Str("query", m.query).
+				Str("series", s.state.Labels.String()).
+				Msg("no last value available, skipping threshold check")
+		}
+	case missingValueBehaviorZero:
+		m.logger.Info().
+			Str("query", m.query).
+			Str("series", s.state.Labels.String()).
+			Float64("value", 0).
+			Msg("using zero for missing metric")
+		m.evaluate(ctx, s, 0)
+	case missingValueBehaviorAssumeBreached:
+		// Don't process thresholds normally for assume_breached
+		if m.engine != nil {
+			m.engine.AssumeBreached(ctx, s.state)
+		}
+	}
+}
+
+// evaluate processes a value through the series state machine if thresholds are configured
+func (m *monitor) evaluate(ctx context.Context, s *series, value float64) {
+	if m.engine == nil {
+		return
+	}
+	m.engine.Evaluate(ctx, s.state, value)
+}
+
+// seriesStatus is the JSON representation of a series state exposed by the state endpoint
+type seriesStatus struct {
+	Labels map[string]string `json:"labels"`
+	State  threshold.State   `json:"state"`
+	// Levels holds the state of the series for each threshold level by level name
+	Levels    map[string]levelStatus `json:"levels,omitempty"`
+	LastValue *float64               `json:"last_value,omitempty"`
+	LastSeen  time.Time              `json:"last_seen"`
+	// Baseline is the history the baseline thresholds of the series are computed from
+	Baseline *threshold.Baseline `json:"baseline,omitempty"`
+}
+
+// levelStatus is the JSON representation of the state of a series for one threshold level
+type levelStatus struct {
+	ThresholdStartTime *time.Time `json:"threshold_start_time,omitempty"`
+	BackoffUntil       *time.Time `json:"backoff_until,omitempty"`
+	// Set while the active level's clear threshold is met, until its clear duration passes
+	ClearStartTime *time.Time `json:"clear_start_time,omitempty"`
+	// Set while the level's action runs on the action pool
+	ActionInFlight bool `json:"action_in_flight,omitempty"`
+	// Set when the level's action failed after exhausting its retries
+	ActionFailedAt *time.Time `json:"action_failed_at,omitempty"`
+	ActionError    string     `json:"action_error,omitempty"`
+}
+
+// monitorStatus is the JSON representation of a monitor exposed by the state endpoint
+type monitorStatus struct {
+	Name   string         `json:"name"`
+	Query  string         `json:"query"`
+	Series []seriesStatus `json:"series"`
+}
+
+// optionalTime returns nil for zero times so they are omitted from JSON output
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// status returns a snapshot of the state of every series tracked by the monitor
+func (m *monitor) status() monitorStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Sort series by labels so the output is stable between requests
+	tracked := make([]*series, 0, len(m.series))
+	for _, s := range m.series {
+		tracked = append(tracked, s)
+	}
+	sort.Slice(tracked, func(i, j int) bool {
+		return tracked[i].state.Labels.String() < tracked[j].state.Labels.String()
+	})
+
+	status := monitorStatus{
+		Name:   m.name,
+		Query:  m.query,
+		Series: make([]seriesStatus, 0, len(tracked)),
+	}
+	for _, s := range tracked {
+		seriesStatus := seriesStatus{
+			Labels:   s.state.LabelMap(),
+			State:    s.state.State,
+			LastSeen: s.lastSeen,
+			Baseline: s.state.Baseline,
+		}
+		for name, level := range s.state.Levels {
+			status := levelStatus{
+				ThresholdStartTime: optionalTime(level.StartTime),
+				BackoffUntil:       optionalTime(level.BackoffUntil),
+				ClearStartTime:     optionalTime(level.ClearStartTime),
+				ActionInFlight:     level.ActionInFlight,
+				ActionFailedAt:     optionalTime(level.ActionFailedAt),
+				ActionError:        level.ActionError,
+			}
+			if status == (levelStatus{}) {
+				continue
+			}
+			if seriesStatus.Levels == nil {
+				seriesStatus.Levels = make(map[string]levelStatus)
+			}
+			seriesStatus.Levels[name] = status
+		}
+		if s.hasLastValue {
+			lastValue := s.lastValue
+			seriesStatus.LastValue = &lastValue
+		}
+		status.Series = append(status.Series, seriesStatus)
+	}
+
+	return status
+}
+
+// persistedSeries returns a snapshot of the state to persist, sorted by labels.
+// Last values are not persisted since they change on every poll.
+func (m *monitor) persistedSeries() []persistedSeries {
+	snapshot := make([]persistedSeries, 0, len(m.series))
+	for _, s := range m.series {
+		series := persistedSeries{
+			Labels:    s.state.LabelMap(),
+			State:     s.state.State,
+			PeakValue: s.state.PeakValue,
+		}
+		for name, level := range s.state.Levels {
+			persisted := persistedLevel{
+				ThresholdStartTime: optionalTime(level.StartTime),
+				BackoffUntil:       optionalTime(level.BackoffUntil),
+				ActiveSince:        optionalTime(level.ActiveSince),
+				ClearStartTime:     optionalTime(level.ClearStartTime),
+				Attempts:           level.Attempts,
+			}
+			if persisted == (persistedLevel{}) {
+				continue
+			}
+			if series.Levels == nil {
+				series.Levels = make(map[string]persistedLevel)
+			}
+			series.Levels[name] = persisted
+		}
+		snapshot = append(snapshot, series)
+	}
+	sort.Slice(snapshot, func(i, j int) bool {
+		return model.LabelsToSignature(snapshot[i].Labels) < model.LabelsToSignature(snapshot[j].Labels)
+	})
+	return snapshot
+}
+
+// changedState returns a snapshot of the state machine state when persistence is enabled
+// and the state changed since the last save. Must be called with m.mu held.
+func (m *monitor) changedState() ([]persistedSeries, bool) {
+	if m.persister == nil {
+		return nil, false
+	}
+
+	snapshot := m.persistedSeries()
+	if (len(snapshot) == 0 && len(m.persisted) == 0) || reflect.DeepEqual(snapshot, m.persisted) {
+		return nil, false
+	}
+	return snapshot, true
+}
+
+// persistState saves a snapshot returned by changedState. The store may be remote, so it
+// must be called without m.mu held.
+func (m *monitor) persistState(ctx context.Context, snapshot []persistedSeries) {
+	if err := m.persister.save(ctx, m.name, snapshot); err != nil {
+		m.logger.Error().Err(err).Msg("failed to persist state")
+		return
+	}
+
+	m.mu.Lock()
+	m.persisted = snapshot
+	m.mu.Unlock()
+}
+
+// restoreState replaces the tracked series with previously persisted state.
+// Restored series count as seen at now, so they are only discarded after a full staleness window.
+func (m *monitor) restoreState(persisted []persistedSeries, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.series = make(map[model.Fingerprint]*series, len(persisted))
+	for _, p := range persisted {
+		metric := make(model.Metric, len(p.Labels))
+		for name, value := range p.Labels {
+			metric[model.LabelName(name)] = model.LabelValue(value)
+		}
+
+		state := threshold.NewSeries(metric)
+		state.State = p.State
+		state.PeakValue = p.PeakValue
+		for name, persisted := range p.Levels {
+			level := state.Level(name)
+			level.Attempts = persisted.Attempts
+			if persisted.ThresholdStartTime != nil {
+				level.StartTime = *persisted.ThresholdStartTime
+			}
+			if persisted.BackoffUntil != nil {
+				level.BackoffUntil = *persisted.BackoffUntil
+			}
+			if persisted.ActiveSince != nil {
+				level.ActiveSince = *persisted.ActiveSince
+			}
+			if persisted.ClearStartTime != nil {
+				level.ClearStartTime = *persisted.ClearStartTime
+			}
+		}
+
+		// The levels may have changed since the state was saved
+		if m.engine == nil || m.engine.Severity(state.State) < 0 {
+			if state.State != threshold.NotBreached {
+				m.logger.Warn().
+					Str("series", metric.String()).
+					Str("state", string(state.State)).
+					Msg("restored state is not a configured threshold level, resetting it to NotBreached")
+			}
+			state.State = threshold.NotBreached
+			state.PeakValue = 0
+		}
+
+		m.series[metric.Fingerprint()] = &series{state: state, lastSeen: now}
+
+		m.logger.Info().
+			Str("series", metric.String()).
+			Str("state", string(state.State)).
+			Msg("restored threshold state for series")
+	}
+
+	m.persisted = m.persistedSeries()
+	m.updateStateMetric()
+}
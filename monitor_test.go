@@ -0,0 +1,587 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	pluginapi "metric-reader/pkg/plugin"
+	"metric-reader/pkg/threshold"
+)
+
+func TestNewMonitor_BuildsQueryAndThresholds(t *testing.T) {
+	m, err := newMonitor(MonitorConfig{
+		Name:                 "cpu",
+		MetricName:           "node_cpu_usage",
+		LabelFilters:         `instance="a"`,
+		ThresholdOperator:    "greater_than",
+		Soft:                 &ThresholdSection{Threshold: 80, Duration: 30 * time.Second, BackoffDelay: time.Minute},
+		Hard:                 &ThresholdSection{Threshold: 95, Duration: time.Minute, Hysteresis: 2, ClearDuration: time.Minute},
+		PollingInterval:      5 * time.Second,
+		MissingValueBehavior: "zero",
+	})
+	if err != nil {
+		t.Fatalf("Expected valid monitor, got error: %v", err)
+	}
+
+	if m.query != `node_cpu_usage{instance="a"}` {
+		t.Errorf("Expected query 'node_cpu_usage{instance=\"a\"}', got %q", m.query)
+	}
+	if m.engine == nil || m.engine.Level("soft").Value != 80 || m.engine.Level("hard").Value != 95 {
+		t.Fatalf("Expected soft 80 and hard 95 thresholds, got %+v", m.engine)
+	}
+	soft, hard := m.engine.Level("soft"), m.engine.Level("hard")
+	if soft.Duration != 30*time.Second || soft.BackoffDelay != time.Minute || hard.Duration != time.Minute {
+		t.Errorf("Unexpected durations: soft=%v soft_backoff=%v hard=%v", soft.Duration, soft.BackoffDelay, hard.Duration)
+	}
+	if hard.Hysteresis != 2 || hard.ClearDuration != time.Minute || hard.ClearValue != nil {
+		t.Errorf("Unexpected hard clear settings: hysteresis=%v clear_duration=%v", hard.Hysteresis, hard.ClearDuration)
+	}
+	if len(m.series) != 0 {
+		t.Errorf("Expected no tracked series before the first poll, got %d", len(m.series))
+	}
+}
+
+func TestNewMonitor_InvalidConfig(t *testing.T) {
+	clearAbove := 90.0
+	lower, upper := 10.0, 1000.0
+	tests := []struct {
+		name string
+		cfg  MonitorConfig
+	}{
+		{
+			name: "missing metric name and query",
+			cfg:  MonitorConfig{PollingInterval: time.Second, MissingValueBehavior: "zero"},
+		},
+		{
+			name: "invalid query",
+			cfg:  MonitorConfig{Query: "sum(up", PollingInterval: time.Second, MissingValueBehavior: "zero"},
+		},
+		{
+			name: "invalid label filters",
+			cfg:  MonitorConfig{MetricName: "up", LabelFilters: `job=prometheus`, PollingInterval: time.Second, MissingValueBehavior: "zero"},
+		},
+		{
+			name: "zero polling interval",
+			cfg:  MonitorConfig{MetricName: "up", MissingValueBehavior: "zero"},
+		},
+		{
+			name: "invalid missing value behavior",
+			cfg:  MonitorConfig{MetricName: "up", PollingInterval: time.Second, MissingValueBehavior: "ignore"},
+		},
+		{
+			name: "levels combined with soft",
+			cfg: MonitorConfig{
+				MetricName:           "up",
+				PollingInterval:      time.Second,
+				MissingValueBehavior: "zero",
+				ThresholdOperator:    "greater_than",
+				Soft:                 &ThresholdSection{Threshold: 1},
+				Levels:               []LevelSection{{Name: "warn", ThresholdSection: ThresholdSection{Threshold: 2}}},
+			},
+		},
+		{
+			name: "unnamed level",
+			cfg: MonitorConfig{
+				MetricName:           "up",
+				PollingInterval:      time.Second,
+				MissingValueBehavior: "zero",
+				ThresholdOperator:    "greater_than",
+				Levels:               []LevelSection{{ThresholdSection: ThresholdSection{Threshold: 2}}},
+			},
+		},
+		{
+			name: "levels out of order",
+			cfg: MonitorConfig{
+				MetricName:           "up",
+				PollingInterval:      time.Second,
+				MissingValueBehavior: "zero",
+				ThresholdOperator:    "greater_than",
+				Levels: []LevelSection{
+					{Name: "warn", ThresholdSection: ThresholdSection{Threshold: 90}},
+					{Name: "critical", ThresholdSection: ThresholdSection{Threshold: 80}},
+				},
+			},
+		},
+		{
+			name: "clear threshold past threshold",
+			cfg: MonitorConfig{
+				MetricName:           "up",
+				PollingInterval:      time.Second,
+				MissingValueBehavior: "zero",
+				ThresholdOperator:    "greater_than",
+				Soft:                 &ThresholdSection{Threshold: 80, ClearThreshold: &clearAbove},
+			},
+		},
+		{
+			name: "invalid operator",
+			cfg: MonitorConfig{
+				MetricName:           "up",
+				PollingInterval:      time.Second,
+				MissingValueBehavior: "zero",
+				ThresholdOperator:    "between",
+				Soft:                 &ThresholdSection{Threshold: 1},
+			},
+		},
+		{
+			name: "range operator without bounds",
+			cfg: MonitorConfig{
+				MetricName:           "queue_depth",
+				PollingInterval:      time.Second,
+				MissingValueBehavior: "zero",
+				ThresholdOperator:    "outside_range",
+				Soft:                 &ThresholdSection{Lower: &lower},
+			},
+		},
+		{
+			name: "bounds without a range operator",
+			cfg: MonitorConfig{
+				MetricName:           "queue_depth",
+				PollingInterval:      time.Second,
+				MissingValueBehavior: "zero",
+				ThresholdOperator:    "greater_than",
+				Soft:                 &ThresholdSection{Threshold: 80, Lower: &lower, Upper: &upper},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newMonitor(tt.cfg); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestNewMonitor_Levels(t *testing.T) {
+	m, err := newMonitor(MonitorConfig{
+		Name:              "disk",
+		MetricName:        "disk_usage_percent",
+		ThresholdOperator: "greater_than",
+		Levels: []LevelSection{
+			{Name: "warn", ThresholdSection: ThresholdSection{Threshold: 70}},
+			{Name: "degrade", ThresholdSection: ThresholdSection{Threshold: 80, Execution: "parallel"}},
+			{Name: "critical", ThresholdSection: ThresholdSection{Threshold: 90, Duration: time.Minute}},
+			{Name: "emergency", ThresholdSection: ThresholdSection{Threshold: 98, BackoffDelay: time.Hour}},
+		},
+		PollingInterval:      time.Second,
+		MissingValueBehavior: "zero",
+	})
+	if err != nil {
+		t.Fatalf("Expected valid monitor, got error: %v", err)
+	}
+
+	var names []string
+	for _, level := range m.engine.Levels() {
+		names = append(names, level.Name)
+	}
+	if got := strings.Join(names, ","); got != "warn,degrade,critical,emergency" {
+		t.Fatalf("Expected the levels in configuration order, got %s", got)
+	}
+	if m.engine.Level("critical").Duration != time.Minute || m.engine.Level("emergency").BackoffDelay != time.Hour {
+		t.Errorf("Unexpected level settings: critical=%+v emergency=%+v", m.engine.Level("critical"), m.engine.Level("emergency"))
+	}
+	if m.chains["degrade"].execution != chainExecutionParallel {
+		t.Errorf("Expected parallel execution for the degrade level, got %q", m.chains["degrade"].execution)
+	}
+}
+
+func TestNewMonitor_Range(t *testing.T) {
+	lower, upper := 10.0, 1000.0
+	m, err := newMonitor(MonitorConfig{
+		Name:                 "queue",
+		MetricName:           "queue_depth",
+		ThresholdOperator:    "outside_range",
+		Soft:                 &ThresholdSection{Lower: &lower, Upper: &upper, Hysteresis: 5},
+		PollingInterval:      time.Second,
+		MissingValueBehavior: "zero",
+	})
+	if err != nil {
+		t.Fatalf("Expected valid monitor, got error: %v", err)
+	}
+
+	soft := m.engine.Level("soft")
+	if m.engine.Operator() != threshold.OutsideRange || soft.Lower != 10 || soft.Upper != 1000 || soft.Hysteresis != 5 {
+		t.Errorf("Unexpected soft level: %+v", soft)
+	}
+}
+
+func TestNewMonitor_PredictLinearCondition(t *testing.T) {
+	m, err := newMonitor(MonitorConfig{
+		Name:                 "efs",
+		MetricName:           "aws_efs_burst_credit_balance",
+		LabelFilters:         `file_system_id="fs-1"`,
+		ThresholdOperator:    "less_or_equal",
+		Soft:                 &ThresholdSection{Threshold: 0},
+		Condition:            "predict_linear",
+		ConditionWindow:      time.Hour,
+		ConditionHorizon:     2 * time.Hour,
+		PollingInterval:      time.Minute,
+		MissingValueBehavior: "last_value",
+	})
+	if err != nil {
+		t.Fatalf("Expected valid monitor, got error: %v", err)
+	}
+
+	if expected := `predict_linear((aws_efs_burst_credit_balance{file_system_id="fs-1"})[1h:], 7200)`; m.query != expected {
+		t.Errorf("Expected query %q, got %q", expected, m.query)
+	}
+	if m.metricName != "aws_efs_burst_credit_balance" {
+		t.Errorf("Expected the metric name to be kept, got %q", m.metricName)
+	}
+
+	// Subqueries need an instant vector
+	_, err = newMonitor(MonitorConfig{
+		Query:                "1",
+		Condition:            "deriv",
+		ConditionWindow:      time.Hour,
+		PollingInterval:      time.Minute,
+		MissingValueBehavior: "zero",
+	})
+	if err == nil {
+		t.Error("Expected an error for a trend condition on a scalar query")
+	}
+}
+
+func TestRestoreState_DropsUnknownLevel(t *testing.T) {
+	m, err := newMonitor(MonitorConfig{
+		Name:                 "disk",
+		MetricName:           "disk_usage_percent",
+		ThresholdOperator:    "greater_than",
+		Levels:               []LevelSection{{Name: "warn", ThresholdSection: ThresholdSection{Threshold: 70}}},
+		PollingInterval:      time.Second,
+		MissingValueBehavior: "zero",
+	})
+	if err != nil {
+		t.Fatalf("Expected valid monitor, got error: %v", err)
+	}
+
+	m.restoreState([]persistedSeries{
+		{Labels: map[string]string{"disk": "a"}, State: "WarnThresholdActive"},
+		{Labels: map[string]string{"disk": "b"}, State: threshold.HardThresholdActive, PeakValue: 99},
+	}, time.Now())
+
+	if s := m.series[model.Metric{"disk": "a"}.Fingerprint()]; s == nil || s.state.State != "WarnThresholdActive" {
+		t.Errorf("Expected the state of a configured level to be restored, got %+v", s)
+	}
+	if s := m.series[model.Metric{"disk": "b"}.Fingerprint()]; s == nil || s.state.State != threshold.NotBreached || s.state.PeakValue != 0 {
+		t.Errorf("Expected the state of a removed level to be reset to NotBreached, got %+v", s)
+	}
+}
+
+func TestNewMonitor_Query(t *testing.T) {
+	m, err := newMonitor(MonitorConfig{
+		Query:                `sum by (job) (rate(http_requests_total{code=~"5.."}[5m]))`,
+		LabelFilters:         `ignored="true"`,
+		PollingInterval:      time.Second,
+		MissingValueBehavior: "zero",
+	})
+	if err != nil {
+		t.Fatalf("Expected valid monitor, got error: %v", err)
+	}
+
+	if m.query != `sum by (job) (rate(http_requests_total{code=~"5.."}[5m]))` {
+		t.Errorf("Expected query to be used as-is, got %q", m.query)
+	}
+	if m.metricName != m.query {
+		t.Errorf("Expected metric name to fall back to the query, got %q", m.metricName)
+	}
+}
+
+func TestValidateQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+	}{
+		{name: "metric name", query: "up"},
+		{name: "label filters", query: `up{job="prometheus"}`},
+		{name: "rate", query: "rate(http_requests_total[5m])"},
+		{name: "aggregation", query: "sum by (instance) (node_load1)"},
+		{name: "predict_linear", query: "predict_linear(node_filesystem_free_bytes[1h], 4 * 3600)"},
+		{name: "ratio", query: "errors_total / requests_total"},
+		{name: "scalar", query: "scalar(up)"},
+		{name: "syntax error", query: "sum(rate(http_requests_total[5m])", wantErr: true},
+		{name: "unknown function", query: "rat(http_requests_total[5m])", wantErr: true},
+		{name: "range vector", query: "http_requests_total[5m]", wantErr: true},
+		{name: "string", query: `"hello"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateQuery(tt.query)
+			if tt.wantErr && err == nil {
+				t.Errorf("Expected error for query %q, got nil", tt.query)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected query %q to be valid, got error: %v", tt.query, err)
+			}
+		})
+	}
+}
+
+func TestMonitorsHaveIndependentState(t *testing.T) {
+	leaderActive.Store(true)
+	defer leaderActive.Store(false)
+
+	cfg := MonitorConfig{
+		MetricName:           "a",
+		ThresholdOperator:    "greater_than",
+		Soft:                 &ThresholdSection{Threshold: 10},
+		PollingInterval:      time.Second,
+		MissingValueBehavior: "zero",
+	}
+	first, err := newMonitor(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+	cfg.MetricName = "b"
+	second, err := newMonitor(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	now := time.Now()
+	sample := model.Vector{{Metric: model.Metric{"job": "x"}, Value: 20}}
+	first.processVector(context.Background(), sample, now.Add(-time.Second))
+	first.processVector(context.Background(), sample, now)
+	second.processVector(context.Background(), model.Vector{{Metric: model.Metric{"job": "x"}, Value: 1}}, now)
+
+	if state := first.series[model.Metric{"job": "x"}.Fingerprint()].state.State; state != threshold.SoftThresholdActive {
+		t.Errorf("Expected first monitor to be SoftThresholdActive, got %s", state)
+	}
+	if state := second.series[model.Metric{"job": "x"}.Fingerprint()].state.State; state != threshold.NotBreached {
+		t.Errorf("Expected second monitor to remain NotBreached, got %s", state)
+	}
+}
+
+func TestProcessVector_TracksEachSeries(t *testing.T) {
+	leaderActive.Store(true)
+	defer leaderActive.Store(false)
+
+	softPlugin := &seriesTestPlugin{}
+	m, err := newMonitor(MonitorConfig{
+		MetricName:           "queue_depth",
+		ThresholdOperator:    "greater_than",
+		Soft:                 &ThresholdSection{Threshold: 10},
+		PollingInterval:      time.Second,
+		MissingValueBehavior: "zero",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+	m.engine.Level("soft").Plugin = softPlugin
+
+	high := model.Metric{"queue": "high"}
+	low := model.Metric{"queue": "low"}
+	vector := model.Vector{
+		{Metric: high, Value: 50},
+		{Metric: low, Value: 1},
+	}
+
+	now := time.Now()
+	m.processVector(context.Background(), vector, now)
+	m.processVector(context.Background(), vector, now.Add(time.Second))
+
+	if len(m.series) != 2 {
+		t.Fatalf("Expected 2 tracked series, got %d", len(m.series))
+	}
+	if state := m.series[high.Fingerprint()].state.State; state != threshold.SoftThresholdActive {
+		t.Errorf("Expected high series to be SoftThresholdActive, got %s", state)
+	}
+	if state := m.series[low.Fingerprint()].state.State; state != threshold.NotBreached {
+		t.Errorf("Expected low series to remain NotBreached, got %s", state)
+	}
+	if softPlugin.executeCount != 1 {
+		t.Fatalf("Expected plugin to execute once for the breaching series, got %d", softPlugin.executeCount)
+	}
+	if softPlugin.lastLabels["queue"] != "high" {
+		t.Errorf("Expected plugin to receive labels of the breaching series, got %v", softPlugin.lastLabels)
+	}
+}
+
+func TestProcessVector_GarbageCollectsStaleSeries(t *testing.T) {
+	m, err := newMonitor(MonitorConfig{
+		MetricName:           "up",
+		PollingInterval:      time.Second,
+		MissingValueBehavior: "last_value",
+		SeriesStaleness:      time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	kept := model.Metric{"instance": "a"}
+	gone := model.Metric{"instance": "b"}
+
+	now := time.Now()
+	m.processVector(context.Background(), model.Vector{{Metric: kept, Value: 1}, {Metric: gone, Value: 1}}, now)
+
+	// Series b disappears but is still within the staleness window
+	m.processVector(context.Background(), model.Vector{{Metric: kept, Value: 1}}, now.Add(30*time.Second))
+	if _, ok := m.series[gone.Fingerprint()]; !ok {
+		t.Error("Expected absent series to be kept within the staleness window")
+	}
+
+	// Series b has been absent for longer than the staleness window
+	m.processVector(context.Background(), model.Vector{{Metric: kept, Value: 1}}, now.Add(2*time.Minute))
+	if _, ok := m.series[gone.Fingerprint()]; ok {
+		t.Error("Expected stale series to be garbage-collected")
+	}
+	if _, ok := m.series[kept.Fingerprint()]; !ok {
+		t.Error("Expected present series to be kept")
+	}
+}
+
+func TestProcessVector_EmptyResultUsesMissingValueBehavior(t *testing.T) {
+	leaderActive.Store(true)
+	defer leaderActive.Store(false)
+
+	m, err := newMonitor(MonitorConfig{
+		MetricName:           "efs_burst_credits",
+		ThresholdOperator:    "less_than",
+		Soft:                 &ThresholdSection{Threshold: 10},
+		PollingInterval:      time.Second,
+		MissingValueBehavior: "zero",
+		SeriesStaleness:      time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	now := time.Now()
+	m.processVector(context.Background(), model.Vector{}, now)
+	m.processVector(context.Background(), model.Vector{}, now.Add(time.Second))
+
+	s, ok := m.series[model.Metric{}.Fingerprint()]
+	if !ok {
+		t.Fatal("Expected an implicit series to be tracked for an empty result")
+	}
+	if s.state.State != threshold.SoftThresholdActive {
+		t.Errorf("Expected zero value to breach less_than threshold, got %s", s.state.State)
+	}
+
+	// The implicit series is not garbage-collected while the result stays empty
+	m.processVector(context.Background(), model.Vector{}, now.Add(10*time.Minute))
+	if _, ok := m.series[model.Metric{}.Fingerprint()]; !ok {
+		t.Error("Expected implicit series to be kept while the result stays empty")
+	}
+}
+
+// TestProcessVector_EmptyResultThenSeries tests that the implicit series of an empty first poll
+// is discarded once real series report, even without staleness
+func TestProcessVector_EmptyResultThenSeries(t *testing.T) {
+	leaderActive.Store(true)
+	defer leaderActive.Store(false)
+
+	m, err := newMonitor(MonitorConfig{
+		MetricName:           "efs_burst_credits",
+		ThresholdOperator:    "less_than",
+		Soft:                 &ThresholdSection{Threshold: 10},
+		PollingInterval:      time.Second,
+		MissingValueBehavior: "zero",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+	plugin := &seriesTestPlugin{}
+	m.engine.Level("soft").Plugin = plugin
+
+	now := time.Now()
+	m.processVector(context.Background(), model.Vector{}, now)
+	if _, ok := m.series[model.Metric{}.Fingerprint()]; !ok {
+		t.Fatal("Expected an implicit series to be tracked for an empty result")
+	}
+
+	metric := model.Metric{"file_system_id": "fs-1"}
+	for i := 1; i <= 10; i++ {
+		m.processVector(context.Background(), model.Vector{{Metric: metric, Value: 100}}, now.Add(time.Duration(i)*time.Hour))
+	}
+
+	if _, ok := m.series[model.Metric{}.Fingerprint()]; ok {
+		t.Error("Expected the implicit series to be discarded once real series report")
+	}
+	if len(m.series) != 1 {
+		t.Errorf("Expected only the real series to be tracked, got %d series", len(m.series))
+	}
+	if plugin.executeCount != 0 {
+		t.Errorf("Expected no plugin execution, got %d with labels %v", plugin.executeCount, plugin.lastLabels)
+	}
+}
+
+func TestAssumeBreached_UsesClock(t *testing.T) {
+	leaderActive.Store(true)
+	defer leaderActive.Store(false)
+
+	m, err := newMonitor(MonitorConfig{
+		MetricName:           "efs_burst_credits",
+		ThresholdOperator:    "less_than",
+		Soft:                 &ThresholdSection{Threshold: 10, BackoffDelay: time.Hour},
+		Hard:                 &ThresholdSection{Threshold: 5, BackoffDelay: time.Hour},
+		PollingInterval:      time.Minute,
+		MissingValueBehavior: "assume_breached",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+	softPlugin := &seriesTestPlugin{}
+	m.engine.Level("soft").Plugin = softPlugin
+	clock := threshold.NewVirtualClock(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+	m.useClock(clock)
+
+	m.processVector(context.Background(), model.Vector{}, clock.Now())
+
+	state := m.series[model.Metric{}.Fingerprint()].state
+	if state.State != threshold.HardThresholdActive {
+		t.Fatalf("Expected HardThresholdActive, got %s", state.State)
+	}
+	if !state.Level("soft").ActiveSince.Equal(clock.Now()) || !state.Level("hard").ActiveSince.Equal(clock.Now()) {
+		t.Errorf("Expected the active states to start at the clock time, got %v and %v", state.Level("soft").ActiveSince, state.Level("hard").ActiveSince)
+	}
+	if want := clock.Now().Add(time.Hour); !state.Level("soft").BackoffUntil.Equal(want) {
+		t.Errorf("Expected soft backoff until %v, got %v", want, state.Level("soft").BackoffUntil)
+	}
+}
+
+// seriesTestPlugin records the labels it is executed with
+type seriesTestPlugin struct {
+	executeCount int
+	lastLabels   map[string]string
+}
+
+func (p *seriesTestPlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
+	p.executeCount++
+	p.lastLabels = event.Labels
+	return nil
+}
+
+func (p *seriesTestPlugin) Name() string {
+	return "series_test_plugin"
+}
+
+func (p *seriesTestPlugin) ValidateConfig() error {
+	return nil
+}
+
+func TestRecoveryPluginName(t *testing.T) {
+	tests := []struct {
+		name    string
+		section ThresholdSection
+		want    string
+	}{
+		{"none", ThresholdSection{Plugin: "webhook"}, ""},
+		{"configured", ThresholdSection{Plugin: "webhook", RecoveryPlugin: "log_action"}, "log_action"},
+		{"alertmanager", ThresholdSection{Plugins: []string{"webhook", "alertmanager"}}, "alertmanager"},
+		{"alertmanager with configured", ThresholdSection{Plugin: "alertmanager", RecoveryPlugin: "webhook"}, "webhook"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := recoveryPluginName(LevelSection{Name: "soft", ThresholdSection: tt.section}); got != tt.want {
+				t.Errorf("expected recovery plugin %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package plugin
+
+import "context"
+
+// ActionPlugin defines the interface that all threshold action plugins must implement
+type ActionPlugin interface {
+	// HandleEvent performs the plugin action for a threshold event: when a threshold stayed
+	// crossed for its duration, when the action is repeated after the backoff delay and, for
+	// recovery plugins, when the series leaves the threshold's active state (see Reason)
+	HandleEvent(ctx context.Context, event *ThresholdEvent) error
+	// Name returns the name of the plugin
+	Name() string
+	// ValidateConfig validates that all required configuration for the plugin is present
+	// Returns an error if configuration is invalid or missing required values
+	ValidateConfig() error
+}
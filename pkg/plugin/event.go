@@ -0,0 +1,92 @@
+// Package plugin defines the contract between metric-reader and its action plugins:
+// the plugin interfaces, the event passed to them and the registry the host keeps them in.
+//
+// Plugins are built as separate binaries or shared libraries and cannot import the
+// metric-reader main package, so the types shared between the host and plugins live here.
+package plugin
+
+import (
+	"fmt"
+	"time"
+)
+
+// EventVersion is the version of the ThresholdEvent layout. It is incremented on
+// incompatible changes; new fields may be added without changing the version.
+const EventVersion = 1
+
+// Reason describes why a plugin is executed
+type Reason string
+
+const (
+	// ReasonThresholdCrossed is sent when a threshold stayed crossed for its duration
+	// and the series enters the threshold's active state
+	ReasonThresholdCrossed Reason = "threshold_crossed"
+	// ReasonBackoffExpired is sent when the action is executed again after the backoff delay
+	// while the series is still in the threshold's active state
+	ReasonBackoffExpired Reason = "backoff_expired"
+	// ReasonAssumeBreached is sent when the threshold is assumed crossed because the
+	// query returned no data and missing_value_behavior is assume_breached
+	ReasonAssumeBreached Reason = "assume_breached"
+	// ReasonRecovered is sent to recovery plugins when the series leaves the threshold's active state
+	ReasonRecovered Reason = "recovered"
+)
+
+// ThresholdEvent describes a threshold state machine event that triggers a plugin
+type ThresholdEvent struct {
+	// Version is the layout version, always EventVersion when built by metric-reader
+	Version int `json:"version"`
+
+	// Monitor is the name of the monitor that produced the event
+	Monitor string `json:"monitor"`
+	// Query is the PromQL expression evaluated by the monitor
+	Query string `json:"query"`
+	// MetricName is the monitored metric, or the query when the monitor has no metric name
+	MetricName string `json:"metric_name"`
+	// Labels are the labels of the series that triggered the event
+	Labels map[string]string `json:"labels"`
+
+	// Level is the name of the threshold level that triggered the event, such as "soft" or "hard"
+	Level string `json:"level"`
+	// Threshold is the numeric threshold value, 0 for the range operators
+	Threshold float64 `json:"threshold"`
+	// Lower and Upper are the bounds of the range, set for the outside_range and inside_range operators
+	Lower *float64 `json:"lower,omitempty"`
+	Upper *float64 `json:"upper,omitempty"`
+	// Operator is the threshold operator, e.g. greater_than
+	Operator string `json:"operator"`
+	// BaselineMean and BaselineStdDev describe the history of the series for baseline
+	// thresholds; Threshold, Lower and Upper are then the boundaries computed from them
+	BaselineMean   *float64 `json:"baseline_mean,omitempty"`
+	BaselineStdDev *float64 `json:"baseline_stddev,omitempty"`
+	// Value is the value that triggered the event
+	Value float64 `json:"value"`
+	// PeakValue is the most severe value seen since the series entered SoftThresholdActive
+	PeakValue float64 `json:"peak_value"`
+
+	// PreviousState and NewState are the state machine states before and after the event.
+	// They are equal when an action is executed again after the backoff delay.
+	PreviousState string `json:"previous_state"`
+	NewState      string `json:"new_state"`
+	// Reason is why the plugin is executed
+	Reason Reason `json:"reason"`
+	// Attempt counts the executions of the level's action during the current incident, starting at 1
+	Attempt int `json:"attempt"`
+	// Retry counts the retries of a failed execution, 0 for the first try
+	Retry int `json:"retry,omitempty"`
+
+	// Timestamp is when the event was produced
+	Timestamp time.Time `json:"timestamp"`
+	// StartedAt is when the threshold was first crossed, or when the active state was entered for recovery events
+	StartedAt time.Time `json:"started_at"`
+	// Duration is how long the threshold has been crossed, or how long the active state lasted for recovery events
+	Duration time.Duration `json:"duration"`
+}
+
+// ThresholdString formats the operator and threshold for logs and messages,
+// e.g. "greater_than 80.00" or "outside_range [10.00, 20.00]"
+func (e *ThresholdEvent) ThresholdString() string {
+	if e.Lower != nil && e.Upper != nil {
+		return fmt.Sprintf("%s [%.2f, %.2f]", e.Operator, *e.Lower, *e.Upper)
+	}
+	return fmt.Sprintf("%s %.2f", e.Operator, e.Threshold)
+}
@@ -0,0 +1,51 @@
+package plugin
+
+import "encoding/json"
+
+// ProtocolVersion is the newest version of the exec plugin protocol implemented by this package
+const ProtocolVersion = 1
+
+// MagicCookieKey and MagicCookieValue are set in the environment of exec plugins.
+// Serve refuses to run without them, so a plugin binary started by hand explains
+// itself instead of waiting for requests on stdin.
+const (
+	MagicCookieKey   = "METRIC_READER_PLUGIN"
+	MagicCookieValue = "exec-plugin-v1"
+)
+
+// Methods of the exec plugin protocol
+const (
+	// MethodHandshake negotiates the protocol version and returns the plugin name
+	MethodHandshake = "handshake"
+	// MethodValidateConfig calls ValidateConfig on the plugin
+	MethodValidateConfig = "validate_config"
+	// MethodHandleEvent calls HandleEvent on the plugin with a ThresholdEvent
+	MethodHandleEvent = "handle_event"
+)
+
+// Request is a single call from metric-reader to an exec plugin.
+// Requests and responses are written as one JSON document per line over the
+// plugin's stdin and stdout; the plugin's stderr is forwarded to the metric-reader log.
+type Request struct {
+	ID     uint64          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Response answers the Request with the same ID. Error is empty on success.
+type Response struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// HandshakeRequest lists the protocol versions supported by metric-reader
+type HandshakeRequest struct {
+	ProtocolVersions []int `json:"protocol_versions"`
+}
+
+// HandshakeResponse carries the protocol version chosen by the plugin and its name
+type HandshakeResponse struct {
+	ProtocolVersion int    `json:"protocol_version"`
+	Name            string `json:"name"`
+}
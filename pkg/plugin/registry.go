@@ -0,0 +1,40 @@
+package plugin
+
+import "sort"
+
+// Registry holds the plugins available to thresholds by name. It is filled and wrapped
+// at startup and is not safe for concurrent modification.
+type Registry struct {
+	plugins map[string]ActionPlugin
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{plugins: make(map[string]ActionPlugin)}
+}
+
+// Register adds a plugin under its name
+func (r *Registry) Register(p ActionPlugin) {
+	r.plugins[p.Name()] = p
+}
+
+// Set registers p under name, replacing the plugin registered before, e.g. with a wrapper
+func (r *Registry) Set(name string, p ActionPlugin) {
+	r.plugins[name] = p
+}
+
+// Get returns the plugin registered under name
+func (r *Registry) Get(name string) (ActionPlugin, bool) {
+	p, ok := r.plugins[name]
+	return p, ok
+}
+
+// Names returns the names of the registered plugins in lexical order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.plugins))
+	for name := range r.plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
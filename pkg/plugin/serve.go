@@ -0,0 +1,106 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Serve runs an exec plugin: it answers requests from metric-reader on stdin and stdout
+// until stdin is closed. Plugin binaries call it from main:
+//
+//	func main() {
+//		plugin.Serve(&MyPlugin{})
+//	}
+//
+// Anything the plugin writes to stderr is forwarded to the metric-reader log;
+// stdout is reserved for the protocol.
+func Serve(p ActionPlugin) {
+	if os.Getenv(MagicCookieKey) != MagicCookieValue {
+		fmt.Fprintln(os.Stderr, "This binary is a metric-reader plugin and is not meant to be executed directly.")
+		os.Exit(1)
+	}
+
+	if err := ServeIO(context.Background(), p, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "plugin %s: %v\n", p.Name(), err)
+		os.Exit(1)
+	}
+}
+
+// ServeIO answers requests read from r by writing responses to w until r is exhausted
+func ServeIO(ctx context.Context, p ActionPlugin, r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	encoder := json.NewEncoder(w)
+
+	for scanner.Scan() {
+		var req Request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			return fmt.Errorf("failed to decode request: %v", err)
+		}
+
+		resp := handleRequest(ctx, p, &req)
+		if err := encoder.Encode(resp); err != nil {
+			return fmt.Errorf("failed to write response: %v", err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read request: %v", err)
+	}
+	return nil
+}
+
+// handleRequest dispatches a single request to the plugin
+func handleRequest(ctx context.Context, p ActionPlugin, req *Request) *Response {
+	resp := &Response{ID: req.ID}
+
+	switch req.Method {
+	case MethodHandshake:
+		var params HandshakeRequest
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			resp.Error = fmt.Sprintf("invalid handshake: %v", err)
+			return resp
+		}
+		version := negotiateVersion(params.ProtocolVersions)
+		if version == 0 {
+			resp.Error = fmt.Sprintf("no supported protocol version in %v (plugin supports up to %d)", params.ProtocolVersions, ProtocolVersion)
+			return resp
+		}
+		resp.Result, _ = json.Marshal(HandshakeResponse{ProtocolVersion: version, Name: p.Name()})
+
+	case MethodValidateConfig:
+		if err := p.ValidateConfig(); err != nil {
+			resp.Error = err.Error()
+		}
+
+	case MethodHandleEvent:
+		var event ThresholdEvent
+		if err := json.Unmarshal(req.Params, &event); err != nil {
+			resp.Error = fmt.Sprintf("invalid event: %v", err)
+			return resp
+		}
+		if err := p.HandleEvent(ctx, &event); err != nil {
+			resp.Error = err.Error()
+		}
+
+	default:
+		resp.Error = fmt.Sprintf("unknown method %q", req.Method)
+	}
+
+	return resp
+}
+
+// negotiateVersion returns the newest protocol version supported by both sides, or 0
+func negotiateVersion(offered []int) int {
+	best := 0
+	for _, v := range offered {
+		if v <= ProtocolVersion && v > best {
+			best = v
+		}
+	}
+	return best
+}
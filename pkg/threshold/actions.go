@@ -0,0 +1,161 @@
+package threshold
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"metric-reader/pkg/plugin"
+)
+
+// runAction executes the plugin of a level and applies the result. Without a dispatcher the
+// action runs synchronously; with one it is submitted and the level is marked in flight so no
+// second copy is dispatched until it completes.
+func (e *Engine) runAction(ctx context.Context, s *Series, level *Level, event *plugin.ThresholdEvent, now time.Time) {
+	ls := s.Level(level.Name)
+	if ls.ActionInFlight {
+		e.log.Warn().
+			Str("series", s.Labels.String()).
+			Str("plugin", level.Plugin.Name()).
+			Msgf("%s threshold action still in flight, not executing it again", level.Name)
+		return
+	}
+
+	// In dry-run mode the action counts as executed so the backoff behaves as it would for real
+	if level.DryRun {
+		e.recordDryRun(s, level.Plugin, event)
+		ls.recordActionResult(nil, now)
+		e.startBackoff(s, level, now)
+		return
+	}
+
+	e.log.Debug().
+		Str("plugin", level.Plugin.Name()).
+		Str("state", string(s.State)).
+		Str("reason", string(event.Reason)).
+		Int("attempt", event.Attempt).
+		Msgf("executing %s threshold plugin", level.Name)
+
+	if e.dispatcher == nil {
+		err := e.cfg.Execute(ctx, level.Plugin, event)
+		e.completeAction(s, level, event, err, now)
+		return
+	}
+
+	ls.ActionInFlight = true
+	labels := s.Labels
+	queued := e.dispatcher.Submit(level.Plugin, event, func(err error) {
+		e.lock.Lock()
+		defer e.lock.Unlock()
+		current := e.lookup(labels)
+		if current == nil {
+			e.log.Debug().
+				Str("series", labels.String()).
+				Str("plugin", level.Plugin.Name()).
+				Msgf("series no longer tracked, discarding %s threshold action result", level.Name)
+			return
+		}
+		current.Level(level.Name).ActionInFlight = false
+		e.completeAction(current, level, event, err, e.Now())
+	})
+	if !queued {
+		ls.ActionInFlight = false
+		e.completeAction(s, level, event, fmt.Errorf("action queue full"), now)
+	}
+}
+
+// completeAction records the result of a threshold action. The backoff period starts when
+// the action succeeded.
+func (e *Engine) completeAction(s *Series, level *Level, event *plugin.ThresholdEvent, err error, completedAt time.Time) {
+	// An action completing on a dispatcher after the series left the level doesn't belong to its incident anymore
+	if e.reached(s, level) {
+		s.Level(level.Name).recordActionResult(err, completedAt)
+	}
+	if err != nil {
+		e.log.Error().
+			Err(err).
+			Str("plugin", level.Plugin.Name()).
+			Str("state", string(s.State)).
+			Str("reason", string(event.Reason)).
+			Msgf("failed to execute %s threshold plugin action", level.Name)
+		return
+	}
+
+	e.log.Info().
+		Str("plugin", level.Plugin.Name()).
+		Str("state", string(s.State)).
+		Str("reason", string(event.Reason)).
+		Msgf("%s threshold plugin executed successfully", level.Name)
+
+	e.startBackoff(s, level, completedAt)
+}
+
+// startBackoff starts the backoff period of a level after its action ran at now
+func (e *Engine) startBackoff(s *Series, level *Level, now time.Time) {
+	if level.BackoffDelay > 0 {
+		until := now.Add(level.BackoffDelay)
+		s.Level(level.Name).BackoffUntil = until
+		e.log.Debug().
+			Time("backoff_until", until).
+			Dur("backoff_delay", level.BackoffDelay).
+			Msgf("%s threshold backoff period started", level.Name)
+	}
+}
+
+// runRecovery executes the recovery plugin of a level, on the dispatcher when the engine has one
+func (e *Engine) runRecovery(ctx context.Context, s *Series, level *Level, event *plugin.ThresholdEvent) {
+	if level.DryRun {
+		e.recordDryRun(s, level.RecoveryPlugin, event)
+		return
+	}
+
+	series := s.Labels.String()
+	e.log.Debug().
+		Str("plugin", level.RecoveryPlugin.Name()).
+		Str("series", series).
+		Float64("peak_value", event.PeakValue).
+		Dur("breached_for", event.Duration).
+		Msgf("executing %s threshold recovery plugin", event.Level)
+
+	done := func(err error) {
+		if err != nil {
+			e.log.Error().
+				Err(err).
+				Str("plugin", level.RecoveryPlugin.Name()).
+				Str("series", series).
+				Msgf("failed to execute %s threshold recovery plugin", event.Level)
+			return
+		}
+		e.log.Info().
+			Str("plugin", level.RecoveryPlugin.Name()).
+			Str("series", series).
+			Float64("peak_value", event.PeakValue).
+			Dur("breached_for", event.Duration).
+			Msgf("%s threshold recovery plugin executed successfully", event.Level)
+	}
+
+	if e.dispatcher == nil {
+		done(e.cfg.Execute(ctx, level.RecoveryPlugin, event))
+		return
+	}
+	if !e.dispatcher.Submit(level.RecoveryPlugin, event, done) {
+		done(fmt.Errorf("action queue full"))
+	}
+}
+
+// recordDryRun logs the plugin execution a dry-run level skips and reports it to OnDryRun
+func (e *Engine) recordDryRun(s *Series, p plugin.ActionPlugin, event *plugin.ThresholdEvent) {
+	if e.cfg.OnDryRun != nil {
+		e.cfg.OnDryRun(s, p, event)
+	}
+	e.log.Info().
+		Str("series", s.Labels.String()).
+		Str("plugin", p.Name()).
+		Str("threshold_level", event.Level).
+		Float64("value", event.Value).
+		Str("previous_state", event.PreviousState).
+		Str("new_state", event.NewState).
+		Str("reason", string(event.Reason)).
+		Int("attempt", event.Attempt).
+		Msg("dry run: would execute plugin")
+}
@@ -0,0 +1,51 @@
+package threshold
+
+import "math"
+
+// Baseline summarizes the recent history of a series. With Config.Relative the thresholds of
+// every level are numbers of standard deviations from the baseline's mean.
+type Baseline struct {
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	// Samples is the number of samples the baseline was computed from
+	Samples int `json:"samples"`
+}
+
+// NewBaseline returns the mean and population standard deviation of values
+func NewBaseline(values []float64) Baseline {
+	if len(values) == 0 {
+		return Baseline{}
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return Baseline{Mean: mean, StdDev: math.Sqrt(squares / float64(len(values))), Samples: len(values)}
+}
+
+// Apply returns a copy of level whose thresholds, given in standard deviations, are converted
+// into values: the mean plus the threshold times the standard deviation. The hysteresis is
+// scaled by the standard deviation.
+func (b *Baseline) Apply(level *Level) *Level {
+	applied := *level
+	applied.Value = b.boundary(level.Value)
+	applied.Lower = b.boundary(level.Lower)
+	applied.Upper = b.boundary(level.Upper)
+	applied.Hysteresis = level.Hysteresis * b.StdDev
+	if level.ClearValue != nil {
+		clear := b.boundary(*level.ClearValue)
+		applied.ClearValue = &clear
+	}
+	return &applied
+}
+
+// boundary returns the value deviations standard deviations away from the mean
+func (b *Baseline) boundary(deviations float64) float64 {
+	return b.Mean + deviations*b.StdDev
+}
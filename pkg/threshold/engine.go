@@ -0,0 +1,650 @@
+// Package threshold implements the threshold state machine of metric-reader.
+//
+// An Engine evaluates the values of a series against an ordered list of threshold levels
+// and runs the plugins of a level once its threshold stayed crossed for its duration:
+//
+//	engine, err := threshold.NewEngine(threshold.Config{
+//		Operator: threshold.GreaterThan,
+//		Levels: []*threshold.Level{
+//			{Name: "warn", Value: 80, Duration: time.Minute, Plugin: p},
+//			{Name: "critical", Value: 95, Duration: time.Minute, Plugin: p},
+//		},
+//	})
+//	series := threshold.NewSeries(labels)
+//	engine.Evaluate(ctx, series, value)
+//
+// A series escalates one level at a time: the timer of a level only starts once the level
+// below it is active. Once the value of the series has been back past the clear value of the
+// active level for the level's clear duration, the series steps down one level at a time,
+// running the recovery plugin of every level it leaves, until it reaches a level that is not
+// cleared or NotBreached.
+//
+// The engine keeps no state of its own besides its configuration; the state of every
+// series lives in its Series.
+package threshold
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/rs/zerolog"
+	"metric-reader/pkg/plugin"
+)
+
+// Level is a threshold and the actions run when a series crosses it
+type Level struct {
+	// Name is the level reported in events, such as "soft" or "hard"; its active state is
+	// ActiveState(Name)
+	Name  string
+	Value float64
+	// Lower and Upper bound the range of the outside_range and inside_range operators, which
+	// ignore Value
+	Lower float64
+	Upper float64
+	// Duration is how long the threshold must stay crossed before the active state is entered
+	Duration time.Duration
+	// BackoffDelay is the delay before the action runs again while the state stays active
+	BackoffDelay time.Duration
+	// ClearValue is the value the series must be back past, on the side where the threshold
+	// is not crossed, before the active state is left. Only the directional operators
+	// (greater_than, greater_or_equal, less_than and less_or_equal) support it.
+	ClearValue *float64
+	// Hysteresis is the band past the threshold, on the side where it is not crossed, in which
+	// the active state is kept; see Operator.Widen. Mutually exclusive with ClearValue and not
+	// supported by equal and not_equal.
+	Hysteresis float64
+	// ClearDuration is how long the value must stay past the clear value before the active
+	// state is left
+	ClearDuration time.Duration
+	// Plugin runs when the threshold's active state is entered and after every backoff
+	Plugin plugin.ActionPlugin
+	// RecoveryPlugin runs when the series leaves the threshold's active state
+	RecoveryPlugin plugin.ActionPlugin
+	// DryRun reports the executions of Plugin and RecoveryPlugin to Config.OnDryRun instead of running them
+	DryRun bool
+}
+
+// Config configures an Engine
+type Config struct {
+	// Monitor, MetricName and Query describe the evaluated query in events and logs
+	Monitor    string
+	MetricName string
+	Query      string
+
+	Operator Operator
+	// Levels are the threshold levels in escalation order, from the least to the most severe
+	Levels []*Level
+	// Relative makes the thresholds of the levels numbers of standard deviations from the
+	// Baseline of each series instead of values; see Baseline.Apply
+	Relative bool
+
+	// Clock provides the time of the state machine; the system clock is used when nil
+	Clock Clock
+	// IsLeader reports whether this instance may run actions; actions always run when nil
+	IsLeader func() bool
+	// Execute runs a plugin with an event; when nil the plugin's HandleEvent is called
+	Execute func(ctx context.Context, p plugin.ActionPlugin, event *plugin.ThresholdEvent) error
+	// OnTransition is called after every state change when set
+	OnTransition func(s *Series, oldState State, newState State)
+	// OnDryRun is called for every plugin execution skipped by a dry-run level when set
+	OnDryRun func(s *Series, p plugin.ActionPlugin, event *plugin.ThresholdEvent)
+	// Logger receives the state machine logs, usually with the monitor in its context;
+	// nothing is logged when nil
+	Logger *zerolog.Logger
+}
+
+// Dispatcher runs plugin executions outside of Evaluate
+type Dispatcher interface {
+	// Submit queues the execution without blocking and reports whether it was queued.
+	// done is called with the result once the plugin returned.
+	Submit(p plugin.ActionPlugin, event *plugin.ThresholdEvent, done func(err error)) bool
+}
+
+// Engine evaluates series against the thresholds of its configuration
+type Engine struct {
+	cfg Config
+	log *zerolog.Logger
+	// states holds the active state of each level, in the order of cfg.Levels
+	states []State
+
+	// dispatcher runs actions asynchronously when set; results are applied holding lock
+	// to the series lookup returns
+	dispatcher Dispatcher
+	lock       sync.Locker
+	lookup     func(labels model.Metric) *Series
+}
+
+// NewEngine validates cfg and returns an engine evaluating series against it
+func NewEngine(cfg Config) (*Engine, error) {
+	if _, err := ParseOperator(string(cfg.Operator)); err != nil {
+		return nil, err
+	}
+	if len(cfg.Levels) == 0 {
+		return nil, fmt.Errorf("at least one threshold level is required")
+	}
+
+	states := make([]State, len(cfg.Levels))
+	names := make(map[State]string, len(cfg.Levels))
+	for i, level := range cfg.Levels {
+		if level == nil || level.Name == "" {
+			return nil, fmt.Errorf("threshold level %d has no name", i+1)
+		}
+		state := ActiveState(level.Name)
+		if other, ok := names[state]; ok {
+			return nil, fmt.Errorf("threshold levels %q and %q have the same active state %s", other, level.Name, state)
+		}
+		names[state] = level.Name
+		states[i] = state
+
+		if level.Duration < 0 || level.BackoffDelay < 0 || level.ClearDuration < 0 {
+			return nil, fmt.Errorf("%s threshold duration, backoff delay and clear duration must not be negative", level.Name)
+		}
+		if cfg.Operator.IsRange() && level.Lower > level.Upper {
+			return nil, fmt.Errorf("%s threshold lower bound %v is above its upper bound %v", level.Name, level.Lower, level.Upper)
+		}
+		if err := validateClear(cfg.Operator, level); err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			previous := cfg.Levels[i-1]
+			if !cfg.Operator.Nested(previous, level) {
+				if cfg.Operator == Equal || cfg.Operator == NotEqual {
+					return nil, fmt.Errorf("%s threshold %v differs from the %s threshold %v; levels of the %s operator must share the same threshold",
+						level.Name, level.Value, previous.Name, previous.Value, cfg.Operator)
+				}
+				return nil, fmt.Errorf("%s threshold %s is less severe than the %s threshold %s; levels must be ordered from the least to the most severe",
+					level.Name, cfg.Operator.FormatThreshold(level), previous.Name, cfg.Operator.FormatThreshold(previous))
+			}
+		}
+	}
+
+	if cfg.Clock == nil {
+		cfg.Clock = SystemClock{}
+	}
+	if cfg.Execute == nil {
+		cfg.Execute = func(ctx context.Context, p plugin.ActionPlugin, event *plugin.ThresholdEvent) error {
+			return p.HandleEvent(ctx, event)
+		}
+	}
+
+	logger := cfg.Logger
+	if logger == nil {
+		nop := zerolog.Nop()
+		logger = &nop
+	}
+	return &Engine{cfg: cfg, log: logger, states: states}, nil
+}
+
+// validateClear checks the clear threshold and hysteresis of a level
+func validateClear(operator Operator, level *Level) error {
+	if level.Hysteresis < 0 {
+		return fmt.Errorf("%s threshold hysteresis must not be negative", level.Name)
+	}
+	if level.ClearValue != nil {
+		if !operator.IsDirectional() {
+			return fmt.Errorf("%s clear threshold is not supported by the %s operator", level.Name, operator)
+		}
+		if level.Hysteresis != 0 {
+			return fmt.Errorf("%s threshold sets both a clear threshold and a hysteresis", level.Name)
+		}
+	}
+	if level.Hysteresis != 0 && (operator == Equal || operator == NotEqual) {
+		return fmt.Errorf("%s threshold hysteresis is not supported by the %s operator", level.Name, operator)
+	}
+
+	clear := clearLevel(operator, level)
+	if !operator.Nested(clear, level) {
+		return fmt.Errorf("%s clear threshold %s is past the threshold %s", level.Name, operator.FormatThreshold(clear), operator.FormatThreshold(level))
+	}
+	if operator.IsRange() && clear.Lower > clear.Upper {
+		return fmt.Errorf("%s threshold hysteresis %v is wider than half of its range %s", level.Name, level.Hysteresis, operator.FormatThreshold(level))
+	}
+	return nil
+}
+
+// clearLevel returns level with its threshold moved to its clear threshold: the active state
+// of the level is only left once the value no longer crosses it
+func clearLevel(operator Operator, level *Level) *Level {
+	if level.ClearValue != nil {
+		clear := *level
+		clear.Value = *level.ClearValue
+		return &clear
+	}
+	return operator.Widen(level, level.Hysteresis)
+}
+
+// Operator returns the threshold operator
+func (e *Engine) Operator() Operator {
+	return e.cfg.Operator
+}
+
+// Levels returns the threshold levels in escalation order. Their plugins may be assigned
+// until the first evaluation.
+func (e *Engine) Levels() []*Level {
+	return e.cfg.Levels
+}
+
+// Level returns the level with the given name, nil when it is not configured
+func (e *Engine) Level(name string) *Level {
+	for _, level := range e.cfg.Levels {
+		if level.Name == name {
+			return level
+		}
+	}
+	return nil
+}
+
+// Severity returns 0 for NotBreached and n for the active state of the n-th level.
+// It returns -1 for the active states of levels that are not configured.
+func (e *Engine) Severity(state State) int {
+	if state == NotBreached {
+		return 0
+	}
+	for i, levelState := range e.states {
+		if levelState == state {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// UseClock replaces the clock of the state machine
+func (e *Engine) UseClock(clock Clock) {
+	e.cfg.Clock = clock
+}
+
+// UseDispatcher runs the actions on d instead of inside Evaluate. Their results are applied
+// while holding lock, which must be the lock guarding the series, to the series lookup returns
+// for the labels of the series the action ran for. The series may have been replaced in the
+// meantime, e.g. by restored state; lookup returns nil when the series is no longer tracked.
+func (e *Engine) UseDispatcher(d Dispatcher, lock sync.Locker, lookup func(labels model.Metric) *Series) {
+	e.dispatcher = d
+	e.lock = lock
+	e.lookup = lookup
+}
+
+// Now returns the current time of the state machine
+func (e *Engine) Now() time.Time {
+	return e.cfg.Clock.Now()
+}
+
+func (e *Engine) isLeader() bool {
+	return e.cfg.IsLeader == nil || e.cfg.IsLeader()
+}
+
+// active returns the index of the active level of a series, -1 when no level is active
+func (e *Engine) active(s *Series) int {
+	if severity := e.Severity(s.State); severity > 0 {
+		return severity - 1
+	}
+	return -1
+}
+
+// reached reports whether a series is in the active state of level or of a more severe level
+func (e *Engine) reached(s *Series, level *Level) bool {
+	for i := e.active(s); i >= 0; i-- {
+		if e.cfg.Levels[i] == level {
+			return true
+		}
+	}
+	return false
+}
+
+// effective returns level with the thresholds the series is compared against: for a
+// relative engine, the thresholds applied to the baseline of the series
+func (e *Engine) effective(s *Series, level *Level) *Level {
+	if e.cfg.Relative && s.Baseline != nil {
+		return s.Baseline.Apply(level)
+	}
+	return level
+}
+
+// logBaseline adds the baseline of the series to a log event for relative engines
+func (e *Engine) logBaseline(s *Series) func(*zerolog.Event) {
+	return func(ev *zerolog.Event) {
+		if e.cfg.Relative && s.Baseline != nil {
+			ev.Float64("baseline_mean", s.Baseline.Mean).Float64("baseline_stddev", s.Baseline.StdDev)
+		}
+	}
+}
+
+// logThreshold adds the threshold of level to a log event as <prefix>_threshold, or
+// <prefix>_lower and <prefix>_upper for the range operators
+func (e *Engine) logThreshold(prefix string, level *Level) func(*zerolog.Event) {
+	return func(ev *zerolog.Event) {
+		if e.cfg.Operator.IsRange() {
+			ev.Float64(prefix+"_lower", level.Lower).Float64(prefix+"_upper", level.Upper)
+			return
+		}
+		ev.Float64(prefix+"_threshold", level.Value)
+	}
+}
+
+// trackClear times how long the value has been past the clear value of each active level
+func (e *Engine) trackClear(s *Series, active int, value float64, now time.Time) {
+	for i := 0; i <= active; i++ {
+		level := e.cfg.Levels[i]
+		ls := s.Level(level.Name)
+		clear := clearLevel(e.cfg.Operator, e.effective(s, level))
+
+		if e.cfg.Operator.Crossed(value, clear) {
+			if !ls.ClearStartTime.IsZero() {
+				e.log.Debug().
+					Str("query", e.cfg.Query).
+					Msgf("%s threshold crossed again before clear duration elapsed, resetting clear timer", level.Name)
+				ls.ClearStartTime = time.Time{}
+			}
+			continue
+		}
+		if ls.ClearStartTime.IsZero() {
+			ls.ClearStartTime = now
+			if level.ClearDuration > 0 {
+				e.log.Debug().
+					Str("query", e.cfg.Query).
+					Float64("value", value).
+					Func(e.logThreshold(level.Name+"_clear", clear)).
+					Func(e.logBaseline(s)).
+					Msgf("%s threshold cleared, starting clear duration timer", level.Name)
+			}
+		}
+	}
+}
+
+// cleared reports whether the value has been past the clear value of a level for its clear duration
+func (e *Engine) cleared(s *Series, level *Level, now time.Time) bool {
+	ls := s.Level(level.Name)
+	return !ls.ClearStartTime.IsZero() && now.Sub(ls.ClearStartTime) >= level.ClearDuration
+}
+
+// transition moves the state machine to newState, reports the transition and returns the previous state
+func (e *Engine) transition(s *Series, newState State) State {
+	oldState := s.State
+	s.State = newState
+	if e.cfg.OnTransition != nil {
+		e.cfg.OnTransition(s, oldState, newState)
+	}
+	return oldState
+}
+
+// Evaluate processes a value of the series through the state machine
+func (e *Engine) Evaluate(ctx context.Context, s *Series, value float64) {
+	now := e.Now()
+	operator := e.cfg.Operator
+	levels := e.cfg.Levels
+
+	// Relative thresholds can't be evaluated until the history of the series is known
+	if e.cfg.Relative && s.Baseline == nil {
+		e.log.Debug().
+			Str("series", s.Labels.String()).
+			Float64("value", value).
+			Msg("no baseline for series yet, skipping threshold evaluation")
+		return
+	}
+
+	// Track the peak value of the current incident for recovery plugins
+	first := e.effective(s, levels[0])
+	if s.State != NotBreached && operator.Severity(value, first) > operator.Severity(s.PeakValue, first) {
+		s.PeakValue = value
+	}
+
+	active := e.active(s)
+	e.log.Debug().
+		Str("current_state", string(s.State)).
+		Float64("value", value).
+		Msg("evaluating threshold state machine")
+
+	// Leave the active levels that have been cleared for their clear duration, one level at a time
+	e.trackClear(s, active, value, now)
+	if active >= 0 && e.cleared(s, levels[active], now) {
+		for ; active >= 0 && e.cleared(s, levels[active], now); active-- {
+			e.deescalate(ctx, s, active, value, now)
+		}
+		return
+	}
+
+	// Only the level above the active one is checked, so a series escalates one level at a time
+	if next := active + 1; next < len(levels) && e.escalate(ctx, s, next, value, now) {
+		return
+	}
+
+	// Stay in the active level: re-execute its plugin once the backoff period has passed, unless
+	// the value is only held in the active state by the clear threshold
+	if active >= 0 && operator.Crossed(value, e.effective(s, levels[active])) {
+		e.repeat(ctx, s, levels[active], value, now)
+	}
+}
+
+// escalate enters the active state of the level at index next once its threshold stayed
+// crossed for its duration, and reports whether it did
+func (e *Engine) escalate(ctx context.Context, s *Series, next int, value float64, now time.Time) bool {
+	level := e.cfg.Levels[next]
+	ls := s.Level(level.Name)
+	threshold := e.effective(s, level)
+
+	if !e.cfg.Operator.Crossed(value, threshold) {
+		if !ls.StartTime.IsZero() {
+			// Threshold no longer crossed before duration elapsed, reset timer
+			e.log.Debug().
+				Str("query", e.cfg.Query).
+				Msgf("%s threshold no longer crossed before duration elapsed, resetting timer", level.Name)
+			ls.StartTime = time.Time{}
+		}
+		return false
+	}
+
+	// Check if we're in backoff period
+	if !ls.BackoffUntil.IsZero() && now.Before(ls.BackoffUntil) {
+		e.log.Debug().
+			Time(level.Name+"_backoff_until", ls.BackoffUntil).
+			Msgf("in %s threshold backoff period", level.Name)
+		return false
+	}
+
+	// Start timing the threshold crossing
+	if ls.StartTime.IsZero() {
+		ls.StartTime = now
+		e.log.Debug().
+			Str("query", e.cfg.Query).
+			Float64("value", value).
+			Func(e.logThreshold(level.Name, threshold)).
+			Func(e.logBaseline(s)).
+			Str("operator", string(e.cfg.Operator)).
+			Msgf("%s threshold crossed, starting duration timer", level.Name)
+		return false
+	}
+	if now.Sub(ls.StartTime) < level.Duration {
+		return false
+	}
+
+	// Duration exceeded, transition to the level's active state
+	oldState := e.transition(s, e.states[next])
+	ls.ActiveSince = now
+	ls.ClearStartTime = time.Time{}
+	ls.Attempts = 1
+	if next == 0 {
+		s.PeakValue = value
+	}
+
+	e.log.Info().
+		Str("previous_state", string(oldState)).
+		Str("series", s.Labels.String()).
+		Str("new_state", string(s.State)).
+		Float64("value", value).
+		Func(e.logThreshold(level.Name, threshold)).
+		Func(e.logBaseline(s)).
+		Dur("duration", now.Sub(ls.StartTime)).
+		Msgf("state transition: entering %s threshold active state", level.Name)
+
+	if level.Plugin != nil && e.isLeader() {
+		event := e.newEvent(s, level, oldState, plugin.ReasonThresholdCrossed, value, ls.Attempts, ls.StartTime, now)
+		e.runAction(ctx, s, level, event, now)
+	}
+	return true
+}
+
+// repeat re-executes the plugin of the active level once its backoff period has passed
+func (e *Engine) repeat(ctx context.Context, s *Series, level *Level, value float64, now time.Time) {
+	ls := s.Level(level.Name)
+	if ls.BackoffUntil.IsZero() || !now.After(ls.BackoffUntil) {
+		return
+	}
+
+	e.log.Debug().
+		Msgf("%s threshold backoff period expired, can re-execute plugin", level.Name)
+
+	if level.Plugin != nil && e.isLeader() && !ls.ActionInFlight {
+		ls.Attempts++
+		event := e.newEvent(s, level, s.State, plugin.ReasonBackoffExpired, value, ls.Attempts, ls.StartTime, now)
+		e.runAction(ctx, s, level, event, now)
+	}
+}
+
+// deescalate leaves the active state of the level at index active for the state of the level
+// below it, or NotBreached for the first level, and runs the level's recovery plugin
+func (e *Engine) deescalate(ctx context.Context, s *Series, active int, value float64, now time.Time) {
+	level := e.cfg.Levels[active]
+
+	newState := NotBreached
+	if active > 0 {
+		newState = e.states[active-1]
+	}
+	oldState := e.transition(s, newState)
+	threshold := e.effective(s, level)
+	ls := s.Level(level.Name)
+	clearedFor := breachedFor(ls.ClearStartTime, now)
+	ls.StartTime = time.Time{}
+	ls.ClearStartTime = time.Time{}
+
+	e.log.Info().
+		Str("previous_state", string(oldState)).
+		Str("series", s.Labels.String()).
+		Str("new_state", string(s.State)).
+		Float64("value", value).
+		Func(e.logThreshold(level.Name, threshold)).
+		Func(e.logThreshold(level.Name+"_clear", clearLevel(e.cfg.Operator, threshold))).
+		Func(e.logBaseline(s)).
+		Dur("cleared_for", clearedFor).
+		Msgf("state transition: %s threshold cleared, leaving its active state", level.Name)
+
+	e.recover(ctx, s, level, oldState, value, now)
+}
+
+// AssumeBreached activates the configured levels immediately, one after the other, for series
+// whose data is missing with missing_value_behavior assume_breached. A level still in its
+// backoff period stops the escalation.
+func (e *Engine) AssumeBreached(ctx context.Context, s *Series) {
+	e.log.Warn().
+		Str("query", e.cfg.Query).
+		Str("series", s.Labels.String()).
+		Str("current_state", string(s.State)).
+		Msg("assuming thresholds breached for missing metric")
+
+	// For assume_breached, transition to active states respecting the state machine
+	now := e.Now()
+
+	for next := e.active(s) + 1; next < len(e.cfg.Levels); next++ {
+		level := e.cfg.Levels[next]
+		ls := s.Level(level.Name)
+
+		if !ls.BackoffUntil.IsZero() && !now.After(ls.BackoffUntil) {
+			e.log.Debug().
+				Time(level.Name+"_backoff_until", ls.BackoffUntil).
+				Msgf("skipping %s threshold activation - in backoff period", level.Name)
+			return
+		}
+
+		// Immediately transition to the level's active state
+		ls.StartTime = now
+		oldState := e.transition(s, e.states[next])
+		ls.ActiveSince = now
+		ls.ClearStartTime = time.Time{}
+		ls.Attempts = 1
+		if next == 0 {
+			s.PeakValue = 0
+		}
+
+		e.log.Info().
+			Str("series", s.Labels.String()).
+			Str("previous_state", string(oldState)).
+			Str("new_state", string(s.State)).
+			Str("reason", "assume_breached").
+			Msgf("state transition: assuming %s threshold breached due to missing data", level.Name)
+
+		if level.Plugin != nil && e.isLeader() {
+			event := e.newEvent(s, level, oldState, plugin.ReasonAssumeBreached, 0, ls.Attempts, now, now)
+			e.runAction(ctx, s, level, event, now)
+		}
+	}
+}
+
+// recover executes the recovery plugin of a level whose active state was left, then clears
+// the level's incident data. The peak value is cleared once the series is back to NotBreached.
+func (e *Engine) recover(ctx context.Context, s *Series, level *Level, previousState State, value float64, now time.Time) {
+	ls := s.Level(level.Name)
+	if level.RecoveryPlugin != nil && e.isLeader() {
+		event := e.newEvent(s, level, previousState, plugin.ReasonRecovered, value, 1, ls.ActiveSince, now)
+		e.runRecovery(ctx, s, level, event)
+	}
+
+	ls.ActiveSince = time.Time{}
+	ls.Attempts = 0
+	ls.recordActionResult(nil, now)
+	if s.State == NotBreached {
+		s.PeakValue = 0
+	}
+}
+
+// newEvent builds the event passed to the plugins of a level. The new state is the current
+// state of the series; startedAt is when the threshold was first crossed, or when the active
+// state was entered for recovery events.
+func (e *Engine) newEvent(
+	s *Series,
+	level *Level,
+	previousState State,
+	reason plugin.Reason,
+	value float64,
+	attempt int,
+	startedAt time.Time,
+	now time.Time,
+) *plugin.ThresholdEvent {
+	threshold := e.effective(s, level)
+	event := &plugin.ThresholdEvent{
+		Version:       plugin.EventVersion,
+		Monitor:       e.cfg.Monitor,
+		Query:         e.cfg.Query,
+		MetricName:    e.cfg.MetricName,
+		Labels:        s.LabelMap(),
+		Level:         level.Name,
+		Threshold:     threshold.Value,
+		Operator:      string(e.cfg.Operator),
+		Value:         value,
+		PeakValue:     s.PeakValue,
+		PreviousState: string(previousState),
+		NewState:      string(s.State),
+		Reason:        reason,
+		Attempt:       attempt,
+		Timestamp:     now,
+		StartedAt:     startedAt,
+		Duration:      breachedFor(startedAt, now),
+	}
+	if e.cfg.Operator.IsRange() {
+		lower, upper := threshold.Lower, threshold.Upper
+		event.Threshold, event.Lower, event.Upper = 0, &lower, &upper
+	}
+	if e.cfg.Relative && s.Baseline != nil {
+		mean, stddev := s.Baseline.Mean, s.Baseline.StdDev
+		event.BaselineMean, event.BaselineStdDev = &mean, &stddev
+	}
+	return event
+}
+
+// breachedFor returns how long an active state has lasted, or 0 if its start time is unknown
+func breachedFor(activeSince time.Time, now time.Time) time.Duration {
+	if activeSince.IsZero() {
+		return 0
+	}
+	return now.Sub(activeSince)
+}
@@ -0,0 +1,1042 @@
+package threshold
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"metric-reader/pkg/plugin"
+)
+
+// Mock plugin for testing
+type testPlugin struct {
+	name          string
+	executeCount  int
+	lastValue     float64
+	lastThreshold string
+	lastDuration  time.Duration
+	// calls, when set, records the names of the executed plugins in order
+	calls *[]string
+}
+
+func (p *testPlugin) HandleEvent(ctx context.Context, event *plugin.ThresholdEvent) error {
+	p.executeCount++
+	// Recovery plugins are checked against the peak value of the incident
+	p.lastValue = event.Value
+	if event.Reason == plugin.ReasonRecovered {
+		p.lastValue = event.PeakValue
+	}
+	p.lastThreshold = event.ThresholdString()
+	p.lastDuration = event.Duration
+	if p.calls != nil {
+		*p.calls = append(*p.calls, p.name)
+	}
+	return nil
+}
+
+func (p *testPlugin) Name() string {
+	return p.name
+}
+
+func (p *testPlugin) ValidateConfig() error {
+	return nil
+}
+
+// newTestEngine returns an engine evaluating test_query against the soft and hard levels
+// that are not nil
+func newTestEngine(t *testing.T, operator Operator, soft *Level, hard *Level, clock Clock) *Engine {
+	t.Helper()
+	var levels []*Level
+	for _, level := range []*Level{soft, hard} {
+		if level != nil {
+			levels = append(levels, level)
+		}
+	}
+	return newLevelsTestEngine(t, operator, levels, clock)
+}
+
+// newLevelsTestEngine returns an engine evaluating test_query against levels
+func newLevelsTestEngine(t *testing.T, operator Operator, levels []*Level, clock Clock) *Engine {
+	t.Helper()
+	e, err := NewEngine(Config{
+		Monitor:    "test",
+		MetricName: "test_metric",
+		Query:      "test_query",
+		Operator:   operator,
+		Levels:     levels,
+		Clock:      clock,
+	})
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	return e
+}
+
+// TestStateTransition_NotBreached_To_SoftActive tests the transition from NotBreached to SoftThresholdActive
+func TestStateTransition_NotBreached_To_SoftActive(t *testing.T) {
+	softPlugin := &testPlugin{name: "soft_plugin"}
+
+	state := NewSeries(nil)
+
+	clock := NewVirtualClock(time.Now())
+	e := newTestEngine(t, GreaterThan,
+		&Level{Name: "soft", Value: 80.0, Duration: 5 * time.Second, Plugin: softPlugin},
+		nil, clock)
+
+	// First call: value exceeds threshold but duration not yet met
+	e.Evaluate(context.Background(), state, 90.0)
+
+	if state.State != NotBreached {
+		t.Errorf("Expected state to remain NotBreached, got %s", state.State)
+	}
+
+	if state.Level("soft").StartTime.IsZero() {
+		t.Error("Expected SoftThresholdStartTime to be set")
+	}
+
+	if softPlugin.executeCount != 0 {
+		t.Errorf("Expected plugin not to be executed yet, but it was called %d times", softPlugin.executeCount)
+	}
+
+	// Call again once the duration is exceeded
+	clock.Advance(6 * time.Second)
+
+	e.Evaluate(context.Background(), state, 90.0)
+
+	if state.State != SoftThresholdActive {
+		t.Errorf("Expected state to transition to SoftThresholdActive, got %s", state.State)
+	}
+
+	if softPlugin.executeCount != 1 {
+		t.Errorf("Expected plugin to be executed once, but it was called %d times", softPlugin.executeCount)
+	}
+
+	if softPlugin.lastValue != 90.0 {
+		t.Errorf("Expected plugin to receive value 90.0, got %f", softPlugin.lastValue)
+	}
+}
+
+// TestStateTransition_SoftActive_To_NotBreached tests the transition from SoftThresholdActive back to NotBreached
+func TestStateTransition_SoftActive_To_NotBreached(t *testing.T) {
+	softPlugin := &testPlugin{name: "soft_plugin"}
+
+	state := NewSeries(nil)
+	state.State = SoftThresholdActive
+	state.Level("soft").StartTime = time.Now().Add(-10 * time.Second)
+
+	e := newTestEngine(t, GreaterThan,
+		&Level{Name: "soft", Value: 80.0, Duration: 5 * time.Second, Plugin: softPlugin},
+		nil, nil)
+
+	// Value no longer exceeds threshold
+	e.Evaluate(context.Background(), state, 70.0)
+
+	if state.State != NotBreached {
+		t.Errorf("Expected state to transition to NotBreached, got %s", state.State)
+	}
+
+	if !state.Level("soft").StartTime.IsZero() {
+		t.Error("Expected SoftThresholdStartTime to be reset")
+	}
+}
+
+// TestStateTransition_SoftActive_To_HardActive tests the transition from SoftThresholdActive to HardThresholdActive
+func TestStateTransition_SoftActive_To_HardActive(t *testing.T) {
+	softPlugin := &testPlugin{name: "soft_plugin"}
+	hardPlugin := &testPlugin{name: "hard_plugin"}
+
+	clock := NewVirtualClock(time.Now())
+	state := NewSeries(nil)
+	state.State = SoftThresholdActive
+	state.Level("soft").StartTime = clock.Now().Add(-10 * time.Second)
+
+	e := newTestEngine(t, GreaterThan,
+		&Level{Name: "soft", Value: 80.0, Duration: 5 * time.Second, Plugin: softPlugin},
+		&Level{Name: "hard", Value: 100.0, Duration: 5 * time.Second, Plugin: hardPlugin},
+		clock)
+
+	// First call: value exceeds hard threshold but duration not yet met
+	e.Evaluate(context.Background(), state, 110.0)
+
+	if state.State != SoftThresholdActive {
+		t.Errorf("Expected state to remain SoftThresholdActive, got %s", state.State)
+	}
+
+	if state.Level("hard").StartTime.IsZero() {
+		t.Error("Expected HardThresholdStartTime to be set")
+	}
+
+	if hardPlugin.executeCount != 0 {
+		t.Errorf("Expected hard plugin not to be executed yet, but it was called %d times", hardPlugin.executeCount)
+	}
+
+	// Call again once the duration is exceeded
+	clock.Advance(6 * time.Second)
+
+	e.Evaluate(context.Background(), state, 110.0)
+
+	if state.State != HardThresholdActive {
+		t.Errorf("Expected state to transition to HardThresholdActive, got %s", state.State)
+	}
+
+	if hardPlugin.executeCount != 1 {
+		t.Errorf("Expected hard plugin to be executed once, but it was called %d times", hardPlugin.executeCount)
+	}
+
+	if hardPlugin.lastValue != 110.0 {
+		t.Errorf("Expected hard plugin to receive value 110.0, got %f", hardPlugin.lastValue)
+	}
+}
+
+// TestStateTransition_HardActive_To_NotBreached tests the transition from HardThresholdActive back to NotBreached
+func TestStateTransition_HardActive_To_NotBreached(t *testing.T) {
+	softPlugin := &testPlugin{name: "soft_plugin"}
+	hardPlugin := &testPlugin{name: "hard_plugin"}
+
+	state := NewSeries(nil)
+	state.State = HardThresholdActive
+	state.Level("soft").StartTime = time.Now().Add(-20 * time.Second)
+	state.Level("hard").StartTime = time.Now().Add(-10 * time.Second)
+
+	e := newTestEngine(t, GreaterThan,
+		&Level{Name: "soft", Value: 80.0, Duration: 5 * time.Second, Plugin: softPlugin},
+		&Level{Name: "hard", Value: 100.0, Duration: 5 * time.Second, Plugin: hardPlugin},
+		nil)
+
+	// Value no longer exceeds either threshold
+	e.Evaluate(context.Background(), state, 70.0)
+
+	if state.State != NotBreached {
+		t.Errorf("Expected state to transition to NotBreached, got %s", state.State)
+	}
+
+	if !state.Level("soft").StartTime.IsZero() {
+		t.Error("Expected SoftThresholdStartTime to be reset")
+	}
+
+	if !state.Level("hard").StartTime.IsZero() {
+		t.Error("Expected HardThresholdStartTime to be reset")
+	}
+}
+
+// TestBackoffPeriod_SoftThreshold tests that backoff period prevents re-execution
+func TestBackoffPeriod_SoftThreshold(t *testing.T) {
+	softPlugin := &testPlugin{name: "soft_plugin"}
+
+	state := NewSeries(nil)
+	state.Level("soft").BackoffUntil = time.Now().Add(10 * time.Second) // In backoff for 10 seconds
+
+	e := newTestEngine(t, GreaterThan,
+		&Level{Name: "soft", Value: 80.0, Plugin: softPlugin},
+		nil, nil)
+
+	// Try to trigger threshold during backoff
+	e.Evaluate(context.Background(), state, 90.0)
+
+	if state.State != NotBreached {
+		t.Errorf("Expected state to remain NotBreached during backoff, got %s", state.State)
+	}
+
+	if softPlugin.executeCount != 0 {
+		t.Errorf("Expected plugin not to be executed during backoff, but it was called %d times", softPlugin.executeCount)
+	}
+}
+
+// TestBackoffPeriod_Expiry tests that plugin re-executes after backoff expires
+func TestBackoffPeriod_Expiry(t *testing.T) {
+	softPlugin := &testPlugin{name: "soft_plugin"}
+
+	state := NewSeries(nil)
+	state.State = SoftThresholdActive
+	state.Level("soft").StartTime = time.Now().Add(-10 * time.Second)
+	state.Level("soft").BackoffUntil = time.Now().Add(-1 * time.Second) // Backoff expired
+
+	e := newTestEngine(t, GreaterThan,
+		&Level{Name: "soft", Value: 80.0, Duration: 5 * time.Second, BackoffDelay: 10 * time.Second, Plugin: softPlugin},
+		nil, nil)
+
+	// Trigger with value still exceeding threshold after backoff expires
+	e.Evaluate(context.Background(), state, 90.0)
+
+	if state.State != SoftThresholdActive {
+		t.Errorf("Expected state to remain SoftThresholdActive, got %s", state.State)
+	}
+
+	if softPlugin.executeCount != 1 {
+		t.Errorf("Expected plugin to be re-executed after backoff, but it was called %d times", softPlugin.executeCount)
+	}
+}
+
+// TestLessThanOperator tests that less_than operator works correctly
+func TestLessThanOperator(t *testing.T) {
+	softPlugin := &testPlugin{name: "soft_plugin"}
+
+	state := NewSeries(nil)
+
+	e := newTestEngine(t, LessThan,
+		&Level{Name: "soft", Value: 20.0, Duration: 5 * time.Second, Plugin: softPlugin},
+		nil, nil)
+
+	// Value below threshold should trigger
+	state.Level("soft").StartTime = time.Now().Add(-6 * time.Second) // Simulate time passed
+	e.Evaluate(context.Background(), state, 10.0)
+
+	if state.State != SoftThresholdActive {
+		t.Errorf("Expected state to transition to SoftThresholdActive with less_than operator, got %s", state.State)
+	}
+
+	if softPlugin.executeCount != 1 {
+		t.Errorf("Expected plugin to be executed once, but it was called %d times", softPlugin.executeCount)
+	}
+}
+
+// TestHardThresholdOnly tests behavior when only hard threshold is configured
+func TestHardThresholdOnly(t *testing.T) {
+	hardPlugin := &testPlugin{name: "hard_plugin"}
+
+	state := NewSeries(nil)
+
+	e := newTestEngine(t, GreaterThan,
+		nil,
+		&Level{Name: "hard", Value: 100.0, Duration: 5 * time.Second, Plugin: hardPlugin},
+		nil)
+
+	// With only the hard threshold configured, it is the first level and is entered from NotBreached
+	state.Level("hard").StartTime = time.Now().Add(-6 * time.Second)
+	e.Evaluate(context.Background(), state, 110.0)
+
+	if state.State != HardThresholdActive {
+		t.Errorf("Expected state to transition to HardThresholdActive when only hard threshold configured, got %s", state.State)
+	}
+	if hardPlugin.executeCount != 1 {
+		t.Errorf("Expected hard plugin to be executed once, but it was called %d times", hardPlugin.executeCount)
+	}
+}
+
+// TestSoftThresholdOnly tests behavior when only soft threshold is configured
+func TestSoftThresholdOnly(t *testing.T) {
+	softPlugin := &testPlugin{name: "soft_plugin"}
+
+	state := NewSeries(nil)
+
+	e := newTestEngine(t, GreaterThan,
+		&Level{Name: "soft", Value: 80.0, Duration: 5 * time.Second, Plugin: softPlugin},
+		nil, nil)
+
+	// Should transition to SoftThresholdActive
+	state.Level("soft").StartTime = time.Now().Add(-6 * time.Second)
+	e.Evaluate(context.Background(), state, 90.0)
+
+	if state.State != SoftThresholdActive {
+		t.Errorf("Expected state to transition to SoftThresholdActive, got %s", state.State)
+	}
+
+	if softPlugin.executeCount != 1 {
+		t.Errorf("Expected soft plugin to be executed once, but it was called %d times", softPlugin.executeCount)
+	}
+}
+
+// TestNonLeaderDoesNotExecutePlugin tests that plugins are not executed when not leader
+func TestNonLeaderDoesNotExecutePlugin(t *testing.T) {
+	softPlugin := &testPlugin{name: "soft_plugin"}
+
+	state := NewSeries(nil)
+
+	e, err := NewEngine(Config{
+		Operator: GreaterThan,
+		Levels:   []*Level{{Name: "soft", Value: 80.0, Duration: 5 * time.Second, Plugin: softPlugin}},
+		IsLeader: func() bool { return false },
+	})
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+
+	// Simulate threshold already exceeded for duration
+	state.Level("soft").StartTime = time.Now().Add(-6 * time.Second)
+	e.Evaluate(context.Background(), state, 90.0)
+
+	// State should transition even if not leader
+	if state.State != SoftThresholdActive {
+		t.Errorf("Expected state to transition to SoftThresholdActive even when not leader, got %s", state.State)
+	}
+
+	// Plugin should NOT be executed when not leader
+	if softPlugin.executeCount != 0 {
+		t.Errorf("Expected plugin NOT to be executed when not leader, but it was called %d times", softPlugin.executeCount)
+	}
+}
+
+// TestOnlyRelevantThresholdsChecked verifies optimization that only relevant thresholds are checked per state
+func TestOnlyRelevantThresholdsChecked(t *testing.T) {
+	// This is more of a code review test - we verify the behavior works correctly
+	// The actual optimization is in the implementation where thresholds are only checked when needed
+
+	softPlugin := &testPlugin{name: "soft_plugin"}
+	hardPlugin := &testPlugin{name: "hard_plugin"}
+
+	state := NewSeries(nil)
+
+	e := newTestEngine(t, GreaterThan,
+		&Level{Name: "soft", Value: 80.0, Duration: 5 * time.Second, Plugin: softPlugin},
+		&Level{Name: "hard", Value: 100.0, Duration: 5 * time.Second, Plugin: hardPlugin},
+		nil)
+
+	// In NotBreached state with value only exceeding soft threshold
+	// Only soft threshold should be processed
+	state.Level("soft").StartTime = time.Now().Add(-6 * time.Second)
+	e.Evaluate(context.Background(), state, 90.0)
+
+	if state.State != SoftThresholdActive {
+		t.Errorf("Expected transition to SoftThresholdActive, got %s", state.State)
+	}
+
+	if softPlugin.executeCount != 1 {
+		t.Errorf("Expected soft plugin to execute once, got %d", softPlugin.executeCount)
+	}
+
+	if hardPlugin.executeCount != 0 {
+		t.Errorf("Expected hard plugin NOT to execute in NotBreached state, got %d executions", hardPlugin.executeCount)
+	}
+
+	// Now in SoftThresholdActive, exceed hard threshold
+	state.Level("hard").StartTime = time.Now().Add(-6 * time.Second)
+	e.Evaluate(context.Background(), state, 110.0)
+
+	if state.State != HardThresholdActive {
+		t.Errorf("Expected transition to HardThresholdActive, got %s", state.State)
+	}
+
+	if hardPlugin.executeCount != 1 {
+		t.Errorf("Expected hard plugin to execute once, got %d", hardPlugin.executeCount)
+	}
+}
+
+// TestRecoveryPlugin_SoftActive_To_NotBreached tests that the soft recovery plugin runs with
+// the peak value and the time spent in SoftThresholdActive
+func TestRecoveryPlugin_SoftActive_To_NotBreached(t *testing.T) {
+	recoveryPlugin := &testPlugin{name: "recovery_plugin"}
+
+	state := NewSeries(nil)
+	state.Level("soft").StartTime = time.Now().Add(-10 * time.Second)
+
+	e := newTestEngine(t, GreaterThan,
+		&Level{Name: "soft", Value: 80.0, Duration: 5 * time.Second, RecoveryPlugin: recoveryPlugin},
+		nil, nil)
+
+	// Enter SoftThresholdActive, then see a higher and a lower value while breached
+	e.Evaluate(context.Background(), state, 90.0)
+	if state.State != SoftThresholdActive {
+		t.Fatalf("Expected state to be SoftThresholdActive, got %s", state.State)
+	}
+	state.Level("soft").ActiveSince = time.Now().Add(-time.Minute)
+	e.Evaluate(context.Background(), state, 120.0)
+	e.Evaluate(context.Background(), state, 95.0)
+
+	if recoveryPlugin.executeCount != 0 {
+		t.Fatalf("Expected recovery plugin not to run while breached, got %d executions", recoveryPlugin.executeCount)
+	}
+
+	// Value drops below the soft threshold
+	e.Evaluate(context.Background(), state, 50.0)
+
+	if state.State != NotBreached {
+		t.Fatalf("Expected state to transition to NotBreached, got %s", state.State)
+	}
+	if recoveryPlugin.executeCount != 1 {
+		t.Fatalf("Expected recovery plugin to execute once, got %d", recoveryPlugin.executeCount)
+	}
+	if recoveryPlugin.lastValue != 120.0 {
+		t.Errorf("Expected recovery plugin to receive peak value 120, got %f", recoveryPlugin.lastValue)
+	}
+	if recoveryPlugin.lastDuration < time.Minute {
+		t.Errorf("Expected recovery plugin to receive at least 1m in the breached state, got %v", recoveryPlugin.lastDuration)
+	}
+	if !state.Level("soft").ActiveSince.IsZero() || state.PeakValue != 0 {
+		t.Error("Expected incident data to be reset after recovery")
+	}
+}
+
+// TestRecoveryPlugin_HardActive_To_NotBreached tests that leaving HardThresholdActive runs
+// both the hard and the soft recovery plugins
+func TestRecoveryPlugin_HardActive_To_NotBreached(t *testing.T) {
+	softRecovery := &testPlugin{name: "soft_recovery"}
+	hardRecovery := &testPlugin{name: "hard_recovery"}
+
+	state := NewSeries(nil)
+	state.State = HardThresholdActive
+	state.Level("soft").ActiveSince = time.Now().Add(-2 * time.Minute)
+	state.Level("hard").ActiveSince = time.Now().Add(-time.Minute)
+	state.PeakValue = 10.0
+
+	e := newTestEngine(t, LessThan,
+		&Level{Name: "soft", Value: 50.0, Duration: 5 * time.Second, RecoveryPlugin: softRecovery},
+		&Level{Name: "hard", Value: 20.0, Duration: 5 * time.Second, RecoveryPlugin: hardRecovery},
+		nil)
+
+	e.Evaluate(context.Background(), state, 60.0)
+
+	if state.State != NotBreached {
+		t.Fatalf("Expected state to transition to NotBreached, got %s", state.State)
+	}
+	if hardRecovery.executeCount != 1 || softRecovery.executeCount != 1 {
+		t.Fatalf("Expected both recovery plugins to execute once, got hard=%d soft=%d", hardRecovery.executeCount, softRecovery.executeCount)
+	}
+	if hardRecovery.lastValue != 10.0 || softRecovery.lastValue != 10.0 {
+		t.Errorf("Expected recovery plugins to receive peak value 10, got hard=%f soft=%f", hardRecovery.lastValue, softRecovery.lastValue)
+	}
+	if hardRecovery.lastDuration >= softRecovery.lastDuration {
+		t.Errorf("Expected hard breach duration (%v) to be shorter than soft breach duration (%v)", hardRecovery.lastDuration, softRecovery.lastDuration)
+	}
+}
+
+// TestStateMachine_HourLongDurations drives an incident with hour-long durations and backoffs
+// through a virtual clock
+func TestStateMachine_HourLongDurations(t *testing.T) {
+	softPlugin := &testPlugin{name: "soft_plugin"}
+	hardPlugin := &testPlugin{name: "hard_plugin"}
+	recoveryPlugin := &testPlugin{name: "recovery_plugin"}
+
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewVirtualClock(start)
+	state := NewSeries(nil)
+	e := newTestEngine(t, GreaterThan,
+		&Level{Name: "soft", Value: 80.0, Duration: time.Hour, BackoffDelay: 2 * time.Hour, Plugin: softPlugin, RecoveryPlugin: recoveryPlugin},
+		&Level{Name: "hard", Value: 95.0, Duration: 30 * time.Minute, BackoffDelay: 4 * time.Hour, Plugin: hardPlugin},
+		clock)
+
+	// tick evaluates value and advances the clock by a polling interval of 10 minutes
+	tick := func(value float64) {
+		e.Evaluate(context.Background(), state, value)
+		clock.Advance(10 * time.Minute)
+	}
+
+	// The soft threshold must be crossed for 1h before its plugin runs
+	for i := 0; i < 6; i++ {
+		tick(90)
+	}
+	if state.State != NotBreached || softPlugin.executeCount != 0 {
+		t.Fatalf("Expected NotBreached without executions after 50m, got %s with %d executions", state.State, softPlugin.executeCount)
+	}
+	tick(90)
+	if state.State != SoftThresholdActive || softPlugin.executeCount != 1 {
+		t.Fatalf("Expected SoftThresholdActive with 1 execution after 1h, got %s with %d executions", state.State, softPlugin.executeCount)
+	}
+	if want := start.Add(time.Hour).Add(2 * time.Hour); !state.Level("soft").BackoffUntil.Equal(want) {
+		t.Errorf("Expected soft backoff until %v, got %v", want, state.Level("soft").BackoffUntil)
+	}
+
+	// The hard threshold is crossed for 30m
+	for i := 0; i < 4; i++ {
+		tick(100)
+	}
+	if state.State != HardThresholdActive || hardPlugin.executeCount != 1 {
+		t.Fatalf("Expected HardThresholdActive with 1 execution, got %s with %d executions", state.State, hardPlugin.executeCount)
+	}
+
+	// The hard plugin runs again once its 4h backoff expired
+	for i := 0; i < 24; i++ {
+		tick(100)
+	}
+	if hardPlugin.executeCount != 1 {
+		t.Fatalf("Expected no hard re-execution within the backoff, got %d executions", hardPlugin.executeCount)
+	}
+	tick(100)
+	if hardPlugin.executeCount != 2 {
+		t.Fatalf("Expected a hard re-execution after the backoff, got %d executions", hardPlugin.executeCount)
+	}
+
+	// Recovery reports the time spent in SoftThresholdActive
+	recoveredAt := clock.Now()
+	tick(50)
+	if state.State != NotBreached {
+		t.Fatalf("Expected NotBreached after recovery, got %s", state.State)
+	}
+	if want := recoveredAt.Sub(start.Add(time.Hour)); recoveryPlugin.lastDuration != want {
+		t.Errorf("Expected recovery duration %v, got %v", want, recoveryPlugin.lastDuration)
+	}
+}
+
+// newEscalationLevels returns four greater_than levels whose plugins and recovery plugins
+// record their executions in calls
+func newEscalationLevels(calls *[]string) []*Level {
+	levels := []*Level{
+		{Name: "warn", Value: 50},
+		{Name: "degrade", Value: 70},
+		{Name: "critical", Value: 90},
+		{Name: "emergency", Value: 95},
+	}
+	for _, level := range levels {
+		level.Plugin = &testPlugin{name: level.Name, calls: calls}
+		level.RecoveryPlugin = &testPlugin{name: level.Name + "_recovery", calls: calls}
+	}
+	return levels
+}
+
+// TestLevels_EscalateOneStepAtATime tests that a series crossing every threshold enters the
+// levels one after the other, each after its own duration
+func TestLevels_EscalateOneStepAtATime(t *testing.T) {
+	var calls []string
+	clock := NewVirtualClock(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+	state := NewSeries(nil)
+	e := newLevelsTestEngine(t, GreaterThan, newEscalationLevels(&calls), clock)
+
+	want := []State{"WarnThresholdActive", "DegradeThresholdActive", "CriticalThresholdActive", "EmergencyThresholdActive"}
+	for _, next := range want {
+		// The first evaluation starts the level's timer, the second one enters the level
+		e.Evaluate(context.Background(), state, 99)
+		clock.Advance(time.Second)
+		if state.State == next {
+			t.Fatalf("Expected %s to be entered only after its duration", next)
+		}
+		e.Evaluate(context.Background(), state, 99)
+		clock.Advance(time.Second)
+		if state.State != next {
+			t.Fatalf("Expected %s, got %s", next, state.State)
+		}
+	}
+
+	if got := strings.Join(calls, ","); got != "warn,degrade,critical,emergency" {
+		t.Errorf("Expected every level's plugin to run once in order, got %s", got)
+	}
+	if got := e.Severity(state.State); got != 4 {
+		t.Errorf("Expected severity 4, got %d", got)
+	}
+}
+
+// TestLevels_DeescalateOneStepAtATime tests that leaving a level steps down through the levels
+// below it until one is still crossed, running every left level's recovery plugin
+func TestLevels_DeescalateOneStepAtATime(t *testing.T) {
+	var calls []string
+	var transitions []string
+	state := NewSeries(nil)
+	state.State = "EmergencyThresholdActive"
+	state.PeakValue = 99
+	for _, name := range []string{"warn", "degrade", "critical", "emergency"} {
+		state.Level(name).ActiveSince = time.Now().Add(-time.Minute)
+		state.Level(name).Attempts = 1
+	}
+
+	e, err := NewEngine(Config{
+		Operator: GreaterThan,
+		Levels:   newEscalationLevels(&calls),
+		OnTransition: func(s *Series, oldState State, newState State) {
+			transitions = append(transitions, string(oldState)+"->"+string(newState))
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+
+	// 80 is below critical and emergency but still above degrade
+	e.Evaluate(context.Background(), state, 80)
+
+	if state.State != "DegradeThresholdActive" {
+		t.Fatalf("Expected DegradeThresholdActive, got %s", state.State)
+	}
+	if got := strings.Join(transitions, ","); got != "EmergencyThresholdActive->CriticalThresholdActive,CriticalThresholdActive->DegradeThresholdActive" {
+		t.Errorf("Unexpected transitions: %s", got)
+	}
+	if got := strings.Join(calls, ","); got != "emergency_recovery,critical_recovery" {
+		t.Errorf("Expected the emergency and critical recovery plugins to run, got %s", got)
+	}
+	if state.Level("critical").Attempts != 0 || state.Level("degrade").Attempts != 1 {
+		t.Error("Expected the incident data of the left levels only to be reset")
+	}
+	if state.PeakValue != 99 {
+		t.Errorf("Expected the peak value to be kept while a level is active, got %f", state.PeakValue)
+	}
+
+	calls, transitions = nil, nil
+	e.Evaluate(context.Background(), state, 10)
+
+	if state.State != NotBreached {
+		t.Fatalf("Expected NotBreached, got %s", state.State)
+	}
+	if got := strings.Join(calls, ","); got != "degrade_recovery,warn_recovery" {
+		t.Errorf("Expected the degrade and warn recovery plugins to run, got %s", got)
+	}
+	if state.PeakValue != 0 {
+		t.Errorf("Expected the peak value to be reset, got %f", state.PeakValue)
+	}
+}
+
+// TestStateTransition_HardActive_To_SoftActive tests that a series steps down to
+// SoftThresholdActive when only the hard threshold is no longer crossed
+func TestStateTransition_HardActive_To_SoftActive(t *testing.T) {
+	softPlugin := &testPlugin{name: "soft_plugin"}
+	hardRecovery := &testPlugin{name: "hard_recovery"}
+
+	state := NewSeries(nil)
+	state.State = HardThresholdActive
+
+	e := newTestEngine(t, GreaterThan,
+		&Level{Name: "soft", Value: 80.0, Plugin: softPlugin},
+		&Level{Name: "hard", Value: 100.0, RecoveryPlugin: hardRecovery},
+		nil)
+
+	e.Evaluate(context.Background(), state, 90.0)
+
+	if state.State != SoftThresholdActive {
+		t.Errorf("Expected state to transition to SoftThresholdActive, got %s", state.State)
+	}
+	if hardRecovery.executeCount != 1 || softPlugin.executeCount != 0 {
+		t.Errorf("Expected only the hard recovery plugin to run, got hard_recovery=%d soft=%d", hardRecovery.executeCount, softPlugin.executeCount)
+	}
+}
+
+// TestActiveState tests the active state names derived from level names
+func TestActiveState(t *testing.T) {
+	tests := map[string]State{
+		"soft":      SoftThresholdActive,
+		"hard":      HardThresholdActive,
+		"very_high": "VeryHighThresholdActive",
+		"p1-page":   "P1PageThresholdActive",
+	}
+	for name, want := range tests {
+		if got := ActiveState(name); got != want {
+			t.Errorf("ActiveState(%q) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+// TestNewEngine_Validation tests that invalid configurations are rejected
+func TestNewEngine_Validation(t *testing.T) {
+	soft := &Level{Name: "soft", Value: 80}
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "unknown operator", cfg: Config{Operator: "above", Levels: []*Level{soft}}},
+		{name: "no thresholds", cfg: Config{Operator: GreaterThan}},
+		{name: "negative duration", cfg: Config{Operator: GreaterThan, Levels: []*Level{{Name: "soft", Duration: -time.Second}}}},
+		{name: "unnamed level", cfg: Config{Operator: GreaterThan, Levels: []*Level{{Value: 80}}}},
+		{name: "duplicate level", cfg: Config{Operator: GreaterThan, Levels: []*Level{soft, {Name: "soft", Value: 90}}}},
+		{name: "same active state", cfg: Config{Operator: GreaterThan, Levels: []*Level{{Name: "very_high", Value: 80}, {Name: "very-high", Value: 90}}}},
+		{name: "levels out of order", cfg: Config{Operator: GreaterThan, Levels: []*Level{soft, {Name: "hard", Value: 70}}}},
+		{name: "less_than levels out of order", cfg: Config{Operator: LessThan, Levels: []*Level{{Name: "soft", Value: 20}, {Name: "hard", Value: 30}}}},
+		{name: "negative clear duration", cfg: Config{Operator: GreaterThan, Levels: []*Level{{Name: "soft", Value: 80, ClearDuration: -time.Second}}}},
+		{name: "negative hysteresis", cfg: Config{Operator: GreaterThan, Levels: []*Level{{Name: "soft", Value: 80, Hysteresis: -5}}}},
+		{name: "clear threshold and hysteresis", cfg: Config{Operator: GreaterThan, Levels: []*Level{{Name: "soft", Value: 80, ClearValue: floatPtr(70), Hysteresis: 5}}}},
+		{name: "clear threshold past threshold", cfg: Config{Operator: GreaterThan, Levels: []*Level{{Name: "soft", Value: 80, ClearValue: floatPtr(90)}}}},
+		{name: "less_than clear threshold past threshold", cfg: Config{Operator: LessThan, Levels: []*Level{{Name: "soft", Value: 20, ClearValue: floatPtr(10)}}}},
+		{name: "lower bound above upper bound", cfg: Config{Operator: OutsideRange, Levels: []*Level{{Name: "soft", Lower: 20, Upper: 10}}}},
+		{name: "outside_range levels out of order", cfg: Config{Operator: OutsideRange, Levels: []*Level{{Name: "soft", Lower: 10, Upper: 20}, {Name: "hard", Lower: 12, Upper: 25}}}},
+		{name: "inside_range levels out of order", cfg: Config{Operator: InsideRange, Levels: []*Level{{Name: "soft", Lower: 10, Upper: 20}, {Name: "hard", Lower: 5, Upper: 15}}}},
+		{name: "equal levels with different thresholds", cfg: Config{Operator: Equal, Levels: []*Level{{Name: "soft", Value: 0}, {Name: "hard", Value: 1}}}},
+		{name: "greater_or_equal levels out of order", cfg: Config{Operator: GreaterOrEqual, Levels: []*Level{soft, {Name: "hard", Value: 70}}}},
+		{name: "clear threshold with a range", cfg: Config{Operator: OutsideRange, Levels: []*Level{{Name: "soft", Lower: 10, Upper: 20, ClearValue: floatPtr(15)}}}},
+		{name: "hysteresis with equal", cfg: Config{Operator: Equal, Levels: []*Level{{Name: "soft", Value: 0, Hysteresis: 1}}}},
+		{name: "hysteresis wider than the range", cfg: Config{Operator: OutsideRange, Levels: []*Level{{Name: "soft", Lower: 10, Upper: 20, Hysteresis: 6}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewEngine(tt.cfg); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+// activeSoftSeries returns a series in SoftThresholdActive
+func activeSoftSeries() *Series {
+	state := NewSeries(nil)
+	state.State = SoftThresholdActive
+	state.Level("soft").ActiveSince = time.Now()
+	return state
+}
+
+// TestHysteresis_KeepsActiveStateInBand tests that the active state is only left once the
+// value is past the hysteresis band
+func TestHysteresis_KeepsActiveStateInBand(t *testing.T) {
+	tests := []struct {
+		name     string
+		operator Operator
+		value    float64
+		inBand   float64
+		cleared  float64
+	}{
+		{name: "greater_than", operator: GreaterThan, value: 80, inBand: 75, cleared: 70},
+		{name: "less_than", operator: LessThan, value: 20, inBand: 25, cleared: 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recovery := &testPlugin{name: "soft_recovery"}
+			state := activeSoftSeries()
+			e := newTestEngine(t, tt.operator,
+				&Level{Name: "soft", Value: tt.value, Hysteresis: 10, RecoveryPlugin: recovery},
+				nil, NewVirtualClock(time.Now()))
+
+			e.Evaluate(context.Background(), state, tt.inBand)
+			if state.State != SoftThresholdActive {
+				t.Fatalf("Expected SoftThresholdActive inside the hysteresis band, got %s", state.State)
+			}
+
+			e.Evaluate(context.Background(), state, tt.cleared)
+			if state.State != NotBreached {
+				t.Fatalf("Expected NotBreached past the hysteresis band, got %s", state.State)
+			}
+			if recovery.executeCount != 1 {
+				t.Errorf("Expected the recovery plugin to run once, got %d", recovery.executeCount)
+			}
+		})
+	}
+}
+
+// TestClearDuration tests that the active state is only left once the value stayed past the
+// clear threshold for the clear duration, and that the clear timer restarts when it does not
+func TestClearDuration(t *testing.T) {
+	softPlugin := &testPlugin{name: "soft_plugin"}
+	state := activeSoftSeries()
+	clock := NewVirtualClock(time.Now())
+	e := newTestEngine(t, GreaterThan,
+		&Level{Name: "soft", Value: 80, ClearValue: floatPtr(70), ClearDuration: 10 * time.Second, Plugin: softPlugin},
+		nil, clock)
+
+	e.Evaluate(context.Background(), state, 60)
+	if state.State != SoftThresholdActive {
+		t.Fatalf("Expected SoftThresholdActive before the clear duration, got %s", state.State)
+	}
+	if !state.Level("soft").ClearStartTime.Equal(clock.Now()) {
+		t.Error("Expected the clear timer to start")
+	}
+
+	// Back inside the band: the clear timer restarts, the action does not run again
+	clock.Advance(6 * time.Second)
+	e.Evaluate(context.Background(), state, 75)
+	if !state.Level("soft").ClearStartTime.IsZero() {
+		t.Error("Expected the clear timer to be reset")
+	}
+	if softPlugin.executeCount != 0 {
+		t.Errorf("Expected no action below the threshold, got %d executions", softPlugin.executeCount)
+	}
+
+	e.Evaluate(context.Background(), state, 60)
+	clock.Advance(6 * time.Second)
+	e.Evaluate(context.Background(), state, 60)
+	if state.State != SoftThresholdActive {
+		t.Fatalf("Expected SoftThresholdActive after a restarted clear timer, got %s", state.State)
+	}
+
+	clock.Advance(4 * time.Second)
+	e.Evaluate(context.Background(), state, 60)
+	if state.State != NotBreached {
+		t.Fatalf("Expected NotBreached after the clear duration, got %s", state.State)
+	}
+	if !state.Level("soft").IsZero() {
+		t.Errorf("Expected the soft level state to be reset, got %+v", *state.Level("soft"))
+	}
+}
+
+// TestOperators tests the state machine with every operator: the series enters
+// SoftThresholdActive on a crossing value and returns to NotBreached on a value that is not
+func TestOperators(t *testing.T) {
+	tests := []struct {
+		operator Operator
+		level    Level
+		crossed  []float64
+		cleared  []float64
+	}{
+		{operator: GreaterThan, level: Level{Value: 80}, crossed: []float64{80.5, 100}, cleared: []float64{80, 10}},
+		{operator: GreaterOrEqual, level: Level{Value: 80}, crossed: []float64{80, 100}, cleared: []float64{79.5, 10}},
+		{operator: LessThan, level: Level{Value: 20}, crossed: []float64{19.5, 0}, cleared: []float64{20, 90}},
+		{operator: LessOrEqual, level: Level{Value: 20}, crossed: []float64{20, 0}, cleared: []float64{20.5, 90}},
+		{operator: Equal, level: Level{Value: 0}, crossed: []float64{0}, cleared: []float64{1, -1}},
+		{operator: NotEqual, level: Level{Value: 1}, crossed: []float64{0, 2}, cleared: []float64{1}},
+		{operator: OutsideRange, level: Level{Lower: 10, Upper: 20}, crossed: []float64{9.5, 20.5, -5, 100}, cleared: []float64{10, 15, 20}},
+		{operator: InsideRange, level: Level{Lower: 10, Upper: 20}, crossed: []float64{10, 15, 20}, cleared: []float64{9.5, 20.5, -5, 100}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.operator), func(t *testing.T) {
+			for _, crossed := range tt.crossed {
+				for _, cleared := range tt.cleared {
+					softPlugin := &testPlugin{name: "soft_plugin"}
+					recovery := &testPlugin{name: "soft_recovery"}
+					level := tt.level
+					level.Name, level.Plugin, level.RecoveryPlugin = "soft", softPlugin, recovery
+					e := newTestEngine(t, tt.operator, &level, nil, NewVirtualClock(time.Now()))
+					state := NewSeries(nil)
+
+					e.Evaluate(context.Background(), state, cleared)
+					if state.State != NotBreached {
+						t.Fatalf("Expected %v not to cross, got %s", cleared, state.State)
+					}
+					// The first crossing starts the zero duration timer, the second enters the state
+					e.Evaluate(context.Background(), state, crossed)
+					e.Evaluate(context.Background(), state, crossed)
+					if state.State != SoftThresholdActive || softPlugin.executeCount != 1 {
+						t.Fatalf("Expected %v to cross and run the plugin, got %s with %d executions", crossed, state.State, softPlugin.executeCount)
+					}
+					e.Evaluate(context.Background(), state, cleared)
+					if state.State != NotBreached || recovery.executeCount != 1 {
+						t.Fatalf("Expected %v to clear and run the recovery plugin, got %s with %d executions", cleared, state.State, recovery.executeCount)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestParseOperator tests that every operator is accepted and unknown ones are rejected
+func TestParseOperator(t *testing.T) {
+	for _, operator := range operators {
+		if got, err := ParseOperator(string(operator)); err != nil || got != operator {
+			t.Errorf("ParseOperator(%q) = %q, %v", operator, got, err)
+		}
+	}
+	if _, err := ParseOperator("between"); err == nil || !strings.Contains(err.Error(), "'inside_range'") {
+		t.Errorf("Expected an error listing the operators, got %v", err)
+	}
+}
+
+// TestOutsideRange_Levels tests escalation through nested ranges, the peak value and the
+// range bounds passed to plugins
+func TestOutsideRange_Levels(t *testing.T) {
+	var events []*plugin.ThresholdEvent
+	state := NewSeries(nil)
+	e, err := NewEngine(Config{
+		Operator: OutsideRange,
+		Levels: []*Level{
+			{Name: "soft", Lower: 10, Upper: 20, BackoffDelay: time.Hour, Plugin: &testPlugin{name: "soft_plugin"}},
+			{Name: "hard", Lower: 5, Upper: 25, BackoffDelay: time.Hour, Plugin: &testPlugin{name: "hard_plugin"}},
+		},
+		Execute: func(ctx context.Context, p plugin.ActionPlugin, event *plugin.ThresholdEvent) error {
+			events = append(events, event)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+
+	e.Evaluate(context.Background(), state, 22)
+	e.Evaluate(context.Background(), state, 22)
+	if state.State != SoftThresholdActive {
+		t.Fatalf("Expected SoftThresholdActive above the soft range, got %s", state.State)
+	}
+	e.Evaluate(context.Background(), state, 2)
+	e.Evaluate(context.Background(), state, 2)
+	if state.State != HardThresholdActive {
+		t.Fatalf("Expected HardThresholdActive below the hard range, got %s", state.State)
+	}
+	if state.PeakValue != 2 {
+		t.Errorf("Expected peak value 2, the furthest from the soft range, got %v", state.PeakValue)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	hard := events[1]
+	if hard.Lower == nil || hard.Upper == nil || *hard.Lower != 5 || *hard.Upper != 25 {
+		t.Fatalf("Expected the hard range bounds in the event, got %v and %v", hard.Lower, hard.Upper)
+	}
+	if got := hard.ThresholdString(); got != "outside_range [5.00, 25.00]" {
+		t.Errorf("Unexpected threshold string %q", got)
+	}
+
+	e.Evaluate(context.Background(), state, 15)
+	if state.State != NotBreached {
+		t.Fatalf("Expected NotBreached inside both ranges, got %s", state.State)
+	}
+}
+
+// TestRangeHysteresis tests that hysteresis narrows the range a series must return to
+// before leaving outside_range and widens it for inside_range
+func TestRangeHysteresis(t *testing.T) {
+	tests := []struct {
+		operator Operator
+		crossed  float64
+		inBand   float64
+		cleared  float64
+	}{
+		{operator: OutsideRange, crossed: 25, inBand: 19, cleared: 15},
+		{operator: InsideRange, crossed: 15, inBand: 21, cleared: 25},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.operator), func(t *testing.T) {
+			state := NewSeries(nil)
+			e := newTestEngine(t, tt.operator,
+				&Level{Name: "soft", Lower: 10, Upper: 20, Hysteresis: 2, Plugin: &testPlugin{name: "soft_plugin"}},
+				nil, NewVirtualClock(time.Now()))
+
+			e.Evaluate(context.Background(), state, tt.crossed)
+			e.Evaluate(context.Background(), state, tt.crossed)
+			e.Evaluate(context.Background(), state, tt.inBand)
+			if state.State != SoftThresholdActive {
+				t.Fatalf("Expected SoftThresholdActive inside the hysteresis band, got %s", state.State)
+			}
+			e.Evaluate(context.Background(), state, tt.cleared)
+			if state.State != NotBreached {
+				t.Fatalf("Expected NotBreached past the hysteresis band, got %s", state.State)
+			}
+		})
+	}
+}
+
+func TestNewBaseline(t *testing.T) {
+	b := NewBaseline([]float64{2, 4, 4, 4, 5, 5, 7, 9})
+	if b.Mean != 5 || b.StdDev != 2 || b.Samples != 8 {
+		t.Errorf("Expected mean 5 and stddev 2 from 8 samples, got %+v", b)
+	}
+	if b := NewBaseline(nil); b != (Baseline{}) {
+		t.Errorf("Expected an empty baseline, got %+v", b)
+	}
+}
+
+// TestRelativeThresholds tests thresholds given in standard deviations from the baseline
+// of the series and the computed boundary passed to plugins
+func TestRelativeThresholds(t *testing.T) {
+	var events []*plugin.ThresholdEvent
+	state := NewSeries(nil)
+	e, err := NewEngine(Config{
+		Operator: GreaterThan,
+		Relative: true,
+		Levels: []*Level{
+			{Name: "soft", Value: 2, Hysteresis: 0.5, BackoffDelay: time.Hour, Plugin: &testPlugin{name: "soft_plugin"}},
+		},
+		Execute: func(ctx context.Context, p plugin.ActionPlugin, event *plugin.ThresholdEvent) error {
+			events = append(events, event)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+
+	e.Evaluate(context.Background(), state, 1000)
+	e.Evaluate(context.Background(), state, 1000)
+	if state.State != NotBreached {
+		t.Fatalf("Expected NotBreached without a baseline, got %s", state.State)
+	}
+
+	state.Baseline = &Baseline{Mean: 100, StdDev: 10, Samples: 60}
+	e.Evaluate(context.Background(), state, 125)
+	e.Evaluate(context.Background(), state, 125)
+	if state.State != SoftThresholdActive {
+		t.Fatalf("Expected SoftThresholdActive past mean + 2 stddev, got %s", state.State)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	event := events[0]
+	if event.Threshold != 120 || event.BaselineMean == nil || *event.BaselineMean != 100 || *event.BaselineStdDev != 10 {
+		t.Errorf("Expected threshold 120 from mean 100 and stddev 10, got %v, %v and %v", event.Threshold, event.BaselineMean, event.BaselineStdDev)
+	}
+
+	// The hysteresis of 0.5 stddev keeps the level active down to 115
+	e.Evaluate(context.Background(), state, 116)
+	if state.State != SoftThresholdActive {
+		t.Fatalf("Expected SoftThresholdActive inside the hysteresis band, got %s", state.State)
+	}
+
+	// A higher baseline moves the boundary past the value
+	state.Baseline = &Baseline{Mean: 130, StdDev: 10, Samples: 60}
+	e.Evaluate(context.Background(), state, 125)
+	if state.State != NotBreached {
+		t.Fatalf("Expected NotBreached below the new baseline's boundary, got %s", state.State)
+	}
+}
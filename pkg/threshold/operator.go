@@ -0,0 +1,147 @@
+package threshold
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Operator decides on which side of a threshold a value is crossed
+type Operator string
+
+const (
+	GreaterThan    Operator = "greater_than"
+	GreaterOrEqual Operator = "greater_or_equal"
+	LessThan       Operator = "less_than"
+	LessOrEqual    Operator = "less_or_equal"
+	Equal          Operator = "equal"
+	NotEqual       Operator = "not_equal"
+	// OutsideRange and InsideRange compare values against the Lower and Upper bounds of a
+	// level instead of its Value; both bounds are part of the range
+	OutsideRange Operator = "outside_range"
+	InsideRange  Operator = "inside_range"
+)
+
+// operators lists the supported operators in the order they are documented
+var operators = []Operator{GreaterThan, GreaterOrEqual, LessThan, LessOrEqual, Equal, NotEqual, OutsideRange, InsideRange}
+
+// ParseOperator parses the threshold_operator setting
+func ParseOperator(s string) (Operator, error) {
+	names := make([]string, len(operators))
+	for i, operator := range operators {
+		if s == string(operator) {
+			return operator, nil
+		}
+		names[i] = "'" + string(operator) + "'"
+	}
+	return "", fmt.Errorf("threshold operator must be one of %s", strings.Join(names, ", "))
+}
+
+// IsRange reports whether the operator compares values against the Lower and Upper bounds
+// of a level instead of its Value
+func (o Operator) IsRange() bool {
+	return o == OutsideRange || o == InsideRange
+}
+
+// IsDirectional reports whether the operator crosses its threshold on one side only, which
+// makes a clear threshold on the other side meaningful
+func (o Operator) IsDirectional() bool {
+	switch o {
+	case GreaterThan, GreaterOrEqual, LessThan, LessOrEqual:
+		return true
+	default:
+		return false
+	}
+}
+
+// inclusive reports whether a value on the threshold crosses it
+func (o Operator) inclusive() bool {
+	switch o {
+	case GreaterOrEqual, LessOrEqual, Equal, InsideRange:
+		return true
+	default:
+		return false
+	}
+}
+
+// Severity returns how far value is past the threshold of level, larger meaning more severe.
+// The threshold is crossed when the severity is positive, or zero for the inclusive operators
+// (greater_or_equal, less_or_equal, equal and inside_range).
+func (o Operator) Severity(value float64, level *Level) float64 {
+	switch o {
+	case GreaterThan, GreaterOrEqual:
+		return value - level.Value
+	case LessThan, LessOrEqual:
+		return level.Value - value
+	case Equal:
+		return -math.Abs(value - level.Value)
+	case NotEqual:
+		return math.Abs(value - level.Value)
+	case OutsideRange:
+		return math.Max(level.Lower-value, value-level.Upper)
+	case InsideRange:
+		return math.Min(value-level.Lower, level.Upper-value)
+	default:
+		return math.Inf(-1)
+	}
+}
+
+// Crossed reports whether value crosses the threshold of level
+func (o Operator) Crossed(value float64, level *Level) bool {
+	return o.crossed(o.Severity(value, level))
+}
+
+// crossed reports whether a severity returned by Severity crosses the threshold
+func (o Operator) crossed(severity float64) bool {
+	if o.inclusive() {
+		return severity >= 0
+	}
+	return severity > 0
+}
+
+// Nested reports whether every value crossing the threshold of level also crosses the
+// threshold of previous, so that level may follow previous in escalation order
+func (o Operator) Nested(previous *Level, level *Level) bool {
+	switch o {
+	case GreaterThan, GreaterOrEqual:
+		return level.Value >= previous.Value
+	case LessThan, LessOrEqual:
+		return level.Value <= previous.Value
+	case Equal, NotEqual:
+		return level.Value == previous.Value
+	case OutsideRange:
+		return level.Lower <= previous.Lower && level.Upper >= previous.Upper
+	case InsideRange:
+		return level.Lower >= previous.Lower && level.Upper <= previous.Upper
+	default:
+		return false
+	}
+}
+
+// FormatThreshold formats the threshold of level for logs and errors
+func (o Operator) FormatThreshold(level *Level) string {
+	if o.IsRange() {
+		return fmt.Sprintf("[%v, %v]", level.Lower, level.Upper)
+	}
+	return fmt.Sprintf("%v", level.Value)
+}
+
+// Widen returns a copy of level whose threshold is moved hysteresis away from the crossed
+// side, so that it is crossed by every value within hysteresis of crossing level. It is not
+// defined for equal and not_equal, which return level unchanged.
+func (o Operator) Widen(level *Level, hysteresis float64) *Level {
+	widened := *level
+	switch o {
+	case GreaterThan, GreaterOrEqual:
+		widened.Value -= hysteresis
+	case LessThan, LessOrEqual:
+		widened.Value += hysteresis
+	case OutsideRange:
+		widened.Lower += hysteresis
+		widened.Upper -= hysteresis
+	case InsideRange:
+		widened.Lower -= hysteresis
+		widened.Upper += hysteresis
+	}
+	return &widened
+}
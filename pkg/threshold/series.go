@@ -0,0 +1,112 @@
+package threshold
+
+import (
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/prometheus/common/model"
+)
+
+// State is a state of the threshold state machine
+type State string
+
+const (
+	NotBreached         State = "NotBreached"
+	SoftThresholdActive State = "SoftThresholdActive"
+	HardThresholdActive State = "HardThresholdActive"
+)
+
+// ActiveState returns the state of a series while the level with the given name is active:
+// the name in camel case followed by "ThresholdActive", so "soft" is SoftThresholdActive
+func ActiveState(level string) State {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(level, func(r rune) bool { return r == '_' || r == '-' || r == ' ' }) {
+		first, size := utf8.DecodeRuneInString(part)
+		b.WriteRune(unicode.ToUpper(first))
+		b.WriteString(part[size:])
+	}
+	return State(b.String() + "ThresholdActive")
+}
+
+// LevelState holds the state of a series for a single threshold level
+type LevelState struct {
+	// StartTime is when the threshold was first crossed; the level becomes active once it
+	// stayed crossed for the level's duration
+	StartTime    time.Time
+	BackoffUntil time.Time
+	// ClearStartTime is when the value of an active level was first back past its clear value;
+	// the level is left once it stayed there for the level's clear duration
+	ClearStartTime time.Time
+
+	// ActiveSince is when the level's active state was entered, passed to recovery plugins
+	ActiveSince time.Time
+	// Attempts is the number of action executions since the level became active
+	Attempts int
+
+	// Last action failure, cleared by the next successful execution or when the level is left
+	ActionFailedAt time.Time
+	ActionError    string
+
+	// Set while the level's action runs on a Dispatcher
+	ActionInFlight bool
+}
+
+// IsZero reports whether the level holds no state
+func (l *LevelState) IsZero() bool {
+	return *l == LevelState{}
+}
+
+// recordActionResult records the outcome of the level's action
+func (l *LevelState) recordActionResult(err error, now time.Time) {
+	l.ActionFailedAt, l.ActionError = time.Time{}, ""
+	if err != nil {
+		l.ActionFailedAt, l.ActionError = now, err.Error()
+	}
+}
+
+// Series holds the state machine state of a single series. The engine evaluating it must be
+// called with the lock guarding the series held.
+type Series struct {
+	Labels model.Metric
+	State  State
+
+	// PeakValue is the most severe value seen since the first level became active, passed
+	// to recovery plugins
+	PeakValue float64
+
+	// Levels holds the state of each threshold level by level name; see Level
+	Levels map[string]*LevelState
+
+	// Baseline is the history the thresholds of a Config.Relative engine are applied to;
+	// such an engine doesn't evaluate the series while it is nil
+	Baseline *Baseline
+}
+
+// NewSeries returns the state of a series that has not breached any threshold
+func NewSeries(labels model.Metric) *Series {
+	return &Series{Labels: labels, State: NotBreached}
+}
+
+// Level returns the state of the series for the named level, adding it when missing
+func (s *Series) Level(name string) *LevelState {
+	if s.Levels == nil {
+		s.Levels = make(map[string]*LevelState)
+	}
+	level, ok := s.Levels[name]
+	if !ok {
+		level = &LevelState{}
+		s.Levels[name] = level
+	}
+	return level
+}
+
+// LabelMap converts the labels of the series into the map passed to plugins
+func (s *Series) LabelMap() map[string]string {
+	labels := make(map[string]string, len(s.Labels))
+	for name, value := range s.Labels {
+		labels[string(name)] = string(value)
+	}
+	return labels
+}
@@ -10,29 +10,47 @@ import (
 	"time"
 
 	"github.com/rs/zerolog/log"
+	pluginapi "metric-reader/pkg/plugin"
 )
 
-// ActionPlugin defines the interface that all threshold action plugins must implement
-type ActionPlugin interface {
-	// Execute is called when a threshold is crossed and maintained for the specified duration
-	Execute(ctx context.Context, metricName string, value float64, threshold string, duration time.Duration) error
-	// Name returns the name of the plugin
-	Name() string
-	// ValidateConfig validates that all required configuration for the plugin is present
-	// Returns an error if configuration is invalid or missing required values
-	ValidateConfig() error
+// executePlugin hands a threshold event to a plugin and records the outcome and latency
+// of the execution. A plugin without retries failed its action when the execution fails.
+func executePlugin(ctx context.Context, p pluginapi.ActionPlugin, event *pluginapi.ThresholdEvent) error {
+	// Chains and retries record each execution of the plugins they run
+	switch p := p.(type) {
+	case *pluginChain:
+		return p.HandleEvent(ctx, event)
+	case *retryingPlugin:
+		return p.HandleEvent(ctx, event)
+	}
+
+	err := runPlugin(ctx, p, event)
+	if err != nil {
+		actionFailuresTotal.WithLabelValues(event.Monitor, event.Level, p.Name()).Inc()
+	}
+	return err
 }
 
-// PluginRegistry holds all registered plugins
-var PluginRegistry = make(map[string]ActionPlugin)
+// runPlugin executes a plugin once and records the outcome and latency of the execution
+func runPlugin(ctx context.Context, p pluginapi.ActionPlugin, event *pluginapi.ThresholdEvent) error {
+	start := time.Now()
+	err := p.HandleEvent(ctx, event)
+	recordPluginExecution(p, start, err)
+	return err
+}
 
-// RegisterPlugin adds a plugin to the registry
-func RegisterPlugin(p ActionPlugin) {
-	PluginRegistry[p.Name()] = p
+// recordPluginExecution records the outcome and latency of a plugin execution
+func recordPluginExecution(p pluginapi.ActionPlugin, start time.Time, err error) {
+	pluginExecutionDuration.WithLabelValues(p.Name()).Observe(time.Since(start).Seconds())
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	pluginExecutionsTotal.WithLabelValues(p.Name(), result).Inc()
 }
 
 // LoadPlugin loads a plugin from a shared library file
-func LoadPlugin(pluginPath string) (ActionPlugin, error) {
+func LoadPlugin(pluginPath string) (pluginapi.ActionPlugin, error) {
 	p, err := plugin.Open(pluginPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load plugin: %v", err)
@@ -43,42 +61,126 @@ func LoadPlugin(pluginPath string) (ActionPlugin, error) {
 		return nil, fmt.Errorf("plugin symbol not found: %v", err)
 	}
 
-	actionPlugin, ok := symPlugin.(ActionPlugin)
-	if !ok {
-		return nil, fmt.Errorf("plugin does not implement ActionPlugin interface")
+	// Plugins written against the Execute signature are adapted to ActionPlugin
+	switch p := symPlugin.(type) {
+	case pluginapi.ActionPlugin:
+		return p, nil
+	case legacyActionPlugin:
+		return legacyPlugin{p}, nil
+	default:
+		return nil, fmt.Errorf("plugin implements neither HandleEvent nor Execute of the ActionPlugin interface")
+	}
+}
+
+// legacyActionPlugin is the interface of plugins written before plugins received a
+// pluginapi.ThresholdEvent
+type legacyActionPlugin interface {
+	Execute(ctx context.Context, metricName string, value float64, threshold string, duration time.Duration) error
+	Name() string
+	ValidateConfig() error
+}
+
+// legacySeriesPlugin is optionally implemented by legacy plugins that need the labels of
+// the series; it is called instead of Execute
+type legacySeriesPlugin interface {
+	ExecuteForSeries(ctx context.Context, metricName string, labels map[string]string, value float64, threshold string, duration time.Duration) error
+}
+
+// legacyRecoveryPlugin is optionally implemented by legacy plugins used as recovery_plugin;
+// it is called for recovery events with the peak value and how long the state was active
+type legacyRecoveryPlugin interface {
+	Recover(ctx context.Context, metricName string, labels map[string]string, peakValue float64, threshold string, breachedFor time.Duration) error
+}
+
+// legacyPlugin delivers threshold events to a legacy plugin through the methods it implements.
+// Recovery events reach plugins without Recover with the peak value as value.
+type legacyPlugin struct {
+	legacyActionPlugin
+}
+
+func (p legacyPlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
+	threshold := event.ThresholdString()
+	value := event.Value
+
+	if event.Reason == pluginapi.ReasonRecovered {
+		if rp, ok := p.legacyActionPlugin.(legacyRecoveryPlugin); ok {
+			return rp.Recover(ctx, event.MetricName, event.Labels, event.PeakValue, threshold, event.Duration)
+		}
+		value = event.PeakValue
+	}
+
+	if sp, ok := p.legacyActionPlugin.(legacySeriesPlugin); ok {
+		return sp.ExecuteForSeries(ctx, event.MetricName, event.Labels, value, threshold, event.Duration)
+	}
+	return p.legacyActionPlugin.Execute(ctx, event.MetricName, value, threshold, event.Duration)
+}
+
+// pluginNameFromFile returns the plugin name for a file in the plugin directory.
+// Shared libraries are named <plugin>.so; exec plugins are executables named <plugin> without extension.
+func pluginNameFromFile(entry os.DirEntry) (string, bool) {
+	if entry.IsDir() {
+		return "", false
+	}
+	if strings.HasSuffix(entry.Name(), ".so") {
+		return strings.TrimSuffix(entry.Name(), ".so"), true
+	}
+	if filepath.Ext(entry.Name()) != "" || strings.HasPrefix(entry.Name(), ".") {
+		return "", false
+	}
+	info, err := entry.Info()
+	if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+		return "", false
+	}
+	return entry.Name(), true
+}
+
+// loadPluginFile loads a shared library plugin with plugin.Open and any other file as an exec plugin
+func loadPluginFile(pluginPath string) (pluginapi.ActionPlugin, error) {
+	if strings.HasSuffix(pluginPath, ".so") {
+		return LoadPlugin(pluginPath)
 	}
+	return LoadExecPlugin(pluginPath)
+}
 
-	return actionPlugin, nil
+// exportPluginEnv sets the environment variables plugins read their configuration from, so
+// [plugins.<name>] sections reach shared library plugins (read in init) and exec plugins (inherited)
+func exportPluginEnv(env map[string]string) error {
+	for name, value := range env {
+		if err := os.Setenv(name, value); err != nil {
+			return fmt.Errorf("failed to set %s: %v", name, err)
+		}
+	}
+	return nil
 }
 
-// LoadPluginsFromDirectory loads all plugins from a directory
-func LoadPluginsFromDirectory(dir string) error {
+// LoadPluginsFromDirectory loads all plugins from a directory into registry
+func LoadPluginsFromDirectory(registry *pluginapi.Registry, dir string) error {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return fmt.Errorf("failed to read plugin directory: %v", err)
 	}
 
 	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".so") {
+		if _, ok := pluginNameFromFile(entry); !ok {
 			continue
 		}
 
 		pluginPath := filepath.Join(dir, entry.Name())
-		plugin, err := LoadPlugin(pluginPath)
+		plugin, err := loadPluginFile(pluginPath)
 		if err != nil {
 			log.Error().Err(err).Str("plugin", entry.Name()).Msg("failed to load plugin")
 			continue
 		}
 
-		RegisterPlugin(plugin)
+		registry.Register(plugin)
 		log.Info().Str("plugin", plugin.Name()).Msg("plugin loaded successfully")
 	}
 
 	return nil
 }
 
-// LoadRequiredPlugins loads only the specified plugins from a directory and validates their configuration
-func LoadRequiredPlugins(dir string, requiredPlugins map[string]bool) error {
+// LoadRequiredPlugins loads only the specified plugins from a directory into registry and validates their configuration
+func LoadRequiredPlugins(registry *pluginapi.Registry, dir string, requiredPlugins map[string]bool) error {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return fmt.Errorf("failed to read plugin directory: %v", err)
@@ -87,13 +189,12 @@ func LoadRequiredPlugins(dir string, requiredPlugins map[string]bool) error {
 	loadedPlugins := make(map[string]bool)
 
 	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".so") {
+		// Extract plugin name from filename (remove .so extension)
+		pluginName, ok := pluginNameFromFile(entry)
+		if !ok {
 			continue
 		}
 
-		// Extract plugin name from filename (remove .so extension)
-		pluginName := strings.TrimSuffix(entry.Name(), ".so")
-
 		// Only load the plugin if it's required
 		if !requiredPlugins[pluginName] {
 			log.Debug().Str("plugin", pluginName).Msg("plugin skipped - not required")
@@ -101,7 +202,7 @@ func LoadRequiredPlugins(dir string, requiredPlugins map[string]bool) error {
 		}
 
 		pluginPath := filepath.Join(dir, entry.Name())
-		plugin, err := LoadPlugin(pluginPath)
+		plugin, err := loadPluginFile(pluginPath)
 		if err != nil {
 			log.Error().Err(err).Str("plugin", entry.Name()).Msg("failed to load plugin")
 			continue
@@ -120,7 +221,7 @@ func LoadRequiredPlugins(dir string, requiredPlugins map[string]bool) error {
 			return fmt.Errorf("plugin '%s' configuration validation failed: %v", plugin.Name(), err)
 		}
 
-		RegisterPlugin(plugin)
+		registry.Register(plugin)
 		loadedPlugins[plugin.Name()] = true
 		log.Info().Str("plugin", plugin.Name()).Msg("plugin loaded and validated successfully")
 	}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	pluginapi "metric-reader/pkg/plugin"
+)
+
+// chainExecution is how the plugins of a chain are run
+type chainExecution string
+
+const (
+	// chainExecutionSequential runs the plugins one after another in the configured order
+	chainExecutionSequential chainExecution = "sequential"
+	// chainExecutionParallel runs all plugins at the same time
+	chainExecutionParallel chainExecution = "parallel"
+)
+
+// chainFailurePolicy decides which plugins run after a failure and whether the chain succeeded.
+// The threshold's backoff only starts when the chain succeeded.
+type chainFailurePolicy string
+
+const (
+	// failurePolicyStopOnError stops at the first failing plugin (parallel chains cancel the
+	// plugins still running); the chain succeeds when no plugin failed
+	failurePolicyStopOnError chainFailurePolicy = "stop_on_error"
+	// failurePolicyContinue runs all plugins; the chain succeeds when at least one plugin succeeded
+	failurePolicyContinue chainFailurePolicy = "continue"
+	// failurePolicyAllMustSucceed runs all plugins; the chain succeeds when every plugin succeeded
+	failurePolicyAllMustSucceed chainFailurePolicy = "all_must_succeed"
+)
+
+func parseChainExecution(executionStr string) (chainExecution, error) {
+	switch executionStr {
+	case "", string(chainExecutionSequential):
+		return chainExecutionSequential, nil
+	case string(chainExecutionParallel):
+		return chainExecutionParallel, nil
+	default:
+		return "", fmt.Errorf("execution must be 'sequential' or 'parallel'")
+	}
+}
+
+func parseChainFailurePolicy(policyStr string) (chainFailurePolicy, error) {
+	switch policyStr {
+	case "", string(failurePolicyStopOnError):
+		return failurePolicyStopOnError, nil
+	case string(failurePolicyContinue):
+		return failurePolicyContinue, nil
+	case string(failurePolicyAllMustSucceed):
+		return failurePolicyAllMustSucceed, nil
+	default:
+		return "", fmt.Errorf("failure policy must be 'stop_on_error', 'continue' or 'all_must_succeed'")
+	}
+}
+
+// pluginChain runs several plugins for a threshold. It implements ActionPlugin so the state
+// machine treats a chain like a single plugin: the chain's error decides whether backoff starts.
+type pluginChain struct {
+	plugins       []pluginapi.ActionPlugin
+	execution     chainExecution
+	failurePolicy chainFailurePolicy
+}
+
+// newPluginChain returns the plugin itself for a single plugin and a chain otherwise
+func newPluginChain(plugins []pluginapi.ActionPlugin, execution chainExecution, failurePolicy chainFailurePolicy) pluginapi.ActionPlugin {
+	if len(plugins) == 1 {
+		return plugins[0]
+	}
+	return &pluginChain{plugins: plugins, execution: execution, failurePolicy: failurePolicy}
+}
+
+// HandleEvent runs the plugins of the chain. Each plugin's execution is recorded on its own.
+func (c *pluginChain) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
+	var errs []error
+	if c.execution == chainExecutionParallel {
+		errs = c.runParallel(ctx, event)
+	} else {
+		errs = c.runSequential(ctx, event)
+	}
+
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", c.plugins[i].Name(), err))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	chainErr := fmt.Errorf("%d of %d plugins failed: %s", len(failed), len(c.plugins), strings.Join(failed, "; "))
+	if c.failurePolicy == failurePolicyContinue && len(failed) < len(c.plugins) {
+		log.Warn().
+			Err(chainErr).
+			Str("plugin", c.Name()).
+			Str("failure_policy", string(c.failurePolicy)).
+			Msg("plugin chain partially failed")
+		return nil
+	}
+	return chainErr
+}
+
+// runSequential runs the plugins in order and returns their errors by index.
+// Plugins skipped after a failure have a nil error.
+func (c *pluginChain) runSequential(ctx context.Context, event *pluginapi.ThresholdEvent) []error {
+	errs := make([]error, len(c.plugins))
+	for i, p := range c.plugins {
+		errs[i] = executePlugin(ctx, p, event)
+		if errs[i] != nil && c.failurePolicy == failurePolicyStopOnError {
+			if skipped := len(c.plugins) - i - 1; skipped > 0 {
+				log.Warn().
+					Err(errs[i]).
+					Str("plugin", p.Name()).
+					Int("skipped_plugins", skipped).
+					Msg("plugin failed, skipping the rest of the chain")
+			}
+			break
+		}
+	}
+	return errs
+}
+
+// runParallel runs all plugins at once and returns their errors by index. With stop_on_error
+// the context of the other plugins is cancelled as soon as one fails.
+func (c *pluginChain) runParallel(ctx context.Context, event *pluginapi.ThresholdEvent) []error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make([]error, len(c.plugins))
+	var wg sync.WaitGroup
+	for i, p := range c.plugins {
+		wg.Add(1)
+		go func(i int, p pluginapi.ActionPlugin) {
+			defer wg.Done()
+			errs[i] = executePlugin(ctx, p, event)
+			if errs[i] != nil && c.failurePolicy == failurePolicyStopOnError {
+				cancel()
+			}
+		}(i, p)
+	}
+	wg.Wait()
+	return errs
+}
+
+// Name returns the names of the chained plugins, e.g. "log_action,webhook"
+func (c *pluginChain) Name() string {
+	names := make([]string, len(c.plugins))
+	for i, p := range c.plugins {
+		names[i] = p.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// ValidateConfig validates the configuration of every plugin in the chain
+func (c *pluginChain) ValidateConfig() error {
+	for _, p := range c.plugins {
+		if err := p.ValidateConfig(); err != nil {
+			return fmt.Errorf("plugin '%s': %v", p.Name(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pluginapi "metric-reader/pkg/plugin"
+	"metric-reader/pkg/threshold"
+)
+
+// chainTestPlugin counts its executions and returns err
+type chainTestPlugin struct {
+	name  string
+	err   error
+	calls atomic.Int32
+	// blockUntilCancelled makes the plugin wait for its context to end
+	blockUntilCancelled bool
+}
+
+func (p *chainTestPlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
+	p.calls.Add(1)
+	if p.blockUntilCancelled {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+			return fmt.Errorf("not cancelled")
+		}
+	}
+	return p.err
+}
+
+func (p *chainTestPlugin) Name() string {
+	return p.name
+}
+
+func (p *chainTestPlugin) ValidateConfig() error {
+	return nil
+}
+
+func TestNewPluginChain_SinglePlugin(t *testing.T) {
+	p := &chainTestPlugin{name: "only"}
+	if got := newPluginChain([]pluginapi.ActionPlugin{p}, chainExecutionSequential, failurePolicyStopOnError); got != p {
+		t.Errorf("expected a single plugin to be returned as is, got %T", got)
+	}
+}
+
+func TestPluginChain_FailurePolicies(t *testing.T) {
+	tests := []struct {
+		name      string
+		execution chainExecution
+		policy    chainFailurePolicy
+		errs      []error
+		wantCalls []int32
+		wantErr   bool
+	}{
+		{"sequential stop_on_error succeeds", chainExecutionSequential, failurePolicyStopOnError, []error{nil, nil, nil}, []int32{1, 1, 1}, false},
+		{"sequential stop_on_error skips the rest", chainExecutionSequential, failurePolicyStopOnError, []error{nil, fmt.Errorf("boom"), nil}, []int32{1, 1, 0}, true},
+		{"continue succeeds with a partial failure", chainExecutionSequential, failurePolicyContinue, []error{fmt.Errorf("boom"), nil, nil}, []int32{1, 1, 1}, false},
+		{"continue fails when all fail", chainExecutionSequential, failurePolicyContinue, []error{fmt.Errorf("boom"), fmt.Errorf("boom"), fmt.Errorf("boom")}, []int32{1, 1, 1}, true},
+		{"all_must_succeed runs all and fails", chainExecutionSequential, failurePolicyAllMustSucceed, []error{fmt.Errorf("boom"), nil, nil}, []int32{1, 1, 1}, true},
+		{"parallel all_must_succeed", chainExecutionParallel, failurePolicyAllMustSucceed, []error{nil, nil, fmt.Errorf("boom")}, []int32{1, 1, 1}, true},
+		{"parallel continue", chainExecutionParallel, failurePolicyContinue, []error{nil, nil, fmt.Errorf("boom")}, []int32{1, 1, 1}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var plugins []pluginapi.ActionPlugin
+			var testPlugins []*chainTestPlugin
+			for i, err := range tt.errs {
+				p := &chainTestPlugin{name: fmt.Sprintf("plugin_%d", i), err: err}
+				plugins = append(plugins, p)
+				testPlugins = append(testPlugins, p)
+			}
+			chain := newPluginChain(plugins, tt.execution, tt.policy)
+
+			err := executePlugin(context.Background(), chain, &pluginapi.ThresholdEvent{MetricName: "test_metric"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error: %v, got %v", tt.wantErr, err)
+			}
+			for i, p := range testPlugins {
+				if got := p.calls.Load(); got != tt.wantCalls[i] {
+					t.Errorf("expected %s to be called %d times, got %d", p.name, tt.wantCalls[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestPluginChain_ParallelStopOnErrorCancelsOthers(t *testing.T) {
+	slow := &chainTestPlugin{name: "slow", blockUntilCancelled: true}
+	failing := &chainTestPlugin{name: "failing", err: fmt.Errorf("boom")}
+	chain := newPluginChain([]pluginapi.ActionPlugin{slow, failing}, chainExecutionParallel, failurePolicyStopOnError)
+
+	start := time.Now()
+	err := chain.(*pluginChain).HandleEvent(context.Background(), &pluginapi.ThresholdEvent{MetricName: "test_metric"})
+	if err == nil || !strings.Contains(err.Error(), "2 of 2 plugins failed") {
+		t.Errorf("expected both plugins to fail, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the slow plugin to be cancelled, took %v", elapsed)
+	}
+}
+
+func TestPluginChain_NameAndValidateConfig(t *testing.T) {
+	chain := newPluginChain([]pluginapi.ActionPlugin{
+		&chainTestPlugin{name: "log_action"},
+		&mockInvalidPlugin{name: "mock_invalid"},
+	}, chainExecutionSequential, failurePolicyStopOnError)
+
+	if got := chain.Name(); got != "log_action,mock_invalid" {
+		t.Errorf("expected chain name 'log_action,mock_invalid', got %q", got)
+	}
+	if err := chain.ValidateConfig(); err == nil || !strings.Contains(err.Error(), "mock_invalid") {
+		t.Errorf("expected validation error naming the invalid plugin, got %v", err)
+	}
+}
+
+// TestPluginChain_FailureSkipsBackoff verifies the failure policy decides whether the backoff starts
+func TestPluginChain_FailureSkipsBackoff(t *testing.T) {
+	for _, tt := range []struct {
+		policy      chainFailurePolicy
+		wantBackoff bool
+	}{
+		{failurePolicyContinue, true},
+		{failurePolicyAllMustSucceed, false},
+	} {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			chain := newPluginChain([]pluginapi.ActionPlugin{
+				&chainTestPlugin{name: "ok"},
+				&chainTestPlugin{name: "failing", err: fmt.Errorf("boom")},
+			}, chainExecutionSequential, tt.policy)
+
+			state := threshold.NewSeries(nil)
+			state.Level("soft").StartTime = time.Now().Add(-10 * time.Second)
+			e := newTestEngine(t, "test", &threshold.Level{Name: "soft", Value: 80.0, Duration: 5 * time.Second, BackoffDelay: time.Minute, Plugin: chain}, nil)
+
+			e.Evaluate(context.Background(), state, 90.0)
+
+			if got := !state.Level("soft").BackoffUntil.IsZero(); got != tt.wantBackoff {
+				t.Errorf("expected backoff set: %v, got %v", tt.wantBackoff, got)
+			}
+		})
+	}
+}
+
+func TestParseChainExecutionAndFailurePolicy(t *testing.T) {
+	if got, err := parseChainExecution(""); err != nil || got != chainExecutionSequential {
+		t.Errorf("expected default sequential execution, got %q, %v", got, err)
+	}
+	if _, err := parseChainExecution("random"); err == nil {
+		t.Error("expected error for invalid execution")
+	}
+	if got, err := parseChainFailurePolicy(""); err != nil || got != failurePolicyStopOnError {
+		t.Errorf("expected default stop_on_error policy, got %q, %v", got, err)
+	}
+	if _, err := parseChainFailurePolicy("ignore"); err == nil {
+		t.Error("expected error for invalid failure policy")
+	}
+}
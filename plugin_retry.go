@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	pluginapi "metric-reader/pkg/plugin"
+)
+
+// retryPolicy decides how often and how fast a failing plugin execution is retried
+type retryPolicy struct {
+	// maxRetries is the number of retries after the first attempt; 0 disables retries
+	maxRetries      int
+	initialInterval time.Duration
+	maxInterval     time.Duration
+	multiplier      float64
+	// jitter randomizes each interval by up to ±jitter (0.2 = ±20%)
+	jitter float64
+	// maxElapsedTime bounds the time spent on an execution including retries; 0 means unbounded
+	maxElapsedTime time.Duration
+}
+
+// newRetryPolicy validates a retry configuration
+func newRetryPolicy(cfg RetryConfig) (retryPolicy, error) {
+	if cfg.MaxRetries < 0 {
+		return retryPolicy{}, fmt.Errorf("max_retries must not be negative, got %d", cfg.MaxRetries)
+	}
+	if cfg.InitialInterval < 0 || cfg.MaxInterval < 0 || cfg.MaxElapsedTime < 0 {
+		return retryPolicy{}, fmt.Errorf("initial_interval, max_interval and max_elapsed_time must not be negative")
+	}
+	if cfg.Multiplier < 1 {
+		return retryPolicy{}, fmt.Errorf("multiplier must be at least 1, got %v", cfg.Multiplier)
+	}
+	if cfg.Jitter < 0 || cfg.Jitter > 1 {
+		return retryPolicy{}, fmt.Errorf("jitter must be between 0 and 1, got %v", cfg.Jitter)
+	}
+	return retryPolicy{
+		maxRetries:      cfg.MaxRetries,
+		initialInterval: cfg.InitialInterval,
+		maxInterval:     cfg.MaxInterval,
+		multiplier:      cfg.Multiplier,
+		jitter:          cfg.Jitter,
+		maxElapsedTime:  cfg.MaxElapsedTime,
+	}, nil
+}
+
+// interval returns the delay before the given retry (starting at 1). random is in [0, 1)
+// and spreads the delay over ±jitter so retries of many series don't run in lockstep.
+func (p retryPolicy) interval(retry int, random float64) time.Duration {
+	d := float64(p.initialInterval) * math.Pow(p.multiplier, float64(retry-1))
+	if p.maxInterval > 0 && d > float64(p.maxInterval) {
+		d = float64(p.maxInterval)
+	}
+	d *= 1 + p.jitter*(2*random-1)
+	return time.Duration(d)
+}
+
+// retryPolicies holds the default retry policy and the per-plugin overrides
+type retryPolicies struct {
+	defaultPolicy retryPolicy
+	plugins       map[string]retryPolicy
+}
+
+// newRetryPolicies builds the retry policies from the [retry] and [plugins.<name>.retry] sections
+func newRetryPolicies(config *Config) (*retryPolicies, error) {
+	defaultPolicy, err := newRetryPolicy(config.Retry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retry configuration: %v", err)
+	}
+	policies := &retryPolicies{defaultPolicy: defaultPolicy, plugins: make(map[string]retryPolicy)}
+	for name, cfg := range config.PluginRetries {
+		policy, err := newRetryPolicy(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry configuration for plugin '%s': %v", name, err)
+		}
+		policies.plugins[name] = policy
+	}
+	return policies, nil
+}
+
+// forPlugin returns the retry policy of a plugin
+func (p *retryPolicies) forPlugin(name string) retryPolicy {
+	if policy, ok := p.plugins[name]; ok {
+		return policy
+	}
+	return p.defaultPolicy
+}
+
+// enabled reports whether any plugin is retried
+func (p *retryPolicies) enabled() bool {
+	if p.defaultPolicy.maxRetries > 0 {
+		return true
+	}
+	for _, policy := range p.plugins {
+		if policy.maxRetries > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRetryPolicies wraps every plugin of the registry that has retries so its executions
+// are retried per its policy
+func applyRetryPolicies(registry *pluginapi.Registry, policies *retryPolicies) {
+	for _, name := range registry.Names() {
+		policy := policies.forPlugin(name)
+		if policy.maxRetries == 0 {
+			continue
+		}
+		p, _ := registry.Get(name)
+		registry.Set(name, newRetryingPlugin(p, policy))
+	}
+}
+
+// retryingPlugin retries the executions of a plugin with exponential backoff. When the retries
+// are exhausted the action failed: it is logged, counted in metric_reader_action_failures_total
+// and the error is returned to the state machine.
+type retryingPlugin struct {
+	plugin pluginapi.ActionPlugin
+	policy retryPolicy
+	// sleep waits between retries; it returns early with an error when ctx ends
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func newRetryingPlugin(p pluginapi.ActionPlugin, policy retryPolicy) *retryingPlugin {
+	return &retryingPlugin{plugin: p, policy: policy, sleep: sleepContext}
+}
+
+// HandleEvent executes the plugin, retrying failed executions. Retries receive a copy
+// of the event with Retry set.
+func (r *retryingPlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
+	start := time.Now()
+	attemptEvent := event
+	for retry := 0; ; retry++ {
+		err := runPlugin(ctx, r.plugin, attemptEvent)
+		if err == nil {
+			if retry > 0 {
+				log.Info().
+					Str("plugin", r.Name()).
+					Str("monitor", event.Monitor).
+					Str("threshold_level", event.Level).
+					Int("retries", retry).
+					Msg("plugin execution succeeded after retries")
+			}
+			return nil
+		}
+
+		delay := r.policy.interval(retry+1, rand.Float64())
+		exhausted := retry >= r.policy.maxRetries ||
+			(r.policy.maxElapsedTime > 0 && time.Since(start)+delay > r.policy.maxElapsedTime)
+		if !exhausted {
+			log.Warn().
+				Err(err).
+				Str("plugin", r.Name()).
+				Str("monitor", event.Monitor).
+				Str("threshold_level", event.Level).
+				Int("retry", retry+1).
+				Int("max_retries", r.policy.maxRetries).
+				Dur("delay", delay).
+				Msg("plugin execution failed, retrying")
+			pluginRetriesTotal.WithLabelValues(r.Name()).Inc()
+			if sleepErr := r.sleep(ctx, delay); sleepErr != nil {
+				err = fmt.Errorf("%v (retry aborted: %v)", err, sleepErr)
+				exhausted = true
+			}
+		}
+		if exhausted {
+			actionFailuresTotal.WithLabelValues(event.Monitor, event.Level, r.Name()).Inc()
+			log.Error().
+				Err(err).
+				Str("plugin", r.Name()).
+				Str("monitor", event.Monitor).
+				Str("threshold_level", event.Level).
+				Str("reason", string(event.Reason)).
+				Int("attempts", retry+1).
+				Dur("elapsed", time.Since(start)).
+				Msg("action failed")
+			return fmt.Errorf("action failed after %d attempts: %v", retry+1, err)
+		}
+
+		retryEvent := *event
+		retryEvent.Retry = retry + 1
+		attemptEvent = &retryEvent
+	}
+}
+
+// Name returns the name of the wrapped plugin
+func (r *retryingPlugin) Name() string {
+	return r.plugin.Name()
+}
+
+// ValidateConfig validates the configuration of the wrapped plugin
+func (r *retryingPlugin) ValidateConfig() error {
+	return r.plugin.ValidateConfig()
+}
+
+// sleepContext waits for d or until ctx ends
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
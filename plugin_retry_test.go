@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	pluginapi "metric-reader/pkg/plugin"
+	"metric-reader/pkg/threshold"
+)
+
+// flakyPlugin fails its first failures executions and records the events it received
+type flakyPlugin struct {
+	name     string
+	failures int
+	events   []pluginapi.ThresholdEvent
+}
+
+func (p *flakyPlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
+	p.events = append(p.events, *event)
+	if len(p.events) <= p.failures {
+		return fmt.Errorf("failure %d", len(p.events))
+	}
+	return nil
+}
+
+func (p *flakyPlugin) Name() string {
+	return p.name
+}
+
+func (p *flakyPlugin) ValidateConfig() error {
+	return nil
+}
+
+// newTestRetryingPlugin returns a retrying plugin recording its delays instead of sleeping
+func newTestRetryingPlugin(p pluginapi.ActionPlugin, policy retryPolicy, delays *[]time.Duration) *retryingPlugin {
+	r := newRetryingPlugin(p, policy)
+	r.sleep = func(ctx context.Context, d time.Duration) error {
+		*delays = append(*delays, d)
+		return nil
+	}
+	return r
+}
+
+func TestRetryPolicyInterval(t *testing.T) {
+	policy := retryPolicy{initialInterval: time.Second, maxInterval: 5 * time.Second, multiplier: 2}
+
+	for retry, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second} {
+		if got := policy.interval(retry, 0.5); got != want {
+			t.Errorf("retry %d: expected %v, got %v", retry, want, got)
+		}
+	}
+
+	policy.jitter = 0.2
+	if got := policy.interval(1, 0); got != 800*time.Millisecond {
+		t.Errorf("expected lowest jittered interval 800ms, got %v", got)
+	}
+	if got := policy.interval(1, 0.999999); got < 1199*time.Millisecond || got > 1200*time.Millisecond {
+		t.Errorf("expected highest jittered interval close to 1.2s, got %v", got)
+	}
+}
+
+func TestNewRetryPolicy_Validation(t *testing.T) {
+	valid := RetryConfig{MaxRetries: 3, InitialInterval: time.Second, MaxInterval: time.Minute, Multiplier: 2, Jitter: 0.2}
+	if _, err := newRetryPolicy(valid); err != nil {
+		t.Errorf("expected valid retry configuration, got %v", err)
+	}
+
+	tests := map[string]func(c *RetryConfig){
+		"negative max_retries": func(c *RetryConfig) { c.MaxRetries = -1 },
+		"negative interval":    func(c *RetryConfig) { c.InitialInterval = -time.Second },
+		"multiplier below 1":   func(c *RetryConfig) { c.Multiplier = 0.5 },
+		"jitter above 1":       func(c *RetryConfig) { c.Jitter = 1.5 },
+	}
+	for name, modify := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := valid
+			modify(&cfg)
+			if _, err := newRetryPolicy(cfg); err == nil {
+				t.Error("expected validation error")
+			}
+		})
+	}
+}
+
+func TestRetryingPlugin_SucceedsAfterRetries(t *testing.T) {
+	plugin := &flakyPlugin{name: "retry_test_flaky", failures: 2}
+	var delays []time.Duration
+	r := newTestRetryingPlugin(plugin, retryPolicy{maxRetries: 3, initialInterval: time.Second, multiplier: 2}, &delays)
+
+	event := &pluginapi.ThresholdEvent{Monitor: "cpu", Level: "soft", Attempt: 1}
+	if err := executePlugin(context.Background(), r, event); err != nil {
+		t.Fatalf("expected success after retries, got %v", err)
+	}
+
+	if len(plugin.events) != 3 {
+		t.Fatalf("expected 3 executions, got %d", len(plugin.events))
+	}
+	for i, e := range plugin.events {
+		if e.Retry != i || e.Attempt != 1 {
+			t.Errorf("execution %d: expected retry %d of attempt 1, got retry %d of attempt %d", i, i, e.Retry, e.Attempt)
+		}
+	}
+	if len(delays) != 2 || delays[0] != time.Second || delays[1] != 2*time.Second {
+		t.Errorf("expected delays [1s 2s], got %v", delays)
+	}
+	if got := testutil.ToFloat64(pluginRetriesTotal.WithLabelValues("retry_test_flaky")); got != 2 {
+		t.Errorf("expected 2 retries counted, got %v", got)
+	}
+	if got := testutil.ToFloat64(pluginExecutionsTotal.WithLabelValues("retry_test_flaky", "error")); got != 2 {
+		t.Errorf("expected each failed execution to be recorded, got %v", got)
+	}
+}
+
+func TestRetryingPlugin_ExhaustedRetriesFailAction(t *testing.T) {
+	plugin := &flakyPlugin{name: "retry_test_failing", failures: 10}
+	var delays []time.Duration
+	r := newTestRetryingPlugin(plugin, retryPolicy{maxRetries: 2, initialInterval: time.Second, multiplier: 1}, &delays)
+
+	err := r.HandleEvent(context.Background(), &pluginapi.ThresholdEvent{Monitor: "cpu", Level: "hard"})
+	if err == nil || !strings.Contains(err.Error(), "action failed after 3 attempts: failure 3") {
+		t.Errorf("expected action failure after 3 attempts, got %v", err)
+	}
+	if got := testutil.ToFloat64(actionFailuresTotal.WithLabelValues("cpu", "hard", "retry_test_failing")); got != 1 {
+		t.Errorf("expected 1 action failure counted, got %v", got)
+	}
+}
+
+func TestRetryingPlugin_MaxElapsedTime(t *testing.T) {
+	plugin := &flakyPlugin{name: "retry_test_elapsed", failures: 10}
+	var delays []time.Duration
+	// The first retry waits 10s; the second would wait 20s, past the 15s bound
+	r := newTestRetryingPlugin(plugin, retryPolicy{maxRetries: 5, initialInterval: 10 * time.Second, multiplier: 2, maxElapsedTime: 15 * time.Second}, &delays)
+
+	if err := r.HandleEvent(context.Background(), &pluginapi.ThresholdEvent{}); err == nil {
+		t.Fatal("expected action failure")
+	}
+	if len(plugin.events) != 2 || len(delays) != 1 {
+		t.Errorf("expected 2 executions and a single retry delay, got %d executions and delays %v", len(plugin.events), delays)
+	}
+}
+
+func TestRetryingPlugin_ContextCancelledStopsRetries(t *testing.T) {
+	plugin := &flakyPlugin{name: "retry_test_cancelled", failures: 10}
+	r := newRetryingPlugin(plugin, retryPolicy{maxRetries: 5, initialInterval: time.Minute, multiplier: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := r.HandleEvent(ctx, &pluginapi.ThresholdEvent{})
+	if err == nil || !strings.Contains(err.Error(), "retry aborted") {
+		t.Errorf("expected retries to be aborted, got %v", err)
+	}
+}
+
+func TestActionFailureRecordedInState(t *testing.T) {
+	plugin := &flakyPlugin{name: "retry_test_state", failures: 1}
+	state := threshold.NewSeries(nil)
+	state.Level("soft").StartTime = time.Now().Add(-10 * time.Second)
+	e := newTestEngine(t, "test", &threshold.Level{
+		Name:         "soft",
+		Value:        80.0,
+		Duration:     5 * time.Second,
+		BackoffDelay: time.Minute,
+		Plugin:       newRetryingPlugin(plugin, retryPolicy{multiplier: 1}),
+	}, nil)
+
+	e.Evaluate(context.Background(), state, 90.0)
+
+	if state.State != threshold.SoftThresholdActive {
+		t.Fatalf("expected SoftThresholdActive, got %s", state.State)
+	}
+	if state.Level("soft").ActionFailedAt.IsZero() || !strings.Contains(state.Level("soft").ActionError, "failure 1") {
+		t.Errorf("expected the action failure to be recorded, got %v %q", state.Level("soft").ActionFailedAt, state.Level("soft").ActionError)
+	}
+
+	// Recovery clears the failure with the rest of the incident data
+	e.Evaluate(context.Background(), state, 10.0)
+	if !state.Level("soft").ActionFailedAt.IsZero() || state.Level("soft").ActionError != "" {
+		t.Errorf("expected the action failure to be cleared on recovery, got %v %q", state.Level("soft").ActionFailedAt, state.Level("soft").ActionError)
+	}
+}
+
+func TestApplyRetryPolicies(t *testing.T) {
+	registry := pluginapi.NewRegistry()
+	registry.Register(&flakyPlugin{name: "webhook"})
+	registry.Register(&flakyPlugin{name: "log_action"})
+	registry.Register(&flakyPlugin{name: "exec_action"})
+
+	applyRetryPolicies(registry, &retryPolicies{
+		defaultPolicy: retryPolicy{maxRetries: 1},
+		plugins:       map[string]retryPolicy{"webhook": {maxRetries: 5}, "exec_action": {maxRetries: 0}},
+	})
+
+	// Plugins without retries are left unwrapped
+	if registered, _ := registry.Get("exec_action"); registered == nil {
+		t.Fatal("expected exec_action to stay registered")
+	} else if _, ok := registered.(*retryingPlugin); ok {
+		t.Errorf("expected exec_action without retries not to be wrapped")
+	}
+
+	for name, want := range map[string]int{"webhook": 5, "log_action": 1} {
+		registered, _ := registry.Get(name)
+		r, ok := registered.(*retryingPlugin)
+		if !ok {
+			t.Fatalf("expected %s to be wrapped with retries, got %T", name, registered)
+		}
+		if r.Name() != name || r.policy.maxRetries != want {
+			t.Errorf("expected %s with %d retries, got %s with %d", name, want, r.Name(), r.policy.maxRetries)
+		}
+	}
+}
+
+func TestRetryPoliciesEnabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		policies retryPolicies
+		want     bool
+	}{
+		{"disabled", retryPolicies{plugins: map[string]retryPolicy{"webhook": {}}}, false},
+		{"default", retryPolicies{defaultPolicy: retryPolicy{maxRetries: 1}}, true},
+		{"plugin override", retryPolicies{plugins: map[string]retryPolicy{"webhook": {maxRetries: 3}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policies.enabled(); got != tt.want {
+				t.Errorf("expected enabled %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestExecutePluginWithoutRetries tests that a failed execution of a plugin without
+// retries counts as a failed action
+func TestExecutePluginWithoutRetries(t *testing.T) {
+	plugin := &flakyPlugin{name: "no_retry_test_failing", failures: 1}
+
+	if err := executePlugin(context.Background(), plugin, &pluginapi.ThresholdEvent{Monitor: "cpu", Level: "soft"}); err == nil {
+		t.Fatal("expected the execution to fail")
+	}
+	if got := testutil.ToFloat64(actionFailuresTotal.WithLabelValues("cpu", "soft", "no_retry_test_failing")); got != 1 {
+		t.Errorf("expected 1 action failure counted, got %v", got)
+	}
+}
@@ -8,6 +8,10 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/prometheus/common/model"
+	pluginapi "metric-reader/pkg/plugin"
+	"metric-reader/pkg/threshold"
 )
 
 // Mock plugin for testing
@@ -15,7 +19,7 @@ type mockValidPlugin struct {
 	name string
 }
 
-func (m *mockValidPlugin) Execute(ctx context.Context, metricName string, value float64, threshold string, duration time.Duration) error {
+func (m *mockValidPlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
 	return nil
 }
 
@@ -32,7 +36,7 @@ type mockInvalidPlugin struct {
 	name string
 }
 
-func (m *mockInvalidPlugin) Execute(ctx context.Context, metricName string, value float64, threshold string, duration time.Duration) error {
+func (m *mockInvalidPlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
 	return nil
 }
 
@@ -45,27 +49,26 @@ func (m *mockInvalidPlugin) ValidateConfig() error {
 }
 
 func TestLoadRequiredPlugins_OnlyLoadsSpecifiedPlugins(t *testing.T) {
-	// Clear the plugin registry
-	PluginRegistry = make(map[string]ActionPlugin)
+	registry := pluginapi.NewRegistry()
 
 	// Register mock plugins
-	RegisterPlugin(&mockValidPlugin{name: "plugin1"})
-	RegisterPlugin(&mockValidPlugin{name: "plugin2"})
-	RegisterPlugin(&mockValidPlugin{name: "plugin3"})
+	registry.Register(&mockValidPlugin{name: "plugin1"})
+	registry.Register(&mockValidPlugin{name: "plugin2"})
+	registry.Register(&mockValidPlugin{name: "plugin3"})
 
 	// Check that all three plugins are registered
-	if len(PluginRegistry) != 3 {
-		t.Errorf("Expected 3 plugins registered, got %d", len(PluginRegistry))
+	if names := registry.Names(); len(names) != 3 {
+		t.Errorf("Expected 3 plugins registered, got %v", names)
 	}
 
 	// Verify specific plugins exist
-	if _, ok := PluginRegistry["plugin1"]; !ok {
+	if _, ok := registry.Get("plugin1"); !ok {
 		t.Error("Expected plugin1 to be registered")
 	}
-	if _, ok := PluginRegistry["plugin2"]; !ok {
+	if _, ok := registry.Get("plugin2"); !ok {
 		t.Error("Expected plugin2 to be registered")
 	}
-	if _, ok := PluginRegistry["plugin3"]; !ok {
+	if _, ok := registry.Get("plugin3"); !ok {
 		t.Error("Expected plugin3 to be registered")
 	}
 }
@@ -193,7 +196,7 @@ func TestLoadRequiredPlugins_NonExistentDirectory(t *testing.T) {
 		"test_plugin": true,
 	}
 
-	err := LoadRequiredPlugins("/nonexistent/directory", requiredPlugins)
+	err := LoadRequiredPlugins(pluginapi.NewRegistry(), "/nonexistent/directory", requiredPlugins)
 	if err == nil {
 		t.Error("Expected error when loading from non-existent directory, got nil")
 	}
@@ -207,7 +210,7 @@ func TestLoadRequiredPlugins_MissingRequiredPlugin(t *testing.T) {
 		"missing_plugin": true,
 	}
 
-	err := LoadRequiredPlugins(tmpDir, requiredPlugins)
+	err := LoadRequiredPlugins(pluginapi.NewRegistry(), tmpDir, requiredPlugins)
 	if err == nil {
 		t.Error("Expected error when required plugin is not found, got nil")
 	}
@@ -232,8 +235,181 @@ func TestLoadRequiredPlugins_EmptyRequiredPlugins(t *testing.T) {
 
 	requiredPlugins := map[string]bool{}
 
-	err := LoadRequiredPlugins(tmpDir, requiredPlugins)
+	err := LoadRequiredPlugins(pluginapi.NewRegistry(), tmpDir, requiredPlugins)
 	if err != nil {
 		t.Errorf("Expected no error with empty required plugins, got: %v", err)
 	}
 }
+
+// eventRecordingPlugin only implements the event interface and records the events it receives
+type eventRecordingPlugin struct {
+	events []*pluginapi.ThresholdEvent
+}
+
+func (p *eventRecordingPlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
+	p.events = append(p.events, event)
+	return nil
+}
+
+func (p *eventRecordingPlugin) Name() string {
+	return "event_recording_plugin"
+}
+
+func (p *eventRecordingPlugin) ValidateConfig() error {
+	return nil
+}
+
+func TestPluginReceivesThresholdEvents(t *testing.T) {
+	leaderActive.Store(true)
+	defer leaderActive.Store(false)
+
+	recorder := &eventRecordingPlugin{}
+
+	state := threshold.NewSeries(model.Metric{"queue": "a"})
+	state.Level("soft").StartTime = time.Now().Add(-10 * time.Second)
+
+	e, err := threshold.NewEngine(threshold.Config{
+		Monitor:    "queues",
+		MetricName: "queue_depth",
+		Query:      "queue_depth",
+		Operator:   threshold.GreaterThan,
+		Levels:     []*threshold.Level{{Name: "soft", Value: 80.0, Duration: 5 * time.Second, BackoffDelay: time.Minute, Plugin: recorder}},
+		IsLeader:   IsLeader,
+		Execute:    executePlugin,
+	})
+	if err != nil {
+		t.Fatalf("Expected a valid engine, got %v", err)
+	}
+
+	e.Evaluate(context.Background(), state, 90.0)
+
+	if len(recorder.events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(recorder.events))
+	}
+	event := recorder.events[0]
+	if event.Version != pluginapi.EventVersion {
+		t.Errorf("Expected event version %d, got %d", pluginapi.EventVersion, event.Version)
+	}
+	if event.Monitor != "queues" || event.Query != "queue_depth" || event.Labels["queue"] != "a" {
+		t.Errorf("Unexpected event source: monitor=%q query=%q labels=%v", event.Monitor, event.Query, event.Labels)
+	}
+	if event.Level != "soft" || event.Threshold != 80.0 || event.Operator != "greater_than" || event.Value != 90.0 {
+		t.Errorf("Unexpected threshold data: %+v", event)
+	}
+	if event.PreviousState != string(threshold.NotBreached) || event.NewState != string(threshold.SoftThresholdActive) {
+		t.Errorf("Expected NotBreached -> SoftThresholdActive, got %s -> %s", event.PreviousState, event.NewState)
+	}
+	if event.Reason != pluginapi.ReasonThresholdCrossed || event.Attempt != 1 {
+		t.Errorf("Expected first threshold_crossed attempt, got reason=%s attempt=%d", event.Reason, event.Attempt)
+	}
+	if event.Duration < 10*time.Second || event.StartedAt.IsZero() || event.Timestamp.IsZero() {
+		t.Errorf("Expected timestamps and a duration of at least 10s, got %+v", event)
+	}
+
+	// Re-execution after the backoff delay is reported as the next attempt
+	state.Level("soft").BackoffUntil = time.Now().Add(-time.Second)
+	e.Evaluate(context.Background(), state, 95.0)
+
+	if len(recorder.events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(recorder.events))
+	}
+	event = recorder.events[1]
+	if event.Reason != pluginapi.ReasonBackoffExpired || event.Attempt != 2 {
+		t.Errorf("Expected second backoff_expired attempt, got reason=%s attempt=%d", event.Reason, event.Attempt)
+	}
+	if event.PreviousState != string(threshold.SoftThresholdActive) || event.NewState != string(threshold.SoftThresholdActive) {
+		t.Errorf("Expected SoftThresholdActive -> SoftThresholdActive, got %s -> %s", event.PreviousState, event.NewState)
+	}
+	if event.PeakValue != 95.0 {
+		t.Errorf("Expected peak value 95, got %f", event.PeakValue)
+	}
+}
+
+// testPlugin only implements the legacy Execute signature
+type testPlugin struct {
+	name          string
+	lastValue     float64
+	lastThreshold string
+	lastDuration  time.Duration
+}
+
+func (p *testPlugin) Execute(ctx context.Context, metricName string, value float64, threshold string, duration time.Duration) error {
+	p.lastValue = value
+	p.lastThreshold = threshold
+	p.lastDuration = duration
+	return nil
+}
+
+func (p *testPlugin) Name() string {
+	return p.name
+}
+
+func (p *testPlugin) ValidateConfig() error {
+	return nil
+}
+
+// seriesRecoveryTestPlugin implements the optional legacy ExecuteForSeries and Recover methods
+type seriesRecoveryTestPlugin struct {
+	testPlugin
+	lastLabels map[string]string
+	recoveries int
+}
+
+func (p *seriesRecoveryTestPlugin) ExecuteForSeries(ctx context.Context, metricName string, labels map[string]string, value float64, threshold string, duration time.Duration) error {
+	p.lastLabels = labels
+	return p.Execute(ctx, metricName, value, threshold, duration)
+}
+
+func (p *seriesRecoveryTestPlugin) Recover(ctx context.Context, metricName string, labels map[string]string, peakValue float64, threshold string, breachedFor time.Duration) error {
+	p.recoveries++
+	p.lastLabels = labels
+	p.lastValue = peakValue
+	return nil
+}
+
+func TestLegacyPluginAdapter(t *testing.T) {
+	plugin := &testPlugin{name: "legacy_plugin"}
+	event := &pluginapi.ThresholdEvent{
+		MetricName: "queue_depth",
+		Labels:     map[string]string{"queue": "a"},
+		Operator:   "greater_than",
+		Threshold:  80,
+		Value:      90,
+		PeakValue:  120,
+		Reason:     pluginapi.ReasonThresholdCrossed,
+		Duration:   time.Minute,
+	}
+
+	if err := executePlugin(context.Background(), legacyPlugin{plugin}, event); err != nil {
+		t.Fatalf("Expected successful execution, got %v", err)
+	}
+	if plugin.lastValue != 90 || plugin.lastThreshold != "greater_than 80.00" || plugin.lastDuration != time.Minute {
+		t.Errorf("Unexpected Execute arguments: value=%f threshold=%q duration=%v", plugin.lastValue, plugin.lastThreshold, plugin.lastDuration)
+	}
+
+	// Recovery events pass the peak value to plugins without Recover
+	event.Reason = pluginapi.ReasonRecovered
+	if err := executePlugin(context.Background(), legacyPlugin{plugin}, event); err != nil {
+		t.Fatalf("Expected successful execution, got %v", err)
+	}
+	if plugin.lastValue != 120 {
+		t.Errorf("Expected peak value 120 for recovery event, got %f", plugin.lastValue)
+	}
+
+	// ExecuteForSeries and Recover are preferred when implemented
+	series := &seriesRecoveryTestPlugin{testPlugin: testPlugin{name: "legacy_series_plugin"}}
+	event.Reason = pluginapi.ReasonThresholdCrossed
+	if err := executePlugin(context.Background(), legacyPlugin{series}, event); err != nil {
+		t.Fatalf("Expected successful execution, got %v", err)
+	}
+	if series.lastLabels["queue"] != "a" || series.lastValue != 90 || series.recoveries != 0 {
+		t.Errorf("Expected ExecuteForSeries with the series labels, got labels=%v value=%f", series.lastLabels, series.lastValue)
+	}
+	event.Reason = pluginapi.ReasonRecovered
+	if err := executePlugin(context.Background(), legacyPlugin{series}, event); err != nil {
+		t.Fatalf("Expected successful execution, got %v", err)
+	}
+	if series.recoveries != 1 || series.lastValue != 120 {
+		t.Errorf("Expected Recover with the peak value, got %d recoveries and value %f", series.recoveries, series.lastValue)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	pluginapi "metric-reader/pkg/plugin"
+)
+
+// applyPluginTimeouts wraps every plugin of the registry so each execution is bounded by the
+// plugin's execution_timeout, or by the default timeout. A timeout of 0 leaves the plugin unbounded.
+func applyPluginTimeouts(registry *pluginapi.Registry, defaultTimeout time.Duration, timeouts map[string]time.Duration) {
+	for _, name := range registry.Names() {
+		timeout, ok := timeouts[name]
+		if !ok {
+			timeout = defaultTimeout
+		}
+		if timeout > 0 {
+			p, _ := registry.Get(name)
+			registry.Set(name, &timeoutPlugin{plugin: p, timeout: timeout})
+		}
+	}
+}
+
+// timeoutPlugin bounds the executions of a plugin. The plugin's context is cancelled when the
+// timeout expires and the execution returns even if the plugin ignores its context, so a hung
+// call can't block the state machine. The abandoned call keeps running in the background.
+type timeoutPlugin struct {
+	plugin  pluginapi.ActionPlugin
+	timeout time.Duration
+}
+
+// HandleEvent executes the plugin within the timeout
+func (t *timeoutPlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- t.plugin.HandleEvent(ctx, event)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		if ctx.Err() != context.DeadlineExceeded {
+			return ctx.Err()
+		}
+		log.Warn().
+			Str("plugin", t.Name()).
+			Dur("timeout", t.timeout).
+			Msg("plugin execution timed out, abandoning it")
+		return fmt.Errorf("plugin %s timed out after %v", t.Name(), t.timeout)
+	}
+}
+
+// Name returns the name of the wrapped plugin
+func (t *timeoutPlugin) Name() string {
+	return t.plugin.Name()
+}
+
+// ValidateConfig validates the configuration of the wrapped plugin
+func (t *timeoutPlugin) ValidateConfig() error {
+	return t.plugin.ValidateConfig()
+}
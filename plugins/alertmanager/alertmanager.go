@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	pluginapi "metric-reader/pkg/plugin"
+)
+
+const (
+	defaultAlertName      = "MetricReaderThreshold"
+	defaultTimeout        = 10 * time.Second
+	defaultResendInterval = time.Minute
+	alertsPath            = "/api/v2/alerts"
+	// alertLifetimeIntervals is how many resend intervals a firing alert stays valid without being
+	// re-sent, so a few failed or missed resends don't resolve it
+	alertLifetimeIntervals = 4
+)
+
+// AlertmanagerPlugin posts alerts to the Alertmanager API. Used as plugin the alert fires and is
+// re-sent every resend interval while it is active; used as recovery_plugin the same alert is
+// resolved by setting endsAt to the recovery time.
+type AlertmanagerPlugin struct {
+	url            string
+	alertName      string
+	labels         map[string]string
+	annotations    map[string]string
+	generatorURL   string
+	timeout        time.Duration
+	resendInterval time.Duration
+
+	client *http.Client
+	active *activeAlerts
+	// configErr holds errors found while reading the configuration, reported by ValidateConfig
+	configErr error
+}
+
+// activeAlerts holds the firing alerts re-sent to Alertmanager, keyed by their labels
+type activeAlerts struct {
+	mu     sync.Mutex
+	alerts map[string]alert
+	// resend starts the resend loop with the first firing alert
+	resend sync.Once
+}
+
+// alert is an alert as accepted by POST /api/v2/alerts
+type alert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       *time.Time        `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+// HandleEvent implements the ActionPlugin interface
+func (p *AlertmanagerPlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
+	a := p.buildAlert(event)
+
+	// The alert is tracked even if posting it fails: the resend loop delivers it later,
+	// and a resolved alert is no longer re-sent so it expires at its last endsAt at the latest
+	p.active.mu.Lock()
+	if event.Reason == pluginapi.ReasonRecovered {
+		delete(p.active.alerts, alertKey(a.Labels))
+	} else {
+		p.active.alerts[alertKey(a.Labels)] = a
+	}
+	p.active.mu.Unlock()
+	if event.Reason != pluginapi.ReasonRecovered {
+		p.active.resend.Do(func() { go p.resendLoop() })
+	}
+
+	if err := p.post(ctx, []alert{a}); err != nil {
+		return err
+	}
+
+	status := "firing"
+	if event.Reason == pluginapi.ReasonRecovered {
+		status = "resolved"
+	}
+	log.Info().
+		Str("alertname", a.Labels["alertname"]).
+		Str("metric_name", event.MetricName).
+		Str("threshold_level", event.Level).
+		Str("status", status).
+		Msg("alert sent to Alertmanager")
+
+	return nil
+}
+
+// resendLoop re-sends the active alerts every resend interval. Alertmanager resolves an alert
+// once its endsAt has passed, so firing alerts have to be refreshed until they recover.
+func (p *AlertmanagerPlugin) resendLoop() {
+	ticker := time.NewTicker(p.resendInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if err := p.resend(context.Background(), now); err != nil {
+			log.Error().Err(err).Msg("failed to re-send active alerts to Alertmanager")
+		}
+	}
+}
+
+// resend posts the active alerts with endsAt moved forward from now
+func (p *AlertmanagerPlugin) resend(ctx context.Context, now time.Time) error {
+	p.active.mu.Lock()
+	alerts := make([]alert, 0, len(p.active.alerts))
+	for _, a := range p.active.alerts {
+		endsAt := now.Add(p.alertLifetime())
+		a.EndsAt = &endsAt
+		alerts = append(alerts, a)
+	}
+	p.active.mu.Unlock()
+
+	if len(alerts) == 0 {
+		return nil
+	}
+	if err := p.post(ctx, alerts); err != nil {
+		return err
+	}
+	log.Debug().Int("alerts", len(alerts)).Msg("active alerts re-sent to Alertmanager")
+	return nil
+}
+
+// post sends alerts to the Alertmanager API
+func (p *AlertmanagerPlugin) post(ctx context.Context, alerts []alert) error {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.alertsURL(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post alert to Alertmanager: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("alertmanager returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+// alertLifetime is how long a firing alert stays active in Alertmanager without being re-sent
+func (p *AlertmanagerPlugin) alertLifetime() time.Duration {
+	return alertLifetimeIntervals * p.resendInterval
+}
+
+// buildAlert converts a threshold event into an alert. Labels identify the alert in Alertmanager,
+// so they only contain stable values: the monitor, level and series labels, never the value.
+func (p *AlertmanagerPlugin) buildAlert(event *pluginapi.ThresholdEvent) alert {
+	labels := make(map[string]string)
+	for name, value := range event.Labels {
+		// Internal labels such as __name__ are replaced by metric_name
+		if strings.HasPrefix(name, "__") {
+			continue
+		}
+		labels[name] = value
+	}
+	for name, value := range p.labels {
+		labels[name] = value
+	}
+	labels["alertname"] = p.alertName
+	setIfNotEmpty(labels, "metric_name", event.MetricName)
+	setIfNotEmpty(labels, "monitor", event.Monitor)
+	setIfNotEmpty(labels, "level", event.Level)
+
+	annotations := map[string]string{
+		"summary":   fmt.Sprintf("%s is %s (%s)", event.MetricName, formatValue(event.Value), event.ThresholdString()),
+		"value":     formatValue(event.Value),
+		"threshold": event.ThresholdString(),
+		"duration":  event.Duration.String(),
+	}
+	setIfNotEmpty(annotations, "reason", string(event.Reason))
+	setIfNotEmpty(annotations, "state", event.NewState)
+	setIfNotEmpty(annotations, "query", event.Query)
+	if event.Reason == pluginapi.ReasonRecovered {
+		annotations["summary"] = fmt.Sprintf("%s recovered after %s, peak value %s (%s)", event.MetricName, event.Duration, formatValue(event.PeakValue), event.ThresholdString())
+		annotations["peak_value"] = formatValue(event.PeakValue)
+	}
+	for name, value := range p.annotations {
+		annotations[name] = value
+	}
+
+	now := event.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	a := alert{
+		Labels:       labels,
+		Annotations:  annotations,
+		StartsAt:     event.StartedAt,
+		GeneratorURL: p.generatorURL,
+	}
+	if a.StartsAt.IsZero() {
+		a.StartsAt = now
+	}
+	endsAt := now.Add(p.alertLifetime())
+	if event.Reason == pluginapi.ReasonRecovered {
+		endsAt = now
+	}
+	a.EndsAt = &endsAt
+	return a
+}
+
+// alertKey identifies an alert by its labels, as Alertmanager does
+func alertKey(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "\xff")
+}
+
+// alertsURL returns the alerts endpoint, accepting either the Alertmanager base URL or the full endpoint
+func (p *AlertmanagerPlugin) alertsURL() string {
+	url := strings.TrimSuffix(p.url, "/")
+	if strings.HasSuffix(url, alertsPath) {
+		return url
+	}
+	return url + alertsPath
+}
+
+// Name implements the ActionPlugin interface
+func (p *AlertmanagerPlugin) Name() string {
+	return "alertmanager"
+}
+
+// ValidateConfig implements the ActionPlugin interface
+func (p *AlertmanagerPlugin) ValidateConfig() error {
+	if p.configErr != nil {
+		return p.configErr
+	}
+	if p.url == "" {
+		return fmt.Errorf("ALERTMANAGER_URL is required")
+	}
+	if !strings.HasPrefix(p.url, "http://") && !strings.HasPrefix(p.url, "https://") {
+		return fmt.Errorf("ALERTMANAGER_URL must be an http or https URL, got %q", p.url)
+	}
+	if p.timeout <= 0 {
+		return fmt.Errorf("ALERTMANAGER_TIMEOUT must be greater than 0, got %v", p.timeout)
+	}
+	if p.resendInterval <= 0 {
+		return fmt.Errorf("ALERTMANAGER_RESEND_INTERVAL must be greater than 0, got %v", p.resendInterval)
+	}
+	return nil
+}
+
+// setIfNotEmpty sets m[key] unless value is empty
+func setIfNotEmpty(m map[string]string, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
+
+// formatValue formats a metric value without trailing zeros
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// newAlertmanagerPlugin reads the plugin configuration from environment variables
+func newAlertmanagerPlugin(getenv func(string) string) AlertmanagerPlugin {
+	p := AlertmanagerPlugin{
+		url:            getenv("ALERTMANAGER_URL"),
+		alertName:      defaultAlertName,
+		labels:         map[string]string{},
+		annotations:    map[string]string{},
+		generatorURL:   getenv("ALERTMANAGER_GENERATOR_URL"),
+		timeout:        defaultTimeout,
+		resendInterval: defaultResendInterval,
+		active:         &activeAlerts{alerts: map[string]alert{}},
+	}
+
+	// Don't fail here - let ValidateConfig() report configuration errors
+	var errs []string
+	if name := getenv("ALERTMANAGER_ALERT_NAME"); name != "" {
+		p.alertName = name
+	}
+	if labels := getenv("ALERTMANAGER_LABELS"); labels != "" {
+		if err := json.Unmarshal([]byte(labels), &p.labels); err != nil {
+			errs = append(errs, fmt.Sprintf("ALERTMANAGER_LABELS must be a JSON object of label names to values: %v", err))
+		}
+	}
+	if annotations := getenv("ALERTMANAGER_ANNOTATIONS"); annotations != "" {
+		if err := json.Unmarshal([]byte(annotations), &p.annotations); err != nil {
+			errs = append(errs, fmt.Sprintf("ALERTMANAGER_ANNOTATIONS must be a JSON object of annotation names to values: %v", err))
+		}
+	}
+	if timeout := getenv("ALERTMANAGER_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("invalid ALERTMANAGER_TIMEOUT: %v", err))
+		}
+		p.timeout = d
+	}
+	if interval := getenv("ALERTMANAGER_RESEND_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("invalid ALERTMANAGER_RESEND_INTERVAL: %v", err))
+		}
+		p.resendInterval = d
+	}
+	if len(errs) > 0 {
+		p.configErr = fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	p.client = &http.Client{}
+	return p
+}
+
+// Plugin is the exported plugin symbol
+var Plugin AlertmanagerPlugin
+
+func init() {
+	Plugin = newAlertmanagerPlugin(os.Getenv)
+}
+
+// main runs the plugin as an exec plugin when built as a regular binary.
+// It is not called when the plugin is loaded as a shared library.
+func main() {
+	pluginapi.Serve(&Plugin)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pluginapi "metric-reader/pkg/plugin"
+)
+
+// env returns a getenv function backed by a map
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+// alertmanagerServer records the alerts posted to /api/v2/alerts
+func alertmanagerServer(t *testing.T, status int) (*httptest.Server, *[]alert) {
+	t.Helper()
+	var received []alert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v2/alerts" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var alerts []alert
+		if err := json.NewDecoder(r.Body).Decode(&alerts); err != nil {
+			t.Errorf("failed to decode alerts: %v", err)
+		}
+		received = append(received, alerts...)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &received
+}
+
+// TestPluginInterface verifies that the plugin implements the required interface
+func TestPluginInterface(t *testing.T) {
+	if Plugin.Name() != "alertmanager" {
+		t.Errorf("expected plugin name 'alertmanager', got '%s'", Plugin.Name())
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		vars    map[string]string
+		wantErr string
+	}{
+		{"missing url", map[string]string{}, "ALERTMANAGER_URL is required"},
+		{"invalid url", map[string]string{"ALERTMANAGER_URL": "alertmanager:9093"}, "http or https"},
+		{"invalid labels", map[string]string{"ALERTMANAGER_URL": "http://alertmanager:9093", "ALERTMANAGER_LABELS": "team=infra"}, "ALERTMANAGER_LABELS"},
+		{"invalid timeout", map[string]string{"ALERTMANAGER_URL": "http://alertmanager:9093", "ALERTMANAGER_TIMEOUT": "1"}, "ALERTMANAGER_TIMEOUT"},
+		{"invalid resend interval", map[string]string{"ALERTMANAGER_URL": "http://alertmanager:9093", "ALERTMANAGER_RESEND_INTERVAL": "0s"}, "ALERTMANAGER_RESEND_INTERVAL"},
+		{"valid", map[string]string{"ALERTMANAGER_URL": "http://alertmanager:9093"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newAlertmanagerPlugin(env(tt.vars))
+			err := p.ValidateConfig()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("expected valid config, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFiringAndResolvedAlerts(t *testing.T) {
+	server, received := alertmanagerServer(t, http.StatusOK)
+
+	p := newAlertmanagerPlugin(env(map[string]string{
+		"ALERTMANAGER_URL":         server.URL,
+		"ALERTMANAGER_LABELS":      `{"team": "infra"}`,
+		"ALERTMANAGER_ANNOTATIONS": `{"runbook_url": "https://runbooks.example.com/cpu"}`,
+	}))
+
+	startedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	fired := &pluginapi.ThresholdEvent{
+		Monitor:    "cpu",
+		MetricName: "node_cpu_usage",
+		Labels:     map[string]string{"__name__": "node_cpu_usage", "instance": "node-1"},
+		Level:      "soft",
+		Operator:   "greater_than",
+		Threshold:  80,
+		Value:      91.5,
+		NewState:   "SoftThresholdActive",
+		Reason:     pluginapi.ReasonThresholdCrossed,
+		Timestamp:  startedAt.Add(time.Minute),
+		StartedAt:  startedAt,
+		Duration:   time.Minute,
+	}
+	if err := p.HandleEvent(context.Background(), fired); err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+
+	recovered := *fired
+	recovered.Reason = pluginapi.ReasonRecovered
+	recovered.NewState = "NotBreached"
+	recovered.Value = 50
+	recovered.PeakValue = 95
+	recovered.Timestamp = startedAt.Add(10 * time.Minute)
+	if err := p.HandleEvent(context.Background(), &recovered); err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+
+	if len(*received) != 2 {
+		t.Fatalf("expected 2 alerts, got %d", len(*received))
+	}
+	firing, resolved := (*received)[0], (*received)[1]
+
+	wantLabels := map[string]string{
+		"alertname":   "MetricReaderThreshold",
+		"metric_name": "node_cpu_usage",
+		"monitor":     "cpu",
+		"level":       "soft",
+		"instance":    "node-1",
+		"team":        "infra",
+	}
+	if len(firing.Labels) != len(wantLabels) {
+		t.Errorf("expected labels %v, got %v", wantLabels, firing.Labels)
+	}
+	for name, value := range wantLabels {
+		if firing.Labels[name] != value {
+			t.Errorf("expected label %s=%q, got %q", name, value, firing.Labels[name])
+		}
+	}
+	if firing.Annotations["summary"] != "node_cpu_usage is 91.5 (greater_than 80.00)" {
+		t.Errorf("unexpected summary %q", firing.Annotations["summary"])
+	}
+	if firing.Annotations["runbook_url"] != "https://runbooks.example.com/cpu" {
+		t.Errorf("expected configured annotation, got %v", firing.Annotations)
+	}
+	if !firing.StartsAt.Equal(startedAt) {
+		t.Errorf("expected startsAt %v, got %v", startedAt, firing.StartsAt)
+	}
+	// A firing alert expires after a few resend intervals unless it is re-sent
+	if wantEndsAt := fired.Timestamp.Add(4 * time.Minute); firing.EndsAt == nil || !firing.EndsAt.Equal(wantEndsAt) {
+		t.Errorf("expected firing alert endsAt %v, got %v", wantEndsAt, firing.EndsAt)
+	}
+
+	// The resolved alert has the same labels so Alertmanager matches it to the firing one
+	for name, value := range firing.Labels {
+		if resolved.Labels[name] != value {
+			t.Errorf("expected resolved alert label %s=%q, got %q", name, value, resolved.Labels[name])
+		}
+	}
+	if resolved.EndsAt == nil || !resolved.EndsAt.Equal(recovered.Timestamp) {
+		t.Errorf("expected endsAt %v, got %v", recovered.Timestamp, resolved.EndsAt)
+	}
+	if resolved.Annotations["peak_value"] != "95" {
+		t.Errorf("expected peak_value annotation 95, got %q", resolved.Annotations["peak_value"])
+	}
+}
+
+func TestAlertmanagerError(t *testing.T) {
+	server, _ := alertmanagerServer(t, http.StatusBadRequest)
+
+	// The full endpoint URL is accepted as well as the base URL
+	p := newAlertmanagerPlugin(env(map[string]string{"ALERTMANAGER_URL": server.URL + "/api/v2/alerts/"}))
+	err := p.HandleEvent(context.Background(), &pluginapi.ThresholdEvent{MetricName: "node_cpu_usage", Value: 91.5, Reason: pluginapi.ReasonThresholdCrossed, Timestamp: time.Now()})
+	if err == nil || !strings.Contains(err.Error(), "status 400") {
+		t.Errorf("expected status error, got %v", err)
+	}
+}
+
+func TestResendActiveAlerts(t *testing.T) {
+	server, received := alertmanagerServer(t, http.StatusOK)
+
+	// A long interval keeps the resend loop from interfering; resend is called directly
+	p := newAlertmanagerPlugin(env(map[string]string{
+		"ALERTMANAGER_URL":             server.URL,
+		"ALERTMANAGER_RESEND_INTERVAL": "1h",
+	}))
+
+	startedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	fired := &pluginapi.ThresholdEvent{
+		Monitor:    "cpu",
+		MetricName: "node_cpu_usage",
+		Labels:     map[string]string{"instance": "node-1"},
+		Level:      "soft",
+		Value:      91.5,
+		Reason:     pluginapi.ReasonThresholdCrossed,
+		Timestamp:  startedAt,
+		StartedAt:  startedAt,
+	}
+	if err := p.HandleEvent(context.Background(), fired); err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+
+	now := startedAt.Add(time.Hour)
+	if err := p.resend(context.Background(), now); err != nil {
+		t.Fatalf("resend failed: %v", err)
+	}
+	if len(*received) != 2 {
+		t.Fatalf("expected the alert to be re-sent, got %d alerts", len(*received))
+	}
+	resent := (*received)[1]
+	if !resent.StartsAt.Equal(startedAt) {
+		t.Errorf("expected re-sent alert to keep startsAt %v, got %v", startedAt, resent.StartsAt)
+	}
+	if wantEndsAt := now.Add(4 * time.Hour); resent.EndsAt == nil || !resent.EndsAt.Equal(wantEndsAt) {
+		t.Errorf("expected re-sent alert endsAt %v, got %v", wantEndsAt, resent.EndsAt)
+	}
+
+	// A resolved alert is no longer re-sent
+	recovered := *fired
+	recovered.Reason = pluginapi.ReasonRecovered
+	recovered.Timestamp = now
+	if err := p.HandleEvent(context.Background(), &recovered); err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+	if err := p.resend(context.Background(), now.Add(time.Hour)); err != nil {
+		t.Fatalf("resend failed: %v", err)
+	}
+	if len(*received) != 3 {
+		t.Errorf("expected no alerts re-sent after recovery, got %d alerts", len(*received))
+	}
+}
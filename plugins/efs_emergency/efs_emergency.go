@@ -14,6 +14,7 @@ import (
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/common/model"
 	"github.com/rs/zerolog/log"
+	pluginapi "metric-reader/pkg/plugin"
 )
 
 // EFSEmergencyPlugin switches EFS filesystem throughput mode to elastic
@@ -26,13 +27,54 @@ type EFSEmergencyPlugin struct {
 	prometheusEnabled bool
 }
 
-// Execute implements the ActionPlugin interface
-func (p *EFSEmergencyPlugin) Execute(ctx context.Context, metricName string, value float64, threshold string, duration time.Duration) error {
+// HandleEvent implements the ActionPlugin interface. It switches the filesystem to elastic
+// throughput, or back to bursting throughput for recovery events once burst credits have
+// recovered. When the series that crossed the threshold carries the configured label, its
+// value is used as the filesystem ID without querying Prometheus.
+func (p *EFSEmergencyPlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
+	fileSystemId, err := p.resolveFileSystemID(ctx, event.MetricName, event.Labels)
+	if err != nil {
+		return err
+	}
+
+	if event.Reason == pluginapi.ReasonRecovered {
+		log.Info().
+			Str("metric_name", event.MetricName).
+			Float64("peak_value", event.PeakValue).
+			Str("threshold", event.ThresholdString()).
+			Dur("breached_for", event.Duration).
+			Str("file_system_id", fileSystemId).
+			Msg("recovering from EFS emergency mode: switching back to bursting throughput")
+
+		return p.updateThroughputMode(ctx, fileSystemId, types.ThroughputModeBursting)
+	}
+
+	log.Info().
+		Str("metric_name", event.MetricName).
+		Float64("value", event.Value).
+		Str("threshold", event.ThresholdString()).
+		Dur("duration", event.Duration).
+		Str("file_system_id", fileSystemId).
+		Msg("executing EFS emergency mode: switching to elastic throughput")
+
+	return p.updateThroughputMode(ctx, fileSystemId, types.ThroughputModeElastic)
+}
+
+// resolveFileSystemID determines the filesystem to act on from the series labels,
+// the metric label in Prometheus or EFS_FILE_SYSTEM_ID, in that order
+func (p *EFSEmergencyPlugin) resolveFileSystemID(ctx context.Context, metricName string, labels map[string]string) (string, error) {
 	// Determine the filesystem ID to use
 	fileSystemId := p.fileSystemId
 
-	// If Prometheus is enabled and metric label name is configured, query for the label value
-	if p.prometheusEnabled && p.metricLabelName != "" {
+	if labelValue := labels[p.metricLabelName]; p.metricLabelName != "" && labelValue != "" {
+		fileSystemId = labelValue
+		log.Info().
+			Str("metric_name", metricName).
+			Str("label_name", p.metricLabelName).
+			Str("label_value", labelValue).
+			Msg("using filesystem ID from series label")
+	} else if p.prometheusEnabled && p.metricLabelName != "" {
+		// If Prometheus is enabled and metric label name is configured, query for the label value
 		labelValue, err := p.queryMetricLabel(ctx, metricName)
 		if err != nil {
 			log.Warn().
@@ -57,24 +99,20 @@ func (p *EFSEmergencyPlugin) Execute(ctx context.Context, metricName string, val
 
 	// Validate we have a filesystem ID
 	if fileSystemId == "" {
-		return fmt.Errorf("no filesystem ID available - set EFS_FILE_SYSTEM_ID or configure EFS_FILE_SYSTEM_PROMETHEUS_LABEL with valid metric label")
+		return "", fmt.Errorf("no filesystem ID available - set EFS_FILE_SYSTEM_ID or configure EFS_FILE_SYSTEM_PROMETHEUS_LABEL with valid metric label")
 	}
 	if p.client == nil {
-		return fmt.Errorf("AWS client not initialized - check AWS credentials and configuration")
+		return "", fmt.Errorf("AWS client not initialized - check AWS credentials and configuration")
 	}
 
-	log.Info().
-		Str("metric_name", metricName).
-		Float64("value", value).
-		Str("threshold", threshold).
-		Dur("duration", duration).
-		Str("file_system_id", fileSystemId).
-		Msg("executing EFS emergency mode: switching to elastic throughput")
+	return fileSystemId, nil
+}
 
-	// Update the file system to use elastic throughput
+// updateThroughputMode switches the filesystem to the given throughput mode
+func (p *EFSEmergencyPlugin) updateThroughputMode(ctx context.Context, fileSystemId string, mode types.ThroughputMode) error {
 	input := &efs.UpdateFileSystemInput{
 		FileSystemId:   aws.String(fileSystemId),
-		ThroughputMode: types.ThroughputModeElastic,
+		ThroughputMode: mode,
 	}
 
 	output, err := p.client.UpdateFileSystem(ctx, input)
@@ -86,7 +124,7 @@ func (p *EFSEmergencyPlugin) Execute(ctx context.Context, metricName string, val
 		Str("file_system_id", fileSystemId).
 		Str("new_throughput_mode", string(output.ThroughputMode)).
 		Str("life_cycle_state", string(output.LifeCycleState)).
-		Msg("successfully switched EFS filesystem to elastic throughput mode")
+		Msgf("successfully switched EFS filesystem to %s throughput mode", mode)
 
 	return nil
 }
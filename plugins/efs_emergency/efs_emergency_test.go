@@ -3,8 +3,11 @@ package main
 import (
 	"context"
 	"os"
+	"strings"
 	"testing"
 	"time"
+
+	pluginapi "metric-reader/pkg/plugin"
 )
 
 // TestPluginInterface verifies that the plugin implements the required interface
@@ -37,9 +40,9 @@ func TestEnvironmentVariableValidation(t *testing.T) {
 	}
 }
 
-// TestExecuteSignature verifies the Execute method signature matches the interface
-func TestExecuteSignature(t *testing.T) {
-	// This is a compile-time check that Execute method exists with correct signature
+// TestHandleEventSignature verifies the HandleEvent method signature matches the interface
+func TestHandleEventSignature(t *testing.T) {
+	// This is a compile-time check that HandleEvent method exists with correct signature
 	// We can't actually execute it without AWS credentials and a real filesystem
 	plugin := EFSEmergencyPlugin{
 		fileSystemId:      "fs-test123",
@@ -52,5 +55,45 @@ func TestExecuteSignature(t *testing.T) {
 
 	// We're just checking that this compiles
 	ctx := context.Background()
-	_ = plugin.Execute(ctx, "test_metric", 100.0, "<50", 5*time.Minute)
+	_ = plugin.HandleEvent(ctx, &pluginapi.ThresholdEvent{MetricName: "test_metric", Value: 100.0, Duration: 5 * time.Minute})
+}
+
+// TestHandleEventUsesLabel verifies the filesystem ID is taken from the series labels
+func TestHandleEventUsesLabel(t *testing.T) {
+	plugin := EFSEmergencyPlugin{
+		metricLabelName: "file_system_id",
+	}
+
+	ctx := context.Background()
+
+	// Without the label there is no filesystem ID to act on
+	err := plugin.HandleEvent(ctx, &pluginapi.ThresholdEvent{MetricName: "test_metric", Labels: map[string]string{}, Value: 100.0})
+	if err == nil || !strings.Contains(err.Error(), "no filesystem ID available") {
+		t.Errorf("expected missing filesystem ID error, got %v", err)
+	}
+
+	// With the label the filesystem ID is resolved and execution proceeds to the AWS client
+	err = plugin.HandleEvent(ctx, &pluginapi.ThresholdEvent{MetricName: "test_metric", Labels: map[string]string{"file_system_id": "fs-label123"}, Value: 100.0})
+	if err == nil || !strings.Contains(err.Error(), "AWS client not initialized") {
+		t.Errorf("expected AWS client error after resolving filesystem ID from label, got %v", err)
+	}
+}
+
+// TestRecoveryResolvesFileSystem verifies recovery events resolve the filesystem like other events
+func TestRecoveryResolvesFileSystem(t *testing.T) {
+	plugin := EFSEmergencyPlugin{
+		metricLabelName: "file_system_id",
+	}
+
+	ctx := context.Background()
+
+	err := plugin.HandleEvent(ctx, &pluginapi.ThresholdEvent{MetricName: "test_metric", Labels: map[string]string{}, PeakValue: 5.0, Reason: pluginapi.ReasonRecovered})
+	if err == nil || !strings.Contains(err.Error(), "no filesystem ID available") {
+		t.Errorf("expected missing filesystem ID error, got %v", err)
+	}
+
+	err = plugin.HandleEvent(ctx, &pluginapi.ThresholdEvent{MetricName: "test_metric", Labels: map[string]string{"file_system_id": "fs-label123"}, PeakValue: 5.0, Reason: pluginapi.ReasonRecovered})
+	if err == nil || !strings.Contains(err.Error(), "AWS client not initialized") {
+		t.Errorf("expected AWS client error after resolving filesystem ID from label, got %v", err)
+	}
 }
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	pluginapi "metric-reader/pkg/plugin"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	// waitDelay bounds how long output is read after the command exits or is killed,
+	// e.g. when a background child process keeps stdout open
+	waitDelay = 5 * time.Second
+)
+
+// defaultAllowedEnv are the metric-reader environment variables passed to the command when
+// EXEC_ACTION_ALLOWED_ENV is not set
+var defaultAllowedEnv = []string{"PATH"}
+
+// invalidEnvChars matches the characters not allowed in METRIC_READER_LABEL_<NAME> variable names
+var invalidEnvChars = regexp.MustCompile(`[^A-Z0-9_]`)
+
+// ExecActionPlugin runs a command when a threshold fires
+type ExecActionPlugin struct {
+	command    string
+	args       []string
+	workingDir string
+	timeout    time.Duration
+	allowedEnv []string
+
+	// configErr holds errors found while reading the configuration, reported by ValidateConfig
+	configErr error
+}
+
+// HandleEvent implements the ActionPlugin interface. The event is passed to the command as
+// METRIC_READER_* environment variables and as JSON on stdin.
+func (p *ExecActionPlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
+	stdin, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, p.command, p.args...)
+	cmd.Dir = p.workingDir
+	cmd.Env = append(p.passedEnv(), eventEnv(event)...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.WaitDelay = waitDelay
+	// Run the command in its own process group so a timeout also kills the processes it started
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+
+	stdout := &lineLogger{command: p.command, stream: "stdout"}
+	stderr := &lineLogger{command: p.command, stream: "stderr"}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	start := time.Now()
+	err = cmd.Run()
+	stdout.Flush()
+	stderr.Flush()
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("command %s timed out after %v", p.command, p.timeout)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if last := stderr.LastLine(); last != "" {
+			return fmt.Errorf("command %s exited with code %d: %s", p.command, exitErr.ExitCode(), last)
+		}
+		return fmt.Errorf("command %s exited with code %d", p.command, exitErr.ExitCode())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run command %s: %v", p.command, err)
+	}
+
+	log.Info().
+		Str("command", p.command).
+		Str("metric_name", event.MetricName).
+		Dur("elapsed", time.Since(start)).
+		Msg("command executed")
+	return nil
+}
+
+// passedEnv returns the allowed variables of the metric-reader environment
+func (p *ExecActionPlugin) passedEnv() []string {
+	env := []string{}
+	for _, name := range p.allowedEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// eventEnv returns the event as METRIC_READER_* environment variables
+func eventEnv(event *pluginapi.ThresholdEvent) []string {
+	labels, _ := json.Marshal(event.Labels)
+	env := []string{
+		"METRIC_READER_MONITOR=" + event.Monitor,
+		"METRIC_READER_QUERY=" + event.Query,
+		"METRIC_READER_METRIC_NAME=" + event.MetricName,
+		"METRIC_READER_LABELS=" + string(labels),
+		"METRIC_READER_LEVEL=" + event.Level,
+		"METRIC_READER_THRESHOLD=" + formatFloat(event.Threshold),
+		"METRIC_READER_OPERATOR=" + event.Operator,
+		"METRIC_READER_VALUE=" + formatFloat(event.Value),
+		"METRIC_READER_PEAK_VALUE=" + formatFloat(event.PeakValue),
+		"METRIC_READER_PREVIOUS_STATE=" + event.PreviousState,
+		"METRIC_READER_NEW_STATE=" + event.NewState,
+		"METRIC_READER_REASON=" + string(event.Reason),
+		"METRIC_READER_ATTEMPT=" + strconv.Itoa(event.Attempt),
+		"METRIC_READER_DURATION=" + event.Duration.String(),
+		"METRIC_READER_DURATION_SECONDS=" + formatFloat(event.Duration.Seconds()),
+	}
+	if !event.Timestamp.IsZero() {
+		env = append(env, "METRIC_READER_TIMESTAMP="+event.Timestamp.Format(time.RFC3339))
+	}
+	if !event.StartedAt.IsZero() {
+		env = append(env, "METRIC_READER_STARTED_AT="+event.StartedAt.Format(time.RFC3339))
+	}
+	if event.Lower != nil && event.Upper != nil {
+		env = append(env, "METRIC_READER_LOWER="+formatFloat(*event.Lower), "METRIC_READER_UPPER="+formatFloat(*event.Upper))
+	}
+	if event.BaselineMean != nil && event.BaselineStdDev != nil {
+		env = append(env, "METRIC_READER_BASELINE_MEAN="+formatFloat(*event.BaselineMean), "METRIC_READER_BASELINE_STDDEV="+formatFloat(*event.BaselineStdDev))
+	}
+
+	// Each series label is also available on its own, e.g. METRIC_READER_LABEL_INSTANCE
+	names := make([]string, 0, len(event.Labels))
+	for name := range event.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		envName := "METRIC_READER_LABEL_" + invalidEnvChars.ReplaceAllString(strings.ToUpper(name), "_")
+		env = append(env, envName+"="+event.Labels[name])
+	}
+	return env
+}
+
+// Name implements the ActionPlugin interface
+func (p *ExecActionPlugin) Name() string {
+	return "exec_action"
+}
+
+// ValidateConfig implements the ActionPlugin interface
+func (p *ExecActionPlugin) ValidateConfig() error {
+	if p.configErr != nil {
+		return p.configErr
+	}
+	if p.command == "" {
+		return fmt.Errorf("EXEC_ACTION_COMMAND is required")
+	}
+	if _, err := exec.LookPath(p.command); err != nil {
+		return fmt.Errorf("EXEC_ACTION_COMMAND '%s' cannot be executed: %v", p.command, err)
+	}
+	if p.workingDir != "" {
+		info, err := os.Stat(p.workingDir)
+		if err != nil {
+			return fmt.Errorf("cannot access EXEC_ACTION_WORKING_DIR '%s': %v", p.workingDir, err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("EXEC_ACTION_WORKING_DIR '%s' is not a directory", p.workingDir)
+		}
+	}
+	if p.timeout <= 0 {
+		return fmt.Errorf("EXEC_ACTION_TIMEOUT must be greater than 0, got %v", p.timeout)
+	}
+	return nil
+}
+
+// lineLogger is an io.Writer that logs each line written to it
+type lineLogger struct {
+	command string
+	stream  string
+
+	mu       sync.Mutex
+	buf      []byte
+	lastLine string
+}
+
+func (l *lineLogger) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.log(string(l.buf[:i]))
+		l.buf = l.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush logs the output after the last newline
+func (l *lineLogger) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.buf) > 0 {
+		l.log(string(l.buf))
+		l.buf = nil
+	}
+}
+
+// LastLine returns the last non-empty line written
+func (l *lineLogger) LastLine() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastLine
+}
+
+func (l *lineLogger) log(line string) {
+	line = strings.TrimRight(line, "\r")
+	if line == "" {
+		return
+	}
+	l.lastLine = line
+	log.Info().Str("command", l.command).Str("stream", l.stream).Msg(line)
+}
+
+// formatFloat formats a value without trailing zeros
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// parseList parses a JSON array of strings, or a comma-separated list
+func parseList(value string) ([]string, error) {
+	if strings.HasPrefix(strings.TrimSpace(value), "[") {
+		var list []string
+		if err := json.Unmarshal([]byte(value), &list); err != nil {
+			return nil, err
+		}
+		return list, nil
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list, nil
+}
+
+// newExecActionPlugin reads the plugin configuration from environment variables
+func newExecActionPlugin(getenv func(string) string) ExecActionPlugin {
+	p := ExecActionPlugin{
+		command:    getenv("EXEC_ACTION_COMMAND"),
+		workingDir: getenv("EXEC_ACTION_WORKING_DIR"),
+		timeout:    defaultTimeout,
+		allowedEnv: defaultAllowedEnv,
+	}
+
+	// Don't fail here - let ValidateConfig() report configuration errors
+	var errs []string
+	if args := getenv("EXEC_ACTION_ARGS"); args != "" {
+		// Arguments may contain commas, so only a JSON array is accepted
+		if err := json.Unmarshal([]byte(args), &p.args); err != nil {
+			errs = append(errs, fmt.Sprintf("EXEC_ACTION_ARGS must be a JSON array of strings: %v", err))
+		}
+	}
+	if allowed := getenv("EXEC_ACTION_ALLOWED_ENV"); allowed != "" {
+		list, err := parseList(allowed)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("EXEC_ACTION_ALLOWED_ENV must be a JSON array or a comma-separated list: %v", err))
+		}
+		p.allowedEnv = list
+	}
+	if timeout := getenv("EXEC_ACTION_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("invalid EXEC_ACTION_TIMEOUT: %v", err))
+		}
+		p.timeout = d
+	}
+	if len(errs) > 0 {
+		p.configErr = fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return p
+}
+
+// Plugin is the exported plugin symbol
+var Plugin ExecActionPlugin
+
+func init() {
+	Plugin = newExecActionPlugin(os.Getenv)
+}
+
+// main runs the plugin as an exec plugin when built as a regular binary.
+// It is not called when the plugin is loaded as a shared library.
+func main() {
+	pluginapi.Serve(&Plugin)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	pluginapi "metric-reader/pkg/plugin"
+)
+
+// env returns a getenv function backed by a map
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+// syncBuffer is a bytes.Buffer safe for the concurrent writes of the stdout and stderr loggers
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLogs redirects the global logger to a buffer for the duration of the test
+func captureLogs(t *testing.T) *syncBuffer {
+	t.Helper()
+	buf := &syncBuffer{}
+	original := log.Logger
+	log.Logger = zerolog.New(buf)
+	t.Cleanup(func() { log.Logger = original })
+	return buf
+}
+
+// shellPlugin returns a plugin running script with /bin/sh
+func shellPlugin(t *testing.T, script string, vars map[string]string) ExecActionPlugin {
+	t.Helper()
+	args, _ := json.Marshal([]string{"-c", script})
+	all := map[string]string{
+		"EXEC_ACTION_COMMAND": "/bin/sh",
+		"EXEC_ACTION_ARGS":    string(args),
+	}
+	for k, v := range vars {
+		all[k] = v
+	}
+	p := newExecActionPlugin(env(all))
+	if err := p.ValidateConfig(); err != nil {
+		t.Fatalf("ValidateConfig failed: %v", err)
+	}
+	return p
+}
+
+// TestPluginInterface verifies that the plugin implements the required interface
+func TestPluginInterface(t *testing.T) {
+	if Plugin.Name() != "exec_action" {
+		t.Errorf("expected plugin name 'exec_action', got '%s'", Plugin.Name())
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		vars    map[string]string
+		wantErr string
+	}{
+		{"missing command", map[string]string{}, "EXEC_ACTION_COMMAND is required"},
+		{"unknown command", map[string]string{"EXEC_ACTION_COMMAND": "metric-reader-no-such-command"}, "cannot be executed"},
+		{"invalid args", map[string]string{"EXEC_ACTION_COMMAND": "/bin/sh", "EXEC_ACTION_ARGS": "-c true"}, "EXEC_ACTION_ARGS"},
+		{"working dir is a file", map[string]string{"EXEC_ACTION_COMMAND": "/bin/sh", "EXEC_ACTION_WORKING_DIR": file}, "not a directory"},
+		{"invalid timeout", map[string]string{"EXEC_ACTION_COMMAND": "/bin/sh", "EXEC_ACTION_TIMEOUT": "-"}, "EXEC_ACTION_TIMEOUT"},
+		{"valid", map[string]string{"EXEC_ACTION_COMMAND": "sh", "EXEC_ACTION_ARGS": `["-c", "true"]`}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newExecActionPlugin(env(tt.vars))
+			err := p.ValidateConfig()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("expected valid config, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestEventPassedAsEnvAndStdin(t *testing.T) {
+	logs := captureLogs(t)
+	dir := t.TempDir()
+	t.Setenv("EXEC_ACTION_TEST_ALLOWED", "visible")
+	t.Setenv("EXEC_ACTION_TEST_SECRET", "hidden")
+
+	p := shellPlugin(t, `
+echo "metric=$METRIC_READER_METRIC_NAME value=$METRIC_READER_VALUE threshold=$METRIC_READER_OPERATOR $METRIC_READER_THRESHOLD"
+echo "level=$METRIC_READER_LEVEL reason=$METRIC_READER_REASON instance=$METRIC_READER_LABEL_INSTANCE"
+echo "allowed=$EXEC_ACTION_TEST_ALLOWED secret=$EXEC_ACTION_TEST_SECRET dir=$(pwd)"
+cat > event.json
+echo "done" >&2`, map[string]string{
+		"EXEC_ACTION_WORKING_DIR": dir,
+		"EXEC_ACTION_ALLOWED_ENV": "PATH, EXEC_ACTION_TEST_ALLOWED",
+	})
+
+	event := &pluginapi.ThresholdEvent{
+		Monitor:    "cpu",
+		MetricName: "node_cpu_usage",
+		Labels:     map[string]string{"instance": "node-1"},
+		Level:      "hard",
+		Operator:   "greater_than",
+		Threshold:  90,
+		Value:      97.5,
+		Reason:     pluginapi.ReasonThresholdCrossed,
+		Duration:   time.Minute,
+	}
+	if err := p.HandleEvent(context.Background(), event); err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+
+	output := logs.String()
+	for _, want := range []string{
+		`"stream":"stdout","message":"metric=node_cpu_usage value=97.5 threshold=greater_than 90"`,
+		`"message":"level=hard reason=threshold_crossed instance=node-1"`,
+		`"message":"allowed=visible secret= dir=` + dir + `"`,
+		`"stream":"stderr","message":"done"`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected log output to contain %s, got:\n%s", want, output)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "event.json"))
+	if err != nil {
+		t.Fatalf("expected event on stdin to be written by the command: %v", err)
+	}
+	var got pluginapi.ThresholdEvent
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("failed to decode event from stdin: %v", err)
+	}
+	if got.MetricName != "node_cpu_usage" || got.Labels["instance"] != "node-1" || got.Value != 97.5 {
+		t.Errorf("unexpected event on stdin: %+v", got)
+	}
+}
+
+func TestExitCodeMapsToError(t *testing.T) {
+	captureLogs(t)
+	p := shellPlugin(t, `echo "cache not found" >&2; exit 3`, nil)
+
+	err := p.HandleEvent(context.Background(), &pluginapi.ThresholdEvent{MetricName: "node_cpu_usage", Value: 97.5})
+	if err == nil || !strings.Contains(err.Error(), "exited with code 3: cache not found") {
+		t.Errorf("expected exit code error, got %v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	captureLogs(t)
+	p := shellPlugin(t, `sleep 10`, map[string]string{"EXEC_ACTION_TIMEOUT": "100ms"})
+
+	start := time.Now()
+	err := p.HandleEvent(context.Background(), &pluginapi.ThresholdEvent{MetricName: "node_cpu_usage", Value: 97.5})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 8*time.Second {
+		t.Errorf("expected command to be killed on timeout, took %v", elapsed)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/rs/zerolog/log"
+	pluginapi "metric-reader/pkg/plugin"
 )
 
 // FileActionPlugin creates a file with configurable size
@@ -17,10 +18,10 @@ type FileActionPlugin struct {
 	fileSize  int64
 }
 
-// Execute implements the ActionPlugin interface
-func (p *FileActionPlugin) Execute(ctx context.Context, metricName string, value float64, threshold string, duration time.Duration) error {
+// HandleEvent implements the ActionPlugin interface
+func (p *FileActionPlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
 	// Create filename with timestamp
-	filename := fmt.Sprintf("metric_%s_%d.bin", metricName, time.Now().Unix())
+	filename := fmt.Sprintf("metric_%s_%d.bin", event.MetricName, time.Now().Unix())
 	filepath := filepath.Join(p.outputDir, filename)
 
 	// Create file
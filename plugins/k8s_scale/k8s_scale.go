@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
+	pluginapi "metric-reader/pkg/plugin"
+)
+
+const (
+	kindDeployment  = "deployment"
+	kindStatefulSet = "statefulset"
+
+	// originalReplicasAnnotation records, for each series and threshold level that scaled the workload,
+	// the replica count before its first scaling, so recovery restores it even after metric-reader restarted
+	originalReplicasAnnotation = "metric-reader/original-replicas"
+
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// K8sScalePlugin scales a Deployment or StatefulSet through the scale subresource when a threshold
+// fires and restores the replica count from before the level's scaling when it is used as recovery_plugin
+type K8sScalePlugin struct {
+	kind      string
+	name      string
+	namespace string
+	// replicas is the absolute target replica count; step is used when replicas is not set
+	replicas    *int32
+	step        int32
+	minReplicas int32
+	// maxReplicas is the upper bound; 0 means unbounded
+	maxReplicas int32
+
+	client kubernetes.Interface
+	// configErr holds errors found while reading the configuration, reported by ValidateConfig
+	configErr error
+}
+
+// originalReplicas is the replica count of the workload before a series' level first scaled it.
+// The entries are kept in the order they scaled the workload.
+type originalReplicas struct {
+	Monitor  string            `json:"monitor,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Level    string            `json:"level"`
+	Replicas int32             `json:"replicas"`
+}
+
+// HandleEvent implements the ActionPlugin interface. Recovery events restore the replica count
+// from before the recovered level scaled the workload.
+func (p *K8sScalePlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
+	if event.Reason == pluginapi.ReasonRecovered {
+		return p.restore(ctx, event)
+	}
+	return p.scale(ctx, event)
+}
+
+// scale changes the replica count to the configured target, within the bounds
+func (p *K8sScalePlugin) scale(ctx context.Context, event *pluginapi.ThresholdEvent) error {
+	var from, to int32
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		originals, err := p.originals(ctx)
+		if err != nil {
+			return err
+		}
+		scale, err := p.getScale(ctx)
+		if err != nil {
+			return err
+		}
+
+		// Keep the count from before the level's first scaling when the action is executed again.
+		// It is recorded even when the count is already at the target, since another series may
+		// have scaled to it and recover first.
+		if indexOfSeriesLevel(originals, event) < 0 {
+			original := originalReplicas{Monitor: event.Monitor, Labels: event.Labels, Level: event.Level, Replicas: scale.Spec.Replicas}
+			if err := p.setOriginals(ctx, append(originals, original)); err != nil {
+				return err
+			}
+			// The patch changed the workload's resource version, which the scale update must carry
+			if scale, err = p.getScale(ctx); err != nil {
+				return err
+			}
+		}
+
+		from = scale.Spec.Replicas
+		to = p.target(from)
+		if to == from {
+			return nil
+		}
+		scale.Spec.Replicas = to
+		return p.updateScale(ctx, scale)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scale %s %s/%s: %v", p.kind, p.namespace, p.name, err)
+	}
+
+	if from == to {
+		log.Info().
+			Str("kind", p.kind).
+			Str("namespace", p.namespace).
+			Str("name", p.name).
+			Int32("replicas", to).
+			Msg("replica count already at target, not scaling")
+		return nil
+	}
+
+	log.Info().
+		Str("kind", p.kind).
+		Str("namespace", p.namespace).
+		Str("name", p.name).
+		Str("metric_name", event.MetricName).
+		Str("threshold_level", event.Level).
+		Int32("from", from).
+		Int32("to", to).
+		Msg("scaled workload")
+	return nil
+}
+
+// restore scales back to the replica count recorded before the series' level first scaled the workload.
+// The series' levels that scaled after it are restored too, since their counts were recorded on top
+// of it; the levels that scaled before it, e.g. soft when hard recovers, keep their scaling. While
+// another series scaled after it and still holds its scaling, the replica count is left as is and
+// that series' entry takes over the recorded count, so it is restored once the last series recovers.
+func (p *K8sScalePlugin) restore(ctx context.Context, event *pluginapi.ThresholdEvent) error {
+	var from, to int32
+	var held bool
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		originals, err := p.originals(ctx)
+		if err != nil {
+			return err
+		}
+		scale, err := p.getScale(ctx)
+		if err != nil {
+			return err
+		}
+		from, to, held = scale.Spec.Replicas, scale.Spec.Replicas, false
+		i := indexOfSeriesLevel(originals, event)
+		if i < 0 {
+			return nil
+		}
+
+		remaining := append([]originalReplicas{}, originals[:i]...)
+		for _, original := range originals[i+1:] {
+			if !sameSeries(original, event) {
+				remaining = append(remaining, original)
+			}
+		}
+		if len(remaining) > i {
+			remaining[i].Replicas = originals[i].Replicas
+			held = true
+		} else {
+			to = originals[i].Replicas
+		}
+
+		if to != from {
+			scale.Spec.Replicas = to
+			if err := p.updateScale(ctx, scale); err != nil {
+				return err
+			}
+		}
+		return p.setOriginals(ctx, remaining)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore %s %s/%s: %v", p.kind, p.namespace, p.name, err)
+	}
+
+	if held {
+		log.Info().
+			Str("kind", p.kind).
+			Str("namespace", p.namespace).
+			Str("name", p.name).
+			Str("threshold_level", event.Level).
+			Int32("replicas", to).
+			Msg("other series still hold their scaling, keeping replica count")
+		return nil
+	}
+	if from == to {
+		log.Info().
+			Str("kind", p.kind).
+			Str("namespace", p.namespace).
+			Str("name", p.name).
+			Str("threshold_level", event.Level).
+			Int32("replicas", to).
+			Msg("no scaling to restore")
+		return nil
+	}
+
+	log.Info().
+		Str("kind", p.kind).
+		Str("namespace", p.namespace).
+		Str("name", p.name).
+		Str("threshold_level", event.Level).
+		Int32("from", from).
+		Int32("to", to).
+		Msg("restored original replica count")
+	return nil
+}
+
+// target returns the replica count to scale to from the current count
+func (p *K8sScalePlugin) target(current int32) int32 {
+	target := current + p.step
+	if p.replicas != nil {
+		target = *p.replicas
+	}
+	if target < p.minReplicas {
+		target = p.minReplicas
+	}
+	if p.maxReplicas > 0 && target > p.maxReplicas {
+		target = p.maxReplicas
+	}
+	return target
+}
+
+// getScale reads the scale subresource of the workload
+func (p *K8sScalePlugin) getScale(ctx context.Context) (*autoscalingv1.Scale, error) {
+	switch p.kind {
+	case kindDeployment:
+		return p.client.AppsV1().Deployments(p.namespace).GetScale(ctx, p.name, metav1.GetOptions{})
+	case kindStatefulSet:
+		return p.client.AppsV1().StatefulSets(p.namespace).GetScale(ctx, p.name, metav1.GetOptions{})
+	default:
+		return nil, fmt.Errorf("unsupported kind %q", p.kind)
+	}
+}
+
+// updateScale writes the scale subresource of the workload. The resource version read by getScale
+// makes concurrent changes fail with a conflict.
+func (p *K8sScalePlugin) updateScale(ctx context.Context, scale *autoscalingv1.Scale) error {
+	var err error
+	switch p.kind {
+	case kindDeployment:
+		_, err = p.client.AppsV1().Deployments(p.namespace).UpdateScale(ctx, p.name, scale, metav1.UpdateOptions{})
+	case kindStatefulSet:
+		_, err = p.client.AppsV1().StatefulSets(p.namespace).UpdateScale(ctx, p.name, scale, metav1.UpdateOptions{})
+	default:
+		err = fmt.Errorf("unsupported kind %q", p.kind)
+	}
+	return err
+}
+
+// originals reads the replica counts recorded in the workload's annotation
+func (p *K8sScalePlugin) originals(ctx context.Context) ([]originalReplicas, error) {
+	var meta metav1.ObjectMeta
+	switch p.kind {
+	case kindDeployment:
+		d, err := p.client.AppsV1().Deployments(p.namespace).Get(ctx, p.name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		meta = d.ObjectMeta
+	case kindStatefulSet:
+		s, err := p.client.AppsV1().StatefulSets(p.namespace).Get(ctx, p.name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		meta = s.ObjectMeta
+	default:
+		return nil, fmt.Errorf("unsupported kind %q", p.kind)
+	}
+
+	value, ok := meta.Annotations[originalReplicasAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	var originals []originalReplicas
+	if err := json.Unmarshal([]byte(value), &originals); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation %q: %v", originalReplicasAnnotation, value, err)
+	}
+	return originals, nil
+}
+
+// setOriginals writes the recorded replica counts to the workload's annotation, removing it when
+// there are none. Only the annotation is patched; the rest of the workload is left untouched.
+func (p *K8sScalePlugin) setOriginals(ctx context.Context, originals []originalReplicas) error {
+	var value interface{}
+	if len(originals) > 0 {
+		data, err := json.Marshal(originals)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s annotation: %v", originalReplicasAnnotation, err)
+		}
+		value = string(data)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{originalReplicasAnnotation: value},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode %s annotation patch: %v", originalReplicasAnnotation, err)
+	}
+
+	switch p.kind {
+	case kindDeployment:
+		_, err = p.client.AppsV1().Deployments(p.namespace).Patch(ctx, p.name, types.MergePatchType, patch, metav1.PatchOptions{})
+	case kindStatefulSet:
+		_, err = p.client.AppsV1().StatefulSets(p.namespace).Patch(ctx, p.name, types.MergePatchType, patch, metav1.PatchOptions{})
+	default:
+		err = fmt.Errorf("unsupported kind %q", p.kind)
+	}
+	return err
+}
+
+// indexOfSeriesLevel returns the index of the entry of the event's series and level in originals, or -1
+func indexOfSeriesLevel(originals []originalReplicas, event *pluginapi.ThresholdEvent) int {
+	for i, original := range originals {
+		if original.Level == event.Level && sameSeries(original, event) {
+			return i
+		}
+	}
+	return -1
+}
+
+// sameSeries reports whether the entry was recorded for the event's monitor and series
+func sameSeries(original originalReplicas, event *pluginapi.ThresholdEvent) bool {
+	return original.Monitor == event.Monitor && maps.Equal(original.Labels, event.Labels)
+}
+
+// Name implements the ActionPlugin interface
+func (p *K8sScalePlugin) Name() string {
+	return "k8s_scale"
+}
+
+// ValidateConfig implements the ActionPlugin interface
+func (p *K8sScalePlugin) ValidateConfig() error {
+	if p.configErr != nil {
+		return p.configErr
+	}
+	if p.kind != kindDeployment && p.kind != kindStatefulSet {
+		return fmt.Errorf("K8S_SCALE_KIND must be %q or %q, got %q", kindDeployment, kindStatefulSet, p.kind)
+	}
+	if p.name == "" {
+		return fmt.Errorf("K8S_SCALE_NAME is required")
+	}
+	if p.namespace == "" {
+		return fmt.Errorf("K8S_SCALE_NAMESPACE is required when not running in a pod")
+	}
+	if p.replicas == nil && p.step == 0 {
+		return fmt.Errorf("one of K8S_SCALE_REPLICAS or K8S_SCALE_STEP is required")
+	}
+	if p.replicas != nil && p.step != 0 {
+		return fmt.Errorf("K8S_SCALE_REPLICAS and K8S_SCALE_STEP are mutually exclusive")
+	}
+	if p.replicas != nil && *p.replicas < 0 {
+		return fmt.Errorf("K8S_SCALE_REPLICAS must not be negative, got %d", *p.replicas)
+	}
+	if p.minReplicas < 0 {
+		return fmt.Errorf("K8S_SCALE_MIN_REPLICAS must not be negative, got %d", p.minReplicas)
+	}
+	if p.maxReplicas < 0 || (p.maxReplicas > 0 && p.maxReplicas < p.minReplicas) {
+		return fmt.Errorf("K8S_SCALE_MAX_REPLICAS must be at least K8S_SCALE_MIN_REPLICAS (%d), got %d", p.minReplicas, p.maxReplicas)
+	}
+	if p.client == nil {
+		return fmt.Errorf("kubernetes client not initialized - k8s_scale requires running in a cluster")
+	}
+	return nil
+}
+
+// newK8sScalePlugin reads the plugin configuration from environment variables
+func newK8sScalePlugin(getenv func(string) string, client kubernetes.Interface) K8sScalePlugin {
+	p := K8sScalePlugin{
+		kind:      strings.ToLower(getenv("K8S_SCALE_KIND")),
+		name:      getenv("K8S_SCALE_NAME"),
+		namespace: getenv("K8S_SCALE_NAMESPACE"),
+		client:    client,
+	}
+	if p.kind == "" {
+		p.kind = kindDeployment
+	}
+
+	// Don't fail here - let ValidateConfig() report configuration errors
+	var errs []string
+	parseInt32 := func(name string, target *int32) bool {
+		value := getenv(name)
+		if value == "" {
+			return false
+		}
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("invalid %s: %v", name, err))
+			return false
+		}
+		*target = int32(n)
+		return true
+	}
+
+	var replicas int32
+	if parseInt32("K8S_SCALE_REPLICAS", &replicas) {
+		p.replicas = &replicas
+	}
+	parseInt32("K8S_SCALE_STEP", &p.step)
+	parseInt32("K8S_SCALE_MIN_REPLICAS", &p.minReplicas)
+	parseInt32("K8S_SCALE_MAX_REPLICAS", &p.maxReplicas)
+
+	if len(errs) > 0 {
+		p.configErr = fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return p
+}
+
+// Plugin is the exported plugin symbol
+var Plugin K8sScalePlugin
+
+func init() {
+	var client kubernetes.Interface
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to get in-cluster config - k8s_scale plugin will fail validation")
+	} else if clientset, err := kubernetes.NewForConfig(cfg); err != nil {
+		log.Warn().Err(err).Msg("unable to build kubernetes client - k8s_scale plugin will fail validation")
+	} else {
+		client = clientset
+	}
+
+	getenv := func(name string) string {
+		value := os.Getenv(name)
+		// Default to the namespace of the pod
+		if name == "K8S_SCALE_NAMESPACE" && value == "" {
+			if data, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
+				value = strings.TrimSpace(string(data))
+			}
+		}
+		return value
+	}
+	Plugin = newK8sScalePlugin(getenv, client)
+}
+
+// main runs the plugin as an exec plugin when built as a regular binary.
+// It is not called when the plugin is loaded as a shared library.
+func main() {
+	pluginapi.Serve(&Plugin)
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	pluginapi "metric-reader/pkg/plugin"
+)
+
+// env returns a getenv function backed by a map
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+// newFakeClient returns a fake clientset serving the scale subresource of the tracked
+// Deployments and StatefulSets, which the fake object tracker doesn't emulate. Like the API server,
+// a scale update carrying the resource version of an older read fails with a conflict.
+func newFakeClient(objects ...runtime.Object) *fake.Clientset {
+	client := fake.NewSimpleClientset(objects...)
+	tracker := client.Tracker()
+
+	// versions counts the writes of each workload, as its resource version
+	versions := map[string]int{}
+	versionKey := func(action k8stesting.Action, name string) string {
+		return action.GetResource().Resource + "/" + action.GetNamespace() + "/" + name
+	}
+	client.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		versions[versionKey(action, action.(k8stesting.PatchAction).GetName())]++
+		return false, nil, nil
+	})
+
+	scaleReactor := func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		var name string
+		var replicas *int32
+		if update, ok := action.(k8stesting.UpdateAction); ok {
+			scale := update.GetObject().(*autoscalingv1.Scale)
+			name, replicas = scale.Name, &scale.Spec.Replicas
+			if scale.ResourceVersion != strconv.Itoa(versions[versionKey(action, name)]) {
+				return true, nil, apierrors.NewConflict(action.GetResource().GroupResource(), name, errors.New("the object has been modified"))
+			}
+		} else {
+			name = action.(k8stesting.GetAction).GetName()
+		}
+
+		obj, err := tracker.Get(action.GetResource(), action.GetNamespace(), name)
+		if err != nil {
+			return true, nil, err
+		}
+		var spec **int32
+		switch workload := obj.(type) {
+		case *appsv1.Deployment:
+			spec = &workload.Spec.Replicas
+		case *appsv1.StatefulSet:
+			spec = &workload.Spec.Replicas
+		default:
+			return true, nil, fmt.Errorf("unexpected object %T", obj)
+		}
+		if replicas != nil {
+			*spec = replicas
+			if err := tracker.Update(action.GetResource(), obj, action.GetNamespace()); err != nil {
+				return true, nil, err
+			}
+			versions[versionKey(action, name)]++
+		}
+		current := int32(1)
+		if *spec != nil {
+			current = **spec
+		}
+		return true, &autoscalingv1.Scale{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: action.GetNamespace(), ResourceVersion: strconv.Itoa(versions[versionKey(action, name)])},
+			Spec:       autoscalingv1.ScaleSpec{Replicas: current},
+		}, nil
+	}
+	client.PrependReactor("get", "*", scaleReactor)
+	client.PrependReactor("update", "*", scaleReactor)
+	return client
+}
+
+// TestPluginInterface verifies that the plugin implements the required interface
+func TestPluginInterface(t *testing.T) {
+	if Plugin.Name() != "k8s_scale" {
+		t.Errorf("expected plugin name 'k8s_scale', got '%s'", Plugin.Name())
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	client := newFakeClient()
+	base := map[string]string{"K8S_SCALE_NAME": "web", "K8S_SCALE_NAMESPACE": "default"}
+	with := func(vars map[string]string) map[string]string {
+		all := map[string]string{}
+		for k, v := range base {
+			all[k] = v
+		}
+		for k, v := range vars {
+			all[k] = v
+		}
+		return all
+	}
+
+	tests := []struct {
+		name    string
+		vars    map[string]string
+		wantErr string
+	}{
+		{"invalid kind", with(map[string]string{"K8S_SCALE_KIND": "daemonset", "K8S_SCALE_STEP": "1"}), "K8S_SCALE_KIND"},
+		{"missing name", map[string]string{"K8S_SCALE_NAMESPACE": "default", "K8S_SCALE_STEP": "1"}, "K8S_SCALE_NAME is required"},
+		{"missing target", with(nil), "one of K8S_SCALE_REPLICAS or K8S_SCALE_STEP"},
+		{"replicas and step", with(map[string]string{"K8S_SCALE_REPLICAS": "5", "K8S_SCALE_STEP": "1"}), "mutually exclusive"},
+		{"invalid step", with(map[string]string{"K8S_SCALE_STEP": "one"}), "invalid K8S_SCALE_STEP"},
+		{"max below min", with(map[string]string{"K8S_SCALE_STEP": "1", "K8S_SCALE_MIN_REPLICAS": "3", "K8S_SCALE_MAX_REPLICAS": "2"}), "K8S_SCALE_MAX_REPLICAS"},
+		{"valid statefulset", with(map[string]string{"K8S_SCALE_KIND": "StatefulSet", "K8S_SCALE_REPLICAS": "5"}), ""},
+		{"valid negative step", with(map[string]string{"K8S_SCALE_STEP": "-1", "K8S_SCALE_MIN_REPLICAS": "1"}), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newK8sScalePlugin(env(tt.vars), client)
+			err := p.ValidateConfig()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("expected valid config, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	// Without a cluster there is no client
+	p := newK8sScalePlugin(env(with(map[string]string{"K8S_SCALE_STEP": "1"})), nil)
+	if err := p.ValidateConfig(); err == nil || !strings.Contains(err.Error(), "client not initialized") {
+		t.Errorf("expected missing client error, got %v", err)
+	}
+}
+
+func TestScaleByStepWithinBoundsAndRestore(t *testing.T) {
+	client := newFakeClient(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(2)},
+	})
+	p := newK8sScalePlugin(env(map[string]string{
+		"K8S_SCALE_NAME":         "web",
+		"K8S_SCALE_NAMESPACE":    "default",
+		"K8S_SCALE_STEP":         "2",
+		"K8S_SCALE_MAX_REPLICAS": "5",
+	}), client)
+	if err := p.ValidateConfig(); err != nil {
+		t.Fatalf("ValidateConfig failed: %v", err)
+	}
+
+	ctx := context.Background()
+	replicas := deploymentReplicas(t, client)
+
+	fired := &pluginapi.ThresholdEvent{MetricName: "queue_depth", Level: "soft", Reason: pluginapi.ReasonThresholdCrossed}
+	if err := p.HandleEvent(ctx, fired); err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+	if got, original := replicas(); got != 4 || original != `[{"level":"soft","replicas":2}]` {
+		t.Errorf("expected 4 replicas with original 2 recorded, got %d (original %q)", got, original)
+	}
+
+	// Executing again after the backoff delay steps again, capped at the maximum,
+	// and keeps the count from before the first scaling
+	fired.Reason = pluginapi.ReasonBackoffExpired
+	if err := p.HandleEvent(ctx, fired); err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+	if got, original := replicas(); got != 5 || original != `[{"level":"soft","replicas":2}]` {
+		t.Errorf("expected 5 replicas with original 2 recorded, got %d (original %q)", got, original)
+	}
+
+	recovered := &pluginapi.ThresholdEvent{MetricName: "queue_depth", Level: "soft", Reason: pluginapi.ReasonRecovered}
+	if err := p.HandleEvent(ctx, recovered); err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+	if got, original := replicas(); got != 2 || original != "" {
+		t.Errorf("expected 2 replicas restored and annotation removed, got %d (original %q)", got, original)
+	}
+
+	// A second recovery has nothing to restore
+	if err := p.HandleEvent(ctx, recovered); err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+	if got, _ := replicas(); got != 2 {
+		t.Errorf("expected replicas to stay at 2, got %d", got)
+	}
+}
+
+func TestScaleStatefulSetToReplicas(t *testing.T) {
+	client := newFakeClient(&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "data"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: int32Ptr(5)},
+	})
+	p := newK8sScalePlugin(env(map[string]string{
+		"K8S_SCALE_KIND":         "statefulset",
+		"K8S_SCALE_NAME":         "db",
+		"K8S_SCALE_NAMESPACE":    "data",
+		"K8S_SCALE_REPLICAS":     "1",
+		"K8S_SCALE_MIN_REPLICAS": "2",
+	}), client)
+
+	ctx := context.Background()
+	if err := p.HandleEvent(ctx, &pluginapi.ThresholdEvent{MetricName: "cost", Value: 100}); err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+	s, err := client.AppsV1().StatefulSets("data").Get(ctx, "db", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get statefulset: %v", err)
+	}
+	if *s.Spec.Replicas != 2 {
+		t.Errorf("expected target raised to the minimum of 2 replicas, got %d", *s.Spec.Replicas)
+	}
+	if s.Annotations[originalReplicasAnnotation] != `[{"level":"","replicas":5}]` {
+		t.Errorf("expected original replicas 5 recorded, got %q", s.Annotations[originalReplicasAnnotation])
+	}
+}
+
+func TestScaleMissingWorkload(t *testing.T) {
+	p := newK8sScalePlugin(env(map[string]string{
+		"K8S_SCALE_NAME":      "missing",
+		"K8S_SCALE_NAMESPACE": "default",
+		"K8S_SCALE_STEP":      "1",
+	}), newFakeClient())
+
+	err := p.HandleEvent(context.Background(), &pluginapi.ThresholdEvent{MetricName: "queue_depth", Value: 100})
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+// deploymentReplicas returns a function reading the replica count and the original replicas
+// annotation of the web deployment
+func deploymentReplicas(t *testing.T, client *fake.Clientset) func() (int32, string) {
+	return func() (int32, string) {
+		d, err := client.AppsV1().Deployments("default").Get(context.Background(), "web", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get deployment: %v", err)
+		}
+		return *d.Spec.Replicas, d.Annotations[originalReplicasAnnotation]
+	}
+}
+
+// TestRestorePerLevel tests that the hard recovery returns to the soft scaling
+// instead of undoing it, and the soft recovery restores the count from before the incident
+func TestRestorePerLevel(t *testing.T) {
+	client := newFakeClient(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(2)},
+	})
+	p := newK8sScalePlugin(env(map[string]string{
+		"K8S_SCALE_NAME":      "web",
+		"K8S_SCALE_NAMESPACE": "default",
+		"K8S_SCALE_STEP":      "2",
+	}), client)
+
+	ctx := context.Background()
+	replicas := deploymentReplicas(t, client)
+	handle := func(level string, reason pluginapi.Reason) {
+		t.Helper()
+		if err := p.HandleEvent(ctx, &pluginapi.ThresholdEvent{MetricName: "queue_depth", Level: level, Reason: reason}); err != nil {
+			t.Fatalf("HandleEvent failed: %v", err)
+		}
+	}
+
+	handle("soft", pluginapi.ReasonThresholdCrossed)
+	handle("hard", pluginapi.ReasonThresholdCrossed)
+	if got, original := replicas(); got != 6 || original != `[{"level":"soft","replicas":2},{"level":"hard","replicas":4}]` {
+		t.Fatalf("expected 6 replicas with soft and hard originals recorded, got %d (original %q)", got, original)
+	}
+
+	handle("hard", pluginapi.ReasonRecovered)
+	if got, original := replicas(); got != 4 || original != `[{"level":"soft","replicas":2}]` {
+		t.Errorf("expected hard recovery to return to the soft scaling of 4 replicas, got %d (original %q)", got, original)
+	}
+
+	handle("soft", pluginapi.ReasonRecovered)
+	if got, original := replicas(); got != 2 || original != "" {
+		t.Errorf("expected soft recovery to restore 2 replicas and remove the annotation, got %d (original %q)", got, original)
+	}
+
+	// Replicas are only written through the scale subresource, never by updating the workload
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "update" && action.GetSubresource() != "scale" {
+			t.Errorf("unexpected %s of %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+}
+
+// TestRestoreUndoesLaterLevels tests that recovering a level also restores the levels that
+// scaled after it, e.g. when only the soft threshold has a recovery plugin
+func TestRestoreUndoesLaterLevels(t *testing.T) {
+	client := newFakeClient(&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "data"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: int32Ptr(3)},
+	})
+	p := newK8sScalePlugin(env(map[string]string{
+		"K8S_SCALE_KIND":      "statefulset",
+		"K8S_SCALE_NAME":      "db",
+		"K8S_SCALE_NAMESPACE": "data",
+		"K8S_SCALE_STEP":      "1",
+	}), client)
+
+	ctx := context.Background()
+	for _, level := range []string{"soft", "hard"} {
+		if err := p.HandleEvent(ctx, &pluginapi.ThresholdEvent{Level: level, Reason: pluginapi.ReasonThresholdCrossed}); err != nil {
+			t.Fatalf("HandleEvent failed: %v", err)
+		}
+	}
+	if err := p.HandleEvent(ctx, &pluginapi.ThresholdEvent{Level: "soft", Reason: pluginapi.ReasonRecovered}); err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+
+	s, err := client.AppsV1().StatefulSets("data").Get(ctx, "db", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get statefulset: %v", err)
+	}
+	if *s.Spec.Replicas != 3 || s.Annotations[originalReplicasAnnotation] != "" {
+		t.Errorf("expected 3 replicas restored and annotation removed, got %d (original %q)", *s.Spec.Replicas, s.Annotations[originalReplicasAnnotation])
+	}
+}
+
+// scaleUpdates returns the number of scale subresource updates sent to the client
+func scaleUpdates(client *fake.Clientset) int {
+	n := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "update" && action.GetSubresource() == "scale" {
+			n++
+		}
+	}
+	return n
+}
+
+// TestScaleAfterRecordingDoesNotConflict tests that the scale update carries the resource version
+// written by the annotation patch, so the first scaling of a level doesn't conflict
+func TestScaleAfterRecordingDoesNotConflict(t *testing.T) {
+	client := newFakeClient(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(2)},
+	})
+	p := newK8sScalePlugin(env(map[string]string{
+		"K8S_SCALE_NAME":      "web",
+		"K8S_SCALE_NAMESPACE": "default",
+		"K8S_SCALE_STEP":      "1",
+	}), client)
+
+	if err := p.HandleEvent(context.Background(), &pluginapi.ThresholdEvent{Level: "soft", Reason: pluginapi.ReasonThresholdCrossed}); err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+	if got, _ := deploymentReplicas(t, client)(); got != 3 {
+		t.Errorf("expected 3 replicas, got %d", got)
+	}
+	if n := scaleUpdates(client); n != 1 {
+		t.Errorf("expected a single scale update, got %d", n)
+	}
+}
+
+// TestRestoreWaitsForOtherSeries tests that a series recovering while another series of the
+// workload is still breached keeps the replica count, and the last recovery restores the count
+// from before the first scaling
+func TestRestoreWaitsForOtherSeries(t *testing.T) {
+	client := newFakeClient(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(2)},
+	})
+	p := newK8sScalePlugin(env(map[string]string{
+		"K8S_SCALE_NAME":      "web",
+		"K8S_SCALE_NAMESPACE": "default",
+		"K8S_SCALE_STEP":      "2",
+	}), client)
+
+	ctx := context.Background()
+	replicas := deploymentReplicas(t, client)
+	handle := func(instance string, reason pluginapi.Reason) {
+		t.Helper()
+		event := &pluginapi.ThresholdEvent{Monitor: "queue", Labels: map[string]string{"instance": instance}, Level: "soft", Reason: reason}
+		if err := p.HandleEvent(ctx, event); err != nil {
+			t.Fatalf("HandleEvent failed: %v", err)
+		}
+	}
+
+	handle("a", pluginapi.ReasonThresholdCrossed)
+	handle("b", pluginapi.ReasonThresholdCrossed)
+	if got, _ := replicas(); got != 6 {
+		t.Fatalf("expected 6 replicas after both series scaled, got %d", got)
+	}
+
+	handle("a", pluginapi.ReasonRecovered)
+	if got, original := replicas(); got != 6 || original != `[{"monitor":"queue","labels":{"instance":"b"},"level":"soft","replicas":2}]` {
+		t.Errorf("expected 6 replicas kept while b is breached and its entry to take over 2 replicas, got %d (original %q)", got, original)
+	}
+
+	handle("b", pluginapi.ReasonRecovered)
+	if got, original := replicas(); got != 2 || original != "" {
+		t.Errorf("expected the last recovery to restore 2 replicas and remove the annotation, got %d (original %q)", got, original)
+	}
+}
+
+// TestRestoreLastSeriesReturnsToEarlierScaling tests that the series that scaled last returns
+// to the scaling of the series that scaled before it
+func TestRestoreLastSeriesReturnsToEarlierScaling(t *testing.T) {
+	client := newFakeClient(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(2)},
+	})
+	p := newK8sScalePlugin(env(map[string]string{
+		"K8S_SCALE_NAME":      "web",
+		"K8S_SCALE_NAMESPACE": "default",
+		"K8S_SCALE_REPLICAS":  "5",
+	}), client)
+
+	ctx := context.Background()
+	replicas := deploymentReplicas(t, client)
+	queue := &pluginapi.ThresholdEvent{Monitor: "queue", Level: "soft", Reason: pluginapi.ReasonThresholdCrossed}
+	latency := &pluginapi.ThresholdEvent{Monitor: "latency", Level: "soft", Reason: pluginapi.ReasonThresholdCrossed}
+	for _, event := range []*pluginapi.ThresholdEvent{queue, latency} {
+		if err := p.HandleEvent(ctx, event); err != nil {
+			t.Fatalf("HandleEvent failed: %v", err)
+		}
+	}
+
+	// latency found the workload already at the target, and recovering it leaves queue's scaling
+	latency.Reason = pluginapi.ReasonRecovered
+	if err := p.HandleEvent(ctx, latency); err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+	if got, original := replicas(); got != 5 || original != `[{"monitor":"queue","level":"soft","replicas":2}]` {
+		t.Errorf("expected 5 replicas kept for queue, got %d (original %q)", got, original)
+	}
+
+	queue.Reason = pluginapi.ReasonRecovered
+	if err := p.HandleEvent(ctx, queue); err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+	if got, original := replicas(); got != 2 || original != "" {
+		t.Errorf("expected 2 replicas restored, got %d (original %q)", got, original)
+	}
+}
@@ -2,21 +2,30 @@ package main
 
 import (
 	"context"
-	"time"
 
 	"github.com/rs/zerolog/log"
+	pluginapi "metric-reader/pkg/plugin"
 )
 
 // LogActionPlugin is a simple plugin that logs threshold events
 type LogActionPlugin struct{}
 
-// Execute implements the ActionPlugin interface
-func (p *LogActionPlugin) Execute(ctx context.Context, metricName string, value float64, threshold string, duration time.Duration) error {
+// HandleEvent implements the ActionPlugin interface
+func (p *LogActionPlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
 	log.Info().
-		Str("metric_name", metricName).
-		Float64("value", value).
-		Str("threshold", threshold).
-		Dur("duration", duration).
+		Int("event_version", event.Version).
+		Str("monitor", event.Monitor).
+		Str("metric_name", event.MetricName).
+		Interface("labels", event.Labels).
+		Str("level", event.Level).
+		Str("threshold", event.ThresholdString()).
+		Float64("value", event.Value).
+		Float64("peak_value", event.PeakValue).
+		Str("previous_state", event.PreviousState).
+		Str("new_state", event.NewState).
+		Str("reason", string(event.Reason)).
+		Int("attempt", event.Attempt).
+		Dur("duration", event.Duration).
 		Msg("threshold action executed")
 	return nil
 }
@@ -34,3 +43,9 @@ func (p *LogActionPlugin) ValidateConfig() error {
 
 // Plugin is the exported plugin symbol
 var Plugin LogActionPlugin
+
+// main runs the plugin as an exec plugin when built as a regular binary.
+// It is not called when the plugin is loaded as a shared library.
+func main() {
+	pluginapi.Serve(&Plugin)
+}
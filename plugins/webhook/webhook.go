@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	pluginapi "metric-reader/pkg/plugin"
+)
+
+const (
+	defaultMethod       = http.MethodPost
+	defaultTimeout      = 10 * time.Second
+	defaultRetries      = 3
+	defaultRetryBackoff = time.Second
+	defaultHMACHeader   = "X-Metric-Reader-Signature"
+)
+
+// WebhookPlugin sends an HTTP request with a JSON payload when a threshold fires
+type WebhookPlugin struct {
+	url          string
+	method       string
+	headers      map[string]string
+	bodyTemplate *template.Template
+	timeout      time.Duration
+	retries      int
+	retryBackoff time.Duration
+	hmacSecret   string
+	hmacHeader   string
+
+	client *http.Client
+	// configErr holds errors found while reading the configuration, reported by ValidateConfig
+	configErr error
+}
+
+// templateFuncs are available in WEBHOOK_BODY_TEMPLATE
+var templateFuncs = template.FuncMap{
+	// json encodes a value as JSON, e.g. {{json .MetricName}} renders a quoted string
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// templateData is the data the body template is rendered with
+type templateData struct {
+	*pluginapi.ThresholdEvent
+	// ThresholdString is the operator and threshold, e.g. "greater_than 80.00"
+	ThresholdString string
+}
+
+// HandleEvent implements the ActionPlugin interface
+func (p *WebhookPlugin) HandleEvent(ctx context.Context, event *pluginapi.ThresholdEvent) error {
+	body, err := p.renderBody(event)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= p.retries; attempt++ {
+		if attempt > 0 {
+			// Exponential backoff between attempts
+			delay := p.retryBackoff * time.Duration(1<<(attempt-1))
+			log.Debug().Err(lastErr).Int("attempt", attempt+1).Dur("delay", delay).Msg("retrying webhook")
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("webhook aborted after %d attempts: %v", attempt, lastErr)
+			case <-time.After(delay):
+			}
+		}
+
+		retry, err := p.send(ctx, body)
+		if err == nil {
+			log.Info().
+				Str("url", p.url).
+				Str("metric_name", event.MetricName).
+				Int("attempt", attempt+1).
+				Msg("webhook sent")
+			return nil
+		}
+		lastErr = err
+		if !retry {
+			break
+		}
+	}
+
+	return fmt.Errorf("webhook failed: %v", lastErr)
+}
+
+// renderBody renders the body template, or encodes the whole event as JSON when no template is configured
+func (p *WebhookPlugin) renderBody(event *pluginapi.ThresholdEvent) ([]byte, error) {
+	if p.bodyTemplate == nil {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode event: %v", err)
+		}
+		return body, nil
+	}
+
+	var buf bytes.Buffer
+	if err := p.bodyTemplate.Execute(&buf, templateData{ThresholdEvent: event, ThresholdString: event.ThresholdString()}); err != nil {
+		return nil, fmt.Errorf("failed to render WEBHOOK_BODY_TEMPLATE: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// send performs a single request and reports whether a failure is worth retrying.
+// Network errors, 429 and 5xx responses are retried; other 4xx responses are not.
+func (p *WebhookPlugin) send(ctx context.Context, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, p.method, p.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range p.headers {
+		req.Header.Set(name, value)
+	}
+	if p.hmacSecret != "" {
+		req.Header.Set(p.hmacHeader, sign(p.hmacSecret, body))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// sign returns the hex encoded HMAC-SHA256 of body prefixed with "sha256="
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Name implements the ActionPlugin interface
+func (p *WebhookPlugin) Name() string {
+	return "webhook"
+}
+
+// ValidateConfig implements the ActionPlugin interface
+func (p *WebhookPlugin) ValidateConfig() error {
+	if p.configErr != nil {
+		return p.configErr
+	}
+	if p.url == "" {
+		return fmt.Errorf("WEBHOOK_URL is required")
+	}
+	if !strings.HasPrefix(p.url, "http://") && !strings.HasPrefix(p.url, "https://") {
+		return fmt.Errorf("WEBHOOK_URL must be an http or https URL, got %q", p.url)
+	}
+	if p.timeout <= 0 {
+		return fmt.Errorf("WEBHOOK_TIMEOUT must be greater than 0, got %v", p.timeout)
+	}
+	if p.retries < 0 {
+		return fmt.Errorf("WEBHOOK_RETRIES must not be negative, got %d", p.retries)
+	}
+	return nil
+}
+
+// newWebhookPlugin reads the plugin configuration from environment variables
+func newWebhookPlugin(getenv func(string) string) WebhookPlugin {
+	p := WebhookPlugin{
+		url:          getenv("WEBHOOK_URL"),
+		method:       defaultMethod,
+		headers:      map[string]string{},
+		timeout:      defaultTimeout,
+		retries:      defaultRetries,
+		retryBackoff: defaultRetryBackoff,
+		hmacSecret:   getenv("WEBHOOK_HMAC_SECRET"),
+		hmacHeader:   defaultHMACHeader,
+	}
+
+	// Don't fail here - let ValidateConfig() report configuration errors
+	var errs []string
+	if method := getenv("WEBHOOK_METHOD"); method != "" {
+		p.method = strings.ToUpper(method)
+	}
+	if header := getenv("WEBHOOK_HMAC_HEADER"); header != "" {
+		p.hmacHeader = header
+	}
+	if headers := getenv("WEBHOOK_HEADERS"); headers != "" {
+		if err := json.Unmarshal([]byte(headers), &p.headers); err != nil {
+			errs = append(errs, fmt.Sprintf("WEBHOOK_HEADERS must be a JSON object of header names to values: %v", err))
+		}
+	}
+	if body := getenv("WEBHOOK_BODY_TEMPLATE"); body != "" {
+		tmpl, err := template.New("body").Funcs(templateFuncs).Parse(body)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("invalid WEBHOOK_BODY_TEMPLATE: %v", err))
+		}
+		p.bodyTemplate = tmpl
+	}
+	if timeout := getenv("WEBHOOK_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("invalid WEBHOOK_TIMEOUT: %v", err))
+		}
+		p.timeout = d
+	}
+	if retries := getenv("WEBHOOK_RETRIES"); retries != "" {
+		n, err := strconv.Atoi(retries)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("invalid WEBHOOK_RETRIES: %v", err))
+		}
+		p.retries = n
+	}
+	if backoff := getenv("WEBHOOK_RETRY_BACKOFF"); backoff != "" {
+		d, err := time.ParseDuration(backoff)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("invalid WEBHOOK_RETRY_BACKOFF: %v", err))
+		}
+		p.retryBackoff = d
+	}
+	if len(errs) > 0 {
+		p.configErr = fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	p.client = &http.Client{}
+	return p
+}
+
+// Plugin is the exported plugin symbol
+var Plugin WebhookPlugin
+
+func init() {
+	Plugin = newWebhookPlugin(os.Getenv)
+}
+
+// main runs the plugin as an exec plugin when built as a regular binary.
+// It is not called when the plugin is loaded as a shared library.
+func main() {
+	pluginapi.Serve(&Plugin)
+}
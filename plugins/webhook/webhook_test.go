@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pluginapi "metric-reader/pkg/plugin"
+)
+
+// env returns a getenv function backed by a map
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+// TestPluginInterface verifies that the plugin implements the required interface
+func TestPluginInterface(t *testing.T) {
+	if Plugin.Name() != "webhook" {
+		t.Errorf("expected plugin name 'webhook', got '%s'", Plugin.Name())
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		vars    map[string]string
+		wantErr string
+	}{
+		{"missing url", map[string]string{}, "WEBHOOK_URL is required"},
+		{"invalid url", map[string]string{"WEBHOOK_URL": "ftp://example.com"}, "http or https"},
+		{"invalid headers", map[string]string{"WEBHOOK_URL": "http://example.com", "WEBHOOK_HEADERS": "X-Token=abc"}, "WEBHOOK_HEADERS"},
+		{"invalid template", map[string]string{"WEBHOOK_URL": "http://example.com", "WEBHOOK_BODY_TEMPLATE": "{{.MetricName"}, "WEBHOOK_BODY_TEMPLATE"},
+		{"invalid timeout", map[string]string{"WEBHOOK_URL": "http://example.com", "WEBHOOK_TIMEOUT": "soon"}, "WEBHOOK_TIMEOUT"},
+		{"negative retries", map[string]string{"WEBHOOK_URL": "http://example.com", "WEBHOOK_RETRIES": "-1"}, "WEBHOOK_RETRIES"},
+		{"valid", map[string]string{"WEBHOOK_URL": "https://example.com/hook"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newWebhookPlugin(env(tt.vars))
+			err := p.ValidateConfig()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("expected valid config, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestHandleEventRendersTemplateAndSigns(t *testing.T) {
+	var gotMethod, gotBody, gotToken, gotSignature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotMethod = r.Method
+		gotBody = string(body)
+		gotToken = r.Header.Get("X-Token")
+		gotSignature = r.Header.Get("X-Signature")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	p := newWebhookPlugin(env(map[string]string{
+		"WEBHOOK_URL":           server.URL,
+		"WEBHOOK_METHOD":        "put",
+		"WEBHOOK_HEADERS":       `{"X-Token": "secret-token"}`,
+		"WEBHOOK_BODY_TEMPLATE": `{"text": {{json .MetricName}}, "value": {{.Value}}, "threshold": {{json .ThresholdString}}, "for": "{{.Duration}}"}`,
+		"WEBHOOK_HMAC_SECRET":   "s3cret",
+		"WEBHOOK_HMAC_HEADER":   "X-Signature",
+	}))
+	if err := p.ValidateConfig(); err != nil {
+		t.Fatalf("ValidateConfig failed: %v", err)
+	}
+
+	event := &pluginapi.ThresholdEvent{
+		MetricName: "cpu_usage",
+		Value:      92.5,
+		Operator:   "greater_than",
+		Threshold:  90,
+		Duration:   2 * time.Minute,
+	}
+	if err := p.HandleEvent(context.Background(), event); err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+
+	if gotMethod != http.MethodPut {
+		t.Errorf("expected PUT, got %s", gotMethod)
+	}
+	want := `{"text": "cpu_usage", "value": 92.5, "threshold": "greater_than 90.00", "for": "2m0s"}`
+	if gotBody != want {
+		t.Errorf("unexpected body:\n got %s\nwant %s", gotBody, want)
+	}
+	if gotToken != "secret-token" {
+		t.Errorf("expected configured header, got %q", gotToken)
+	}
+	if gotSignature != sign("s3cret", []byte(want)) {
+		t.Errorf("unexpected signature %q", gotSignature)
+	}
+}
+
+func TestHandleEventSendsEventAsJSON(t *testing.T) {
+	var got pluginapi.ThresholdEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode body: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	p := newWebhookPlugin(env(map[string]string{"WEBHOOK_URL": server.URL}))
+	event := &pluginapi.ThresholdEvent{MetricName: "memory_usage", Value: 85, Operator: "greater_than", Threshold: 80, Duration: time.Minute}
+	if err := p.HandleEvent(context.Background(), event); err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+
+	if got.MetricName != "memory_usage" || got.Value != 85 || got.Operator != "greater_than" || got.Threshold != 80 || got.Duration != time.Minute {
+		t.Errorf("unexpected event %+v", got)
+	}
+}
+
+func TestHandleEventRetries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	p := newWebhookPlugin(env(map[string]string{
+		"WEBHOOK_URL":           server.URL,
+		"WEBHOOK_RETRIES":       "3",
+		"WEBHOOK_RETRY_BACKOFF": "1ms",
+	}))
+	if err := p.HandleEvent(context.Background(), &pluginapi.ThresholdEvent{MetricName: "cpu_usage"}); err != nil {
+		t.Fatalf("expected HandleEvent to succeed after retries, got %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls.Load())
+	}
+}
+
+func TestHandleEventGivesUp(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		wantCalls int32
+	}{
+		// Server errors are retried until the retries are used up
+		{"server error", http.StatusInternalServerError, 3},
+		// Client errors won't succeed on retry
+		{"client error", http.StatusBadRequest, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				http.Error(w, "nope", tt.status)
+			}))
+			defer server.Close()
+
+			p := newWebhookPlugin(env(map[string]string{
+				"WEBHOOK_URL":           server.URL,
+				"WEBHOOK_RETRIES":       "2",
+				"WEBHOOK_RETRY_BACKOFF": "1ms",
+			}))
+			err := p.HandleEvent(context.Background(), &pluginapi.ThresholdEvent{MetricName: "cpu_usage"})
+			if err == nil || !strings.Contains(err.Error(), "nope") {
+				t.Errorf("expected error with response body, got %v", err)
+			}
+			if calls.Load() != tt.wantCalls {
+				t.Errorf("expected %d attempts, got %d", tt.wantCalls, calls.Load())
+			}
+		})
+	}
+}
+
+func TestHandleEventTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	p := newWebhookPlugin(env(map[string]string{
+		"WEBHOOK_URL":     server.URL,
+		"WEBHOOK_TIMEOUT": "50ms",
+		"WEBHOOK_RETRIES": "0",
+	}))
+	start := time.Now()
+	if err := p.HandleEvent(context.Background(), &pluginapi.ThresholdEvent{MetricName: "cpu_usage"}); err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected request to time out quickly, took %v", elapsed)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"metric-reader/pkg/threshold"
+)
+
+const (
+	// persistedStateVersion is the version of the persisted state document
+	persistedStateVersion = 2
+
+	// stateConfigMapKey is the ConfigMap data key holding the persisted state document
+	stateConfigMapKey = "state.json"
+)
+
+// persistedSeries is the persisted state machine state of a single series
+type persistedSeries struct {
+	Labels    map[string]string         `json:"labels"`
+	State     threshold.State           `json:"state"`
+	Levels    map[string]persistedLevel `json:"levels,omitempty"`
+	PeakValue float64                   `json:"peak_value,omitempty"`
+}
+
+// persistedLevel is the persisted state of a series for a single threshold level
+type persistedLevel struct {
+	ThresholdStartTime *time.Time `json:"threshold_start_time,omitempty"`
+	BackoffUntil       *time.Time `json:"backoff_until,omitempty"`
+	ActiveSince        *time.Time `json:"active_since,omitempty"`
+	ClearStartTime     *time.Time `json:"clear_start_time,omitempty"`
+	Attempts           int        `json:"attempts,omitempty"`
+}
+
+// persistedSeriesV1 is a series of a version 1 document, which only had the soft and hard levels
+type persistedSeriesV1 struct {
+	Labels                 map[string]string `json:"labels"`
+	State                  threshold.State   `json:"state"`
+	SoftThresholdStartTime *time.Time        `json:"soft_threshold_start_time,omitempty"`
+	HardThresholdStartTime *time.Time        `json:"hard_threshold_start_time,omitempty"`
+	SoftBackoffUntil       *time.Time        `json:"soft_backoff_until,omitempty"`
+	HardBackoffUntil       *time.Time        `json:"hard_backoff_until,omitempty"`
+	SoftActiveSince        *time.Time        `json:"soft_active_since,omitempty"`
+	HardActiveSince        *time.Time        `json:"hard_active_since,omitempty"`
+	PeakValue              float64           `json:"peak_value,omitempty"`
+	SoftAttempts           int               `json:"soft_attempts,omitempty"`
+	HardAttempts           int               `json:"hard_attempts,omitempty"`
+}
+
+// upgrade converts the series to the current format
+func (s persistedSeriesV1) upgrade() persistedSeries {
+	series := persistedSeries{Labels: s.Labels, State: s.State, PeakValue: s.PeakValue}
+	levels := map[string]persistedLevel{
+		"soft": {ThresholdStartTime: s.SoftThresholdStartTime, BackoffUntil: s.SoftBackoffUntil, ActiveSince: s.SoftActiveSince, Attempts: s.SoftAttempts},
+		"hard": {ThresholdStartTime: s.HardThresholdStartTime, BackoffUntil: s.HardBackoffUntil, ActiveSince: s.HardActiveSince, Attempts: s.HardAttempts},
+	}
+	for name, level := range levels {
+		if level == (persistedLevel{}) {
+			continue
+		}
+		if series.Levels == nil {
+			series.Levels = make(map[string]persistedLevel)
+		}
+		series.Levels[name] = level
+	}
+	return series
+}
+
+// persistedState is the document saved by a StateStore, keyed by monitor name
+type persistedState struct {
+	Version  int                          `json:"version"`
+	Monitors map[string][]persistedSeries `json:"monitors"`
+}
+
+// StateStore persists the state machine state of all monitors
+type StateStore interface {
+	// Load returns the last saved state, or an empty state if nothing has been saved yet
+	Load(ctx context.Context) (*persistedState, error)
+	// Save replaces the saved state
+	Save(ctx context.Context, state *persistedState) error
+}
+
+// newStateStore returns the state store selected by the configuration, or nil when persistence is disabled
+func newStateStore(config *Config) (StateStore, error) {
+	switch config.StateStore {
+	case "":
+		return nil, nil
+	case "file":
+		if config.StateStorePath == "" {
+			return nil, fmt.Errorf("state_store_path is required for the file state store")
+		}
+		return &fileStateStore{path: config.StateStorePath}, nil
+	case "configmap":
+		if config.StateStoreConfigMap == "" {
+			return nil, fmt.Errorf("state_store_configmap is required for the configmap state store")
+		}
+		cfg, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get in-cluster config: %v", err)
+		}
+		client, err := kubernetes.NewForConfig(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build kubernetes client: %v", err)
+		}
+		namespace := config.StateStoreNamespace
+		if namespace == "" {
+			namespace, err = serviceAccountNamespace()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return &configMapStateStore{client: client, namespace: namespace, name: config.StateStoreConfigMap}, nil
+	default:
+		return nil, fmt.Errorf("invalid state_store %q (must be file or configmap)", config.StateStore)
+	}
+}
+
+// emptyPersistedState returns a state document without any monitors
+func emptyPersistedState() *persistedState {
+	return &persistedState{Version: persistedStateVersion, Monitors: make(map[string][]persistedSeries)}
+}
+
+// decodePersistedState parses a persisted state document, upgrading version 1 documents
+func decodePersistedState(data []byte) (*persistedState, error) {
+	state := emptyPersistedState()
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to decode state: %v", err)
+	}
+	switch state.Version {
+	case persistedStateVersion:
+	case 1:
+		var v1 struct {
+			Monitors map[string][]persistedSeriesV1 `json:"monitors"`
+		}
+		if err := json.Unmarshal(data, &v1); err != nil {
+			return nil, fmt.Errorf("failed to decode version 1 state: %v", err)
+		}
+		state = emptyPersistedState()
+		for name, series := range v1.Monitors {
+			for _, s := range series {
+				state.Monitors[name] = append(state.Monitors[name], s.upgrade())
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported state version %d", state.Version)
+	}
+	if state.Monitors == nil {
+		state.Monitors = make(map[string][]persistedSeries)
+	}
+	return state, nil
+}
+
+// fileStateStore saves the state as a JSON document on the local filesystem
+type fileStateStore struct {
+	path string
+}
+
+func (s *fileStateStore) Load(ctx context.Context) (*persistedState, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return emptyPersistedState(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %v", err)
+	}
+	return decodePersistedState(data)
+}
+
+func (s *fileStateStore) Save(ctx context.Context, state *persistedState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %v", err)
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+
+	// Write to a temporary file and rename it so a crash never leaves a partial document
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary state file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace state file: %v", err)
+	}
+	return nil
+}
+
+// configMapStateStore saves the state as a JSON document in a Kubernetes ConfigMap,
+// so that it is shared by all replicas and survives leader failovers
+type configMapStateStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+func (s *configMapStateStore) Load(ctx context.Context) (*persistedState, error) {
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return emptyPersistedState(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get state configmap: %v", err)
+	}
+
+	data, ok := cm.Data[stateConfigMapKey]
+	if !ok {
+		return emptyPersistedState(), nil
+	}
+	return decodePersistedState([]byte(data))
+}
+
+func (s *configMapStateStore) Save(ctx context.Context, state *persistedState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %v", err)
+	}
+
+	configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+	cm, err := configMaps.Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: s.name, Namespace: s.namespace},
+			Data:       map[string]string{stateConfigMapKey: string(data)},
+		}
+		if _, err := configMaps.Create(ctx, cm, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create state configmap: %v", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get state configmap: %v", err)
+	}
+
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[stateConfigMapKey] = string(data)
+	if _, err := configMaps.Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update state configmap: %v", err)
+	}
+	return nil
+}
+
+// statePersister merges the state of individual monitors into a single document
+// and writes it to the state store
+type statePersister struct {
+	store StateStore
+
+	mu    sync.Mutex
+	state *persistedState
+}
+
+func newStatePersister(store StateStore) *statePersister {
+	return &statePersister{store: store, state: emptyPersistedState()}
+}
+
+// save replaces the persisted series of a monitor and writes the whole document
+func (p *statePersister) save(ctx context.Context, monitorName string, series []persistedSeries) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(series) == 0 {
+		delete(p.state.Monitors, monitorName)
+	} else {
+		p.state.Monitors[monitorName] = series
+	}
+
+	saveCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return p.store.Save(saveCtx, p.state)
+}
+
+// restore loads the saved state and hands each monitor its series.
+// State of monitors that are no longer configured is dropped on the next save.
+func (p *statePersister) restore(ctx context.Context, monitors []*monitor) error {
+	loadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	state, err := p.store.Load(loadCtx)
+	if err != nil {
+		return err
+	}
+
+	restored := emptyPersistedState()
+	for _, m := range monitors {
+		if series := state.Monitors[m.name]; len(series) > 0 {
+			restored.Monitors[m.name] = series
+		}
+	}
+
+	p.mu.Lock()
+	p.state = restored
+	p.mu.Unlock()
+
+	// Monitors lock themselves before saving, so they are restored without holding p.mu
+	for _, m := range monitors {
+		m.restoreState(restored.Monitors[m.name], m.clock.Now())
+	}
+	return nil
+}
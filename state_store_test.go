@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"k8s.io/client-go/kubernetes/fake"
+	"metric-reader/pkg/threshold"
+)
+
+func TestFileStateStoreRoundTrip(t *testing.T) {
+	store := &fileStateStore{path: filepath.Join(t.TempDir(), "nested", "state.json")}
+	testStateStoreRoundTrip(t, store)
+}
+
+func TestConfigMapStateStoreRoundTrip(t *testing.T) {
+	store := &configMapStateStore{client: fake.NewSimpleClientset(), namespace: "default", name: "metric-reader-state"}
+	testStateStoreRoundTrip(t, store)
+}
+
+func testStateStoreRoundTrip(t *testing.T, store StateStore) {
+	ctx := context.Background()
+
+	state, err := store.Load(ctx)
+	if err != nil {
+		t.Fatalf("Expected empty state before the first save, got error: %v", err)
+	}
+	if len(state.Monitors) != 0 {
+		t.Fatalf("Expected no monitors before the first save, got %v", state.Monitors)
+	}
+
+	backoff := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	state.Monitors["cpu"] = []persistedSeries{{
+		Labels: map[string]string{"instance": "a"},
+		State:  threshold.SoftThresholdActive,
+		Levels: map[string]persistedLevel{"soft": {BackoffUntil: &backoff}},
+	}}
+
+	// Save twice to cover both creating and replacing the stored document
+	for i := 0; i < 2; i++ {
+		if err := store.Save(ctx, state); err != nil {
+			t.Fatalf("Failed to save state: %v", err)
+		}
+	}
+
+	loaded, err := store.Load(ctx)
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	series := loaded.Monitors["cpu"]
+	if len(series) != 1 {
+		t.Fatalf("Expected 1 persisted series, got %d", len(series))
+	}
+	if series[0].State != threshold.SoftThresholdActive || series[0].Labels["instance"] != "a" {
+		t.Errorf("Unexpected persisted series: %+v", series[0])
+	}
+	if soft := series[0].Levels["soft"]; soft.BackoffUntil == nil || !soft.BackoffUntil.Equal(backoff) {
+		t.Errorf("Expected soft backoff deadline %v, got %v", backoff, soft.BackoffUntil)
+	}
+}
+
+func TestDecodePersistedStateRejectsUnknownVersion(t *testing.T) {
+	if _, err := decodePersistedState([]byte(`{"version": 99, "monitors": {}}`)); err == nil {
+		t.Error("Expected error for unsupported state version, got nil")
+	}
+}
+
+func TestDecodePersistedStateUpgradesVersion1(t *testing.T) {
+	state, err := decodePersistedState([]byte(`{"version": 1, "monitors": {"cpu": [{
+		"labels": {"instance": "a"},
+		"state": "HardThresholdActive",
+		"soft_active_since": "2024-01-01T12:00:00Z",
+		"hard_backoff_until": "2024-01-01T13:00:00Z",
+		"peak_value": 97,
+		"soft_attempts": 2
+	}]}}`))
+	if err != nil {
+		t.Fatalf("Failed to decode version 1 state: %v", err)
+	}
+	series := state.Monitors["cpu"]
+	if len(series) != 1 || series[0].State != threshold.HardThresholdActive || series[0].PeakValue != 97 {
+		t.Fatalf("Unexpected upgraded series: %+v", series)
+	}
+	soft, hard := series[0].Levels["soft"], series[0].Levels["hard"]
+	if soft.ActiveSince == nil || soft.Attempts != 2 {
+		t.Errorf("Expected the soft level to be upgraded, got %+v", soft)
+	}
+	if hard.BackoffUntil == nil || !hard.BackoffUntil.Equal(time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the hard backoff deadline to be upgraded, got %+v", hard)
+	}
+}
+
+func TestStatePersistedAcrossRestart(t *testing.T) {
+	leaderActive.Store(true)
+	defer leaderActive.Store(false)
+
+	cfg := MonitorConfig{
+		Name:                 "queues",
+		MetricName:           "queue_depth",
+		ThresholdOperator:    "greater_than",
+		Soft:                 &ThresholdSection{Threshold: 10, BackoffDelay: time.Hour},
+		PollingInterval:      time.Second,
+		MissingValueBehavior: "zero",
+	}
+	store := &fileStateStore{path: filepath.Join(t.TempDir(), "state.json")}
+	vector := model.Vector{{Metric: model.Metric{"queue": "a"}, Value: 50}}
+
+	// First process: the soft threshold becomes active and the plugin runs once
+	first, err := newMonitor(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+	firstPlugin := &seriesTestPlugin{}
+	first.engine.Level("soft").Plugin = firstPlugin
+	first.persister = newStatePersister(store)
+
+	now := time.Now()
+	first.processVector(context.Background(), vector, now)
+	first.processVector(context.Background(), vector, now.Add(time.Second))
+	if firstPlugin.executeCount != 1 {
+		t.Fatalf("Expected plugin to execute once before the restart, got %d", firstPlugin.executeCount)
+	}
+
+	// Second process: state is restored, so the plugin is not executed again
+	second, err := newMonitor(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+	secondPlugin := &seriesTestPlugin{}
+	second.engine.Level("soft").Plugin = secondPlugin
+	persister := newStatePersister(store)
+	second.persister = persister
+
+	if err := persister.restore(context.Background(), []*monitor{second}); err != nil {
+		t.Fatalf("Failed to restore state: %v", err)
+	}
+
+	s, ok := second.series[model.Metric{"queue": "a"}.Fingerprint()]
+	if !ok {
+		t.Fatal("Expected series to be restored")
+	}
+	if s.state.State != threshold.SoftThresholdActive {
+		t.Errorf("Expected restored state SoftThresholdActive, got %s", s.state.State)
+	}
+	if s.state.Level("soft").BackoffUntil.IsZero() {
+		t.Error("Expected soft backoff deadline to be restored")
+	}
+
+	second.processVector(context.Background(), vector, now.Add(2*time.Second))
+	if secondPlugin.executeCount != 0 {
+		t.Errorf("Expected plugin not to execute again after the restart, got %d", secondPlugin.executeCount)
+	}
+}
+
+// lockCheckingStateStore records whether the monitor lock was held while saving
+type lockCheckingStateStore struct {
+	fileStateStore
+	m          *monitor
+	saves      int
+	lockedSave bool
+}
+
+func (s *lockCheckingStateStore) Save(ctx context.Context, state *persistedState) error {
+	s.saves++
+	if !s.m.mu.TryLock() {
+		s.lockedSave = true
+	} else {
+		s.m.mu.Unlock()
+	}
+	return s.fileStateStore.Save(ctx, state)
+}
+
+func TestPersistStateWithoutMonitorLock(t *testing.T) {
+	m, err := newMonitor(MonitorConfig{
+		Name:                 "queues",
+		MetricName:           "queue_depth",
+		ThresholdOperator:    "greater_than",
+		Soft:                 &ThresholdSection{Threshold: 10},
+		PollingInterval:      time.Second,
+		MissingValueBehavior: "zero",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+	store := &lockCheckingStateStore{fileStateStore: fileStateStore{path: filepath.Join(t.TempDir(), "state.json")}, m: m}
+	m.persister = newStatePersister(store)
+
+	now := time.Now()
+	vector := model.Vector{{Metric: model.Metric{"queue": "a"}, Value: 5}}
+	m.processVector(context.Background(), vector, now)
+	m.processVector(context.Background(), vector, now)
+
+	if store.saves != 1 {
+		t.Errorf("Expected the unchanged state to be saved once, got %d saves", store.saves)
+	}
+	if store.lockedSave {
+		t.Error("Expected the state to be saved without holding the monitor lock")
+	}
+}